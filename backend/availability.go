@@ -0,0 +1,350 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// itemLockTTL bounds how long a booking request without a deadline may hold
+// an item lock. A crashed request never blocks an item for longer than this.
+const itemLockTTL = 15 * time.Second
+
+// itemLockMargin keeps a lock alive a little past the deadline of the request
+// holding it, in case its last write is still being applied
+const itemLockMargin = 5 * time.Second
+
+// bookingStartGrace is how far in the past a new booking may start, so a
+// request for the hour that has just begun still goes through
+const bookingStartGrace = 15 * time.Minute
+
+var errItemLocked = errors.New("item is busy, please retry")
+
+// validateBookingStart rejects new bookings that start in the past
+func validateBookingStart(start, now time.Time) error {
+	if start.Before(now.Add(-bookingStartGrace)) {
+		return errors.New("Start date can't be in the past")
+	}
+	return nil
+}
+
+// lockExpiry is when a lock taken under ctx expires: itemLockTTL from now,
+// or just after ctx's deadline if that is later, so the lock can't run out
+// while the request holding it is still working
+func lockExpiry(ctx context.Context, now time.Time) time.Time {
+	expiry := now.Add(itemLockTTL)
+	if deadline, ok := ctx.Deadline(); ok && deadline.Add(itemLockMargin).After(expiry) {
+		expiry = deadline.Add(itemLockMargin)
+	}
+	return expiry
+}
+
+// DateRange is a half-open [Start, End) period of time
+type DateRange struct {
+	Start    time.Time `json:"start" bson:"start"`
+	End      time.Time `json:"end" bson:"end"`
+	Status   string    `json:"status,omitempty" bson:"status,omitempty"`
+	Quantity int       `json:"quantity,omitempty" bson:"quantity,omitempty"` // units booked, for bookings
+}
+
+// lockItem takes the reservation lock for an item so that the availability
+// check and the booking insert happen atomically with respect to other
+// requests for the same item. The returned func releases the lock.
+func lockItem(ctx context.Context, itemID primitive.ObjectID) (func(), error) {
+	collection := GetCollection("item_locks")
+	token := primitive.NewObjectID()
+
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	for {
+		now := time.Now()
+		// Matches only a missing or expired lock. If a live lock exists the
+		// upsert collides on _id and we wait for it to be released.
+		_, err := collection.UpdateOne(waitCtx,
+			bson.M{"_id": itemID, "expiresAt": bson.M{"$lt": now}},
+			bson.M{"$set": bson.M{"token": token, "expiresAt": lockExpiry(ctx, now)}},
+			options.Update().SetUpsert(true),
+		)
+		if err == nil {
+			release := func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				collection.DeleteOne(ctx, bson.M{"_id": itemID, "token": token})
+			}
+			return release, nil
+		}
+		if waitCtx.Err() != nil && ctx.Err() == nil {
+			return nil, errItemLocked
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		select {
+		case <-waitCtx.Done():
+			return nil, errItemLocked
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// activeBookingFilter matches bookings that still hold the item: confirmed
+// or handed-over bookings, and pending requests whose start date hasn't passed.
+// Subscription renewals are left out; the contract booking and the
+// subscription itself hold the item, see subscriptionHolds.
+func activeBookingFilter(now time.Time) bson.M {
+	return bson.M{
+		"$or": []bson.M{
+			{"status": bson.M{"$in": []string{StatusConfirmed, StatusHandedOver}}},
+			{"status": StatusPending, "startDate": bson.M{"$gt": now}},
+		},
+		"cycle": bson.M{"$not": bson.M{"$gt": 1}},
+	}
+}
+
+// overlappingBookingsFilter matches active bookings of an item that overlap [start, end)
+func overlappingBookingsFilter(itemID primitive.ObjectID, start, end time.Time) bson.M {
+	return bson.M{
+		"$and": []bson.M{
+			activeBookingFilter(time.Now()),
+			{
+				"itemId":    itemID,
+				"startDate": bson.M{"$lt": end},
+				"endDate":   bson.M{"$gt": start},
+			},
+		},
+	}
+}
+
+// findConflicts returns the active bookings of an item that overlap [start, end),
+// and the time running subscriptions hold it for beyond that.
+// excludeID lets a booking be re-checked against everything but itself.
+func findConflicts(ctx context.Context, itemID primitive.ObjectID, start, end time.Time, excludeID primitive.ObjectID) ([]DateRange, error) {
+	filter := overlappingBookingsFilter(itemID, start, end)
+	if !excludeID.IsZero() {
+		filter["_id"] = bson.M{"$ne": excludeID}
+	}
+
+	cursor, err := GetCollection("bookings").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "startDate", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var bookings []Booking
+	if err := cursor.All(ctx, &bookings); err != nil {
+		return nil, err
+	}
+
+	conflicts := make([]DateRange, 0, len(bookings))
+	for _, b := range bookings {
+		conflicts = append(conflicts, DateRange{Start: b.StartDate, End: b.EndDate, Status: b.Status, Quantity: b.units()})
+	}
+
+	holds, err := subscriptionHolds(ctx, bson.M{"itemId": itemID}, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return append(conflicts, holds[itemID]...), nil
+}
+
+// unavailableItemIDs returns the items whose every unit is taken by active
+// bookings and subscriptions at some point in [start, end)
+func unavailableItemIDs(ctx context.Context, start, end time.Time) ([]primitive.ObjectID, error) {
+	filter := bson.M{
+		"$and": []bson.M{
+			activeBookingFilter(time.Now()),
+			{
+				"startDate": bson.M{"$lt": end},
+				"endDate":   bson.M{"$gt": start},
+			},
+		},
+	}
+
+	cursor, err := GetCollection("bookings").Find(ctx, filter, options.Find().SetProjection(bson.M{
+		"itemId": 1, "startDate": 1, "endDate": 1, "quantity": 1,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	booked := map[primitive.ObjectID][]DateRange{}
+	for cursor.Next(ctx) {
+		var b Booking
+		if err := cursor.Decode(&b); err != nil {
+			continue
+		}
+		booked[b.ItemID] = append(booked[b.ItemID], DateRange{Start: b.StartDate, End: b.EndDate, Quantity: b.units()})
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	holds, err := subscriptionHolds(ctx, bson.M{}, start, end)
+	if err != nil {
+		return nil, err
+	}
+	for id, ranges := range holds {
+		booked[id] = append(booked[id], ranges...)
+	}
+	if len(booked) == 0 {
+		return nil, nil
+	}
+
+	// Only multi-unit items can have a booking and still be free
+	ids := make([]primitive.ObjectID, 0, len(booked))
+	for id := range booked {
+		ids = append(ids, id)
+	}
+	capacity := map[primitive.ObjectID]int{}
+	itemCursor, err := GetCollection("items").Find(ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "quantity": bson.M{"$gt": 1}},
+		options.Find().SetProjection(bson.M{"quantity": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer itemCursor.Close(ctx)
+	for itemCursor.Next(ctx) {
+		var item Item
+		if err := itemCursor.Decode(&item); err == nil {
+			capacity[item.ID] = itemQuantity(&item)
+		}
+	}
+
+	itemIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		units, ok := capacity[id]
+		if !ok || peakUnits(booked[id], start, end) >= units {
+			itemIDs = append(itemIDs, id)
+		}
+	}
+	return itemIDs, nil
+}
+
+// freeRanges returns the gaps in [from, to) that are not covered by booked
+func freeRanges(from, to time.Time, booked []DateRange) []DateRange {
+	sorted := make([]DateRange, len(booked))
+	copy(sorted, booked)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	free := []DateRange{}
+	cursor := from
+	for _, b := range sorted {
+		if b.Start.After(cursor) {
+			end := b.Start
+			if end.After(to) {
+				end = to
+			}
+			if end.After(cursor) {
+				free = append(free, DateRange{Start: cursor, End: end})
+			}
+		}
+		if b.End.After(cursor) {
+			cursor = b.End
+		}
+		if !cursor.Before(to) {
+			return free
+		}
+	}
+	if cursor.Before(to) {
+		free = append(free, DateRange{Start: cursor, End: to})
+	}
+	return free
+}
+
+// parseDateParam accepts either an RFC3339 timestamp or a plain YYYY-MM-DD
+// date, which starts at midnight in rentalLocation
+func parseDateParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, rentalLocation())
+}
+
+// getItemAvailability returns booked and free ranges of an item between from
+// and to. A range is free while at least one unit is left.
+func getItemAvailability(w http.ResponseWriter, r *http.Request, id string) {
+	itemID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid item ID")
+		return
+	}
+
+	// Default window: the next 90 days
+	from := time.Now()
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = parseDateParam(v); err != nil {
+			JSONError(w, http.StatusBadRequest, "Invalid from date")
+			return
+		}
+	}
+	to := from.AddDate(0, 0, 90)
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = parseDateParam(v); err != nil {
+			JSONError(w, http.StatusBadRequest, "Invalid to date")
+			return
+		}
+	}
+	if !to.After(from) {
+		JSONError(w, http.StatusBadRequest, "'to' must be after 'from'")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var item Item
+	if err := GetCollection("items").FindOne(ctx, bson.M{"_id": itemID}).Decode(&item); err != nil {
+		JSONError(w, http.StatusNotFound, "Item not found")
+		return
+	}
+
+	booked, err := findConflicts(ctx, itemID, from, to, primitive.NilObjectID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to fetch availability")
+		return
+	}
+	blocked := calendarBlocks(item.Calendar, from, to)
+
+	// Free ranges leave out the owner's buffer around each booking, and
+	// periods in which every unit is booked
+	buffer := item.Calendar.buffer()
+	held := make([]DateRange, 0, len(booked))
+	for _, b := range booked {
+		held = append(held, DateRange{Start: b.Start.Add(-buffer), End: b.End.Add(buffer), Quantity: b.Quantity})
+	}
+	taken := append(append([]DateRange{}, blocked...), saturatedRanges(held, itemQuantity(&item))...)
+
+	// Gaps too short for the item's minimum rental can't be booked
+	unit := priceUnit(&item)
+	minDuration, maxDuration := item.MinDuration, item.MaxDuration
+	free := []DateRange{}
+	for _, f := range freeRanges(from, to, taken) {
+		if f.End.Sub(f.Start) >= time.Duration(minDuration)*unitDuration(unit) {
+			free = append(free, f)
+		}
+	}
+
+	JSON(w, http.StatusOK, map[string]interface{}{
+		"itemId":      itemID,
+		"quantity":    itemQuantity(&item),
+		"from":        from,
+		"to":          to,
+		"unit":        unit,
+		"minDuration": minDuration,
+		"maxDuration": maxDuration,
+		"booked":      booked,
+		"blocked":     blocked,
+		"free":        free,
+	})
+}
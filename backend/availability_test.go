@@ -0,0 +1,88 @@
+package backend
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFreeRanges(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+	r := func(start, end int) DateRange { return DateRange{Start: day(start), End: day(end)} }
+
+	tests := []struct {
+		name   string
+		booked []DateRange
+		want   []DateRange
+	}{
+		{"nothing booked", nil, []DateRange{r(1, 10)}},
+		{"booked in the middle", []DateRange{r(4, 6)}, []DateRange{r(1, 4), r(6, 10)}},
+		{"booked from the start", []DateRange{r(1, 3)}, []DateRange{r(3, 10)}},
+		{"booked to the end", []DateRange{r(8, 10)}, []DateRange{r(1, 8)}},
+		{"booked across the window", []DateRange{r(1, 12)}, []DateRange{}},
+		{"starting before the window", []DateRange{{Start: day(1).Add(-48 * time.Hour), End: day(2)}}, []DateRange{r(2, 10)}},
+		{"ending after the window", []DateRange{r(9, 15)}, []DateRange{r(1, 9)}},
+		{"out of order", []DateRange{r(7, 8), r(2, 3)}, []DateRange{r(1, 2), r(3, 7), r(8, 10)}},
+		{"overlapping", []DateRange{r(2, 5), r(3, 4), r(4, 6)}, []DateRange{r(1, 2), r(6, 10)}},
+		{"back to back", []DateRange{r(2, 4), r(4, 6)}, []DateRange{r(1, 2), r(6, 10)}},
+		{"after the window", []DateRange{r(11, 12)}, []DateRange{r(1, 10)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := freeRanges(day(1), day(10), tt.booked)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("freeRanges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateBookingStart(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 10, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		start   time.Time
+		wantErr bool
+	}{
+		{"future", now.Add(24 * time.Hour), false},
+		{"now", now, false},
+		{"the hour that has just begun", time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC), false},
+		{"at the grace limit", now.Add(-bookingStartGrace), false},
+		{"past the grace limit", now.Add(-bookingStartGrace - time.Second), true},
+		{"yesterday", now.Add(-24 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateBookingStart(tt.start, now); (err != nil) != tt.wantErr {
+				t.Errorf("validateBookingStart() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLockExpiry(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	withDeadline := func(d time.Duration) context.Context {
+		ctx, cancel := context.WithDeadline(context.Background(), now.Add(d))
+		t.Cleanup(cancel)
+		return ctx
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want time.Time
+	}{
+		{"no deadline", context.Background(), now.Add(itemLockTTL)},
+		{"short deadline", withDeadline(time.Second), now.Add(itemLockTTL)},
+		{"checkout deadline", withDeadline(30 * time.Second), now.Add(30*time.Second + itemLockMargin)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lockExpiry(tt.ctx, now); !got.Equal(tt.want) {
+				t.Errorf("lockExpiry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
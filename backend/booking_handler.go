@@ -3,8 +3,8 @@ package backend
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand"
 	"net/http"
 	"strings"
 	"time"
@@ -14,16 +14,6 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// generateTrackingID creates an 8-character alphanumeric tracking ID
-func generateTrackingID() string {
-	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	result := make([]byte, 8)
-	for i := range result {
-		result[i] = charset[rand.Intn(len(charset))]
-	}
-	return string(result)
-}
-
 func HandleBookings(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -57,9 +47,10 @@ func HandlePendingRequestsCount(w http.ResponseWriter, r *http.Request) {
 	// (Pending bookings whose startDate has passed are considered "expired" and should not be counted)
 	now := time.Now()
 	count, err := collection.CountDocuments(ctx, bson.M{
-		"ownerId":   userID,
-		"status":    "pending",
-		"startDate": bson.M{"$gte": now}, // Only future pending bookings
+		"ownerId":     userID,
+		"status":      "pending",
+		"startDate":   bson.M{"$gte": now}, // Only future pending bookings
+		"autoConfirm": bson.M{"$ne": true}, // Instant bookings don't need a response
 	})
 	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "Failed to count pending requests")
@@ -73,34 +64,125 @@ func HandleBookingByID(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api/bookings/")
 
 	// Skip if this is a known sub-route (these should be handled by specific handlers)
-	if path == "owner" || path == "pending-count" {
+	if path == "owner" || path == "pending-count" || path == "quote" || path == "track" {
 		JSONError(w, http.StatusNotFound, "Not found")
 		return
 	}
 
-	id := path
-	switch r.Method {
-	case http.MethodGet:
-		getBooking(w, r, id)
-	case http.MethodPatch:
-		updateBookingStatus(w, r, id)
+	id, action, _ := strings.Cut(path, "/")
+	switch action {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			getBooking(w, r, id)
+		case http.MethodPatch:
+			updateBookingStatus(w, r, id)
+		default:
+			JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	case "pay":
+		if r.Method != http.MethodPost {
+			JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		payBooking(w, r, id)
+	case "claim":
+		if r.Method != http.MethodPost {
+			JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		fileDamageClaim(w, r, id)
+	case "claim/respond":
+		if r.Method != http.MethodPost {
+			JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		respondToDamageClaim(w, r, id)
+	case "claim/resolve":
+		if r.Method != http.MethodPost {
+			JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		resolveDamageClaim(w, r, id)
+	case "handover", "return":
+		if r.Method != http.MethodPost {
+			JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		step := action
+		if action == "handover" {
+			step = "pickup"
+		}
+		recordHandover(w, r, id, step)
+	case "otp":
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		getHandoverCodes(w, r, id)
+	case "modifications":
+		if r.Method != http.MethodPost {
+			JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		requestModification(w, r, id)
+	case "documents/agreement", "documents/invoice":
+		if r.Method != http.MethodGet {
+			JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		handleBookingDocument(w, r, id, strings.TrimPrefix(action, "documents/"))
 	default:
-		JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		modID, ok := strings.CutPrefix(action, "modifications/")
+		if !ok || modID == "" {
+			JSONError(w, http.StatusNotFound, "Not found")
+			return
+		}
+		if r.Method != http.MethodPost {
+			JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		respondToModification(w, r, id, modID)
 	}
 }
 
+// findBookingForUser loads a booking and the role userID plays on it. It
+// writes the error response itself and returns ok=false if the booking
+// doesn't exist or the user is not a party to it.
+func findBookingForUser(ctx context.Context, w http.ResponseWriter, id string, userID primitive.ObjectID) (*Booking, string, bool) {
+	bookingID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid booking ID")
+		return nil, "", false
+	}
+
+	var booking Booking
+	if err := GetCollection("bookings").FindOne(ctx, bson.M{"_id": bookingID}).Decode(&booking); err != nil {
+		JSONError(w, http.StatusNotFound, "Booking not found")
+		return nil, "", false
+	}
+
+	role := bookingRole(&booking, userID)
+	if role == "" {
+		JSONError(w, http.StatusForbidden, "Not authorized to access this booking")
+		return nil, "", false
+	}
+	return &booking, role, true
+}
+
 func createBooking(w http.ResponseWriter, r *http.Request) {
 	userID, _ := GetUserID(r)
 
-	// Use intermediate struct to parse string IDs and dates from frontend
+	// Use intermediate struct to parse string IDs and dates from frontend.
+	// Any totalPrice sent by the client is ignored; the price is computed here.
 	var req struct {
-		ItemID        string  `json:"itemId"`
-		StartDate     string  `json:"startDate"`
-		EndDate       string  `json:"endDate"`
-		TotalPrice    float64 `json:"totalPrice"`
-		PickupAddress string  `json:"pickupAddress"`
-		DropAddress   string  `json:"dropAddress"`
-		Notes         string  `json:"notes"`
+		ItemID        string `json:"itemId"`
+		StartDate     string `json:"startDate"`
+		EndDate       string `json:"endDate"`
+		Quantity      int    `json:"quantity"`
+		PickupAddress string `json:"pickupAddress"`
+		DropAddress   string `json:"dropAddress"`
+		Notes         string `json:"notes"`
 	}
 	DecodeJSON(r, &req)
 
@@ -111,19 +193,16 @@ func createBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse dates
-	startDate, err := time.Parse(time.RFC3339, req.StartDate)
+	startDate, endDate, err := parseBookingDates(req.StartDate, req.EndDate)
 	if err != nil {
-		JSONError(w, http.StatusBadRequest, "Invalid start date format")
+		JSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	endDate, err := time.Parse(time.RFC3339, req.EndDate)
-	if err != nil {
-		JSONError(w, http.StatusBadRequest, "Invalid end date format")
+	if err := validateBookingStart(startDate, time.Now()); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	collection := GetCollection("bookings")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -134,26 +213,86 @@ func createBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	quote, err := calculateQuote(&item, startDate, endDate, req.Quantity)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Hold the item lock across the availability check and the insert so two
+	// renters can't both pass the check for the same dates
+	release, err := lockItem(ctx, itemID)
+	if err != nil {
+		JSONError(w, http.StatusConflict, "Item is being booked by someone else, please retry")
+		return
+	}
+	defer release()
+
+	conflicts, err := checkAvailability(ctx, &item, startDate, endDate, primitive.NilObjectID, quote.Quantity)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to check availability")
+		return
+	}
+	if len(conflicts) > 0 {
+		JSON(w, http.StatusConflict, map[string]interface{}{
+			"error":     "Item is not available for the selected dates",
+			"conflicts": conflicts,
+		})
+		return
+	}
+
+	booking := newBooking(ctx, &item, userID, quote)
+	booking.PickupAddress = req.PickupAddress
+	booking.DropAddress = req.DropAddress
+	booking.Notes = req.Notes
+
+	if err := insertBooking(ctx, &booking); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to create booking")
+		return
+	}
+
+	// Instant bookings are confirmed once paid; the owner hears about them then
+	if booking.AutoConfirm {
+		JSON(w, http.StatusCreated, map[string]interface{}{"message": "Booking created, pay to confirm it", "booking": booking})
+		return
+	}
+	notifyNewRequest(&booking, &item)
+
+	JSON(w, http.StatusCreated, map[string]interface{}{"message": "Booking created", "booking": booking})
+}
+
+// newBooking builds a pending booking of item by renterID at the quoted price
+func newBooking(ctx context.Context, item *Item, renterID primitive.ObjectID, quote *PriceQuote) Booking {
+	now := time.Now()
 	booking := Booking{
-		ID:            primitive.NewObjectID(),
-		TrackingID:    generateTrackingID(),
-		ItemID:        itemID,
-		RenterID:      userID,
-		OwnerID:       item.OwnerID,
-		StartDate:     startDate,
-		EndDate:       endDate,
-		TotalPrice:    req.TotalPrice,
-		Status:        "pending",
-		PaymentStatus: "pending",
-		PickupAddress: req.PickupAddress,
-		DropAddress:   req.DropAddress,
-		Notes:         req.Notes,
-		CreatedAt:     time.Now(),
-		UpdatedAt:     time.Now(),
-	}
-
-	collection.InsertOne(ctx, booking)
+		ID:                 primitive.NewObjectID(),
+		TrackingID:         generateTrackingID(),
+		ItemID:             item.ID,
+		RenterID:           renterID,
+		OwnerID:            item.OwnerID,
+		StartDate:          quote.StartDate,
+		EndDate:            quote.EndDate,
+		Quantity:           quote.Quantity,
+		TotalPrice:         quote.Total,
+		LineItems:          quote.LineItems,
+		Deposit:            newDeposit(item, quote.Quantity),
+		CancellationPolicy: item.CancellationPolicy,
+		AutoConfirm:        qualifiesForInstantBook(ctx, item, renterID),
+		Status:             StatusPending,
+		PaymentStatus:      PaymentPending,
+		StatusHistory:      []StatusChange{{To: StatusPending, By: &renterID, Role: RoleRenter, At: now}},
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	if !booking.AutoConfirm {
+		respondBy := now.Add(bookingResponseWindow())
+		booking.RespondBy = &respondBy
+	}
+	return booking
+}
 
+// notifyNewRequest tells the owner about a new booking request
+func notifyNewRequest(booking *Booking, item *Item) {
 	// Notify item owner via WebSocket about new booking request
 	notificationData, _ := json.Marshal(map[string]interface{}{
 		"type":       "booking_notification",
@@ -170,8 +309,6 @@ func createBooking(w http.ResponseWriter, r *http.Request) {
 
 	// Also send FCM push notification for when owner is offline
 	SendBookingPushNotification(item.OwnerID, "new_request", item.Title, booking.ID.Hex())
-
-	JSON(w, http.StatusCreated, map[string]interface{}{"message": "Booking created", "booking": booking})
 }
 
 func getMyBookings(w http.ResponseWriter, r *http.Request) {
@@ -186,74 +323,11 @@ func getMyBookings(w http.ResponseWriter, r *http.Request) {
 	var bookings []Booking
 	cursor.All(ctx, &bookings)
 
-	// Populate item for each booking
-	itemCol := GetCollection("items")
-	userCol := GetCollection("users")
-
-	type PopulatedBooking struct {
-		ID            primitive.ObjectID `json:"id" bson:"_id"`
-		TrackingID    string             `json:"trackingId" bson:"trackingId"`
-		ItemID        primitive.ObjectID `json:"itemId" bson:"itemId"`
-		RenterID      primitive.ObjectID `json:"renterId" bson:"renterId"`
-		OwnerID       primitive.ObjectID `json:"ownerId" bson:"ownerId"`
-		StartDate     time.Time          `json:"startDate" bson:"startDate"`
-		EndDate       time.Time          `json:"endDate" bson:"endDate"`
-		TotalAmount   float64            `json:"totalPrice" bson:"totalPrice"`
-		Status        string             `json:"status" bson:"status"`
-		PaymentStatus string             `json:"paymentStatus" bson:"paymentStatus"`
-		PickupAddress string             `json:"pickupAddress" bson:"pickupAddress"`
-		DropAddress   string             `json:"dropAddress" bson:"dropAddress"`
-		Notes         string             `json:"notes" bson:"notes"`
-		CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
-		UpdatedAt     time.Time          `json:"updatedAt" bson:"updatedAt"`
-		Item          *Item              `json:"item,omitempty"`
-		Owner         *User              `json:"owner,omitempty"`
-	}
-
-	var populatedBookings []PopulatedBooking
-	for _, b := range bookings {
-		pb := PopulatedBooking{
-			ID:            b.ID,
-			TrackingID:    b.TrackingID,
-			ItemID:        b.ItemID,
-			RenterID:      b.RenterID,
-			OwnerID:       b.OwnerID,
-			StartDate:     b.StartDate,
-			EndDate:       b.EndDate,
-			TotalAmount:   b.TotalPrice,
-			Status:        b.Status,
-			PaymentStatus: b.PaymentStatus,
-			PickupAddress: b.PickupAddress,
-			DropAddress:   b.DropAddress,
-			Notes:         b.Notes,
-			CreatedAt:     b.CreatedAt,
-			UpdatedAt:     b.UpdatedAt,
-		}
-
-		// Populate item
-		var item Item
-		if err := itemCol.FindOne(ctx, bson.M{"_id": b.ItemID}).Decode(&item); err == nil {
-			pb.Item = &Item{
-				ID: item.ID, Title: item.Title, Images: item.Images, Price: item.Price,
-				Category: item.Category, SubCategory: item.SubCategory, Brand: item.Brand, Model: item.Model,
-				Attributes: item.Attributes, Location: item.Location, Description: item.Description,
-				Rating: item.Rating, Reviews: item.Reviews,
-			}
-		}
-
-		// Populate owner
-		var owner User
-		if err := userCol.FindOne(ctx, bson.M{"_id": b.OwnerID}).Decode(&owner); err == nil {
-			pb.Owner = &User{
-				ID: owner.ID, Name: owner.Name, Avatar: owner.Avatar,
-				Rating: owner.Rating, TotalRatings: owner.TotalRatings,
-			}
-		}
-
-		populatedBookings = append(populatedBookings, pb)
+	for i := range bookings {
+		populateBooking(ctx, &bookings[i])
 	}
 
-	JSON(w, http.StatusOK, map[string]interface{}{"bookings": populatedBookings, "total": len(populatedBookings)})
+	JSON(w, http.StatusOK, map[string]interface{}{"bookings": bookings, "total": len(bookings)})
 }
 
 func getOwnerBookings(w http.ResponseWriter, r *http.Request) {
@@ -268,74 +342,15 @@ func getOwnerBookings(w http.ResponseWriter, r *http.Request) {
 	var bookings []Booking
 	cursor.All(ctx, &bookings)
 
-	// Populate item and renter for each booking
-	itemCol := GetCollection("items")
-	userCol := GetCollection("users")
-
-	type PopulatedBooking struct {
-		ID            primitive.ObjectID `json:"id" bson:"_id"`
-		TrackingID    string             `json:"trackingId" bson:"trackingId"`
-		ItemID        primitive.ObjectID `json:"itemId" bson:"itemId"`
-		RenterID      primitive.ObjectID `json:"renterId" bson:"renterId"`
-		OwnerID       primitive.ObjectID `json:"ownerId" bson:"ownerId"`
-		StartDate     time.Time          `json:"startDate" bson:"startDate"`
-		EndDate       time.Time          `json:"endDate" bson:"endDate"`
-		TotalAmount   float64            `json:"totalPrice" bson:"totalPrice"`
-		Status        string             `json:"status" bson:"status"`
-		PaymentStatus string             `json:"paymentStatus" bson:"paymentStatus"`
-		PickupAddress string             `json:"pickupAddress" bson:"pickupAddress"`
-		DropAddress   string             `json:"dropAddress" bson:"dropAddress"`
-		Notes         string             `json:"notes" bson:"notes"`
-		CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
-		UpdatedAt     time.Time          `json:"updatedAt" bson:"updatedAt"`
-		Item          *Item              `json:"item,omitempty"`
-		Renter        *User              `json:"renter,omitempty"`
-	}
-
-	var populatedBookings []PopulatedBooking
-	for _, b := range bookings {
-		pb := PopulatedBooking{
-			ID:            b.ID,
-			TrackingID:    b.TrackingID,
-			ItemID:        b.ItemID,
-			RenterID:      b.RenterID,
-			OwnerID:       b.OwnerID,
-			StartDate:     b.StartDate,
-			EndDate:       b.EndDate,
-			TotalAmount:   b.TotalPrice,
-			Status:        b.Status,
-			PaymentStatus: b.PaymentStatus,
-			PickupAddress: b.PickupAddress,
-			DropAddress:   b.DropAddress,
-			Notes:         b.Notes,
-			CreatedAt:     b.CreatedAt,
-			UpdatedAt:     b.UpdatedAt,
-		}
-
-		// Populate item
-		var item Item
-		if err := itemCol.FindOne(ctx, bson.M{"_id": b.ItemID}).Decode(&item); err == nil {
-			pb.Item = &Item{
-				ID: item.ID, Title: item.Title, Images: item.Images, Price: item.Price,
-				Category: item.Category, SubCategory: item.SubCategory, Brand: item.Brand, Model: item.Model,
-				Attributes: item.Attributes, Location: item.Location, Description: item.Description,
-				Rating: item.Rating, Reviews: item.Reviews,
-			}
-		}
-
-		// Populate renter
-		var renter User
-		if err := userCol.FindOne(ctx, bson.M{"_id": b.RenterID}).Decode(&renter); err == nil {
-			pb.Renter = &User{
-				ID: renter.ID, Name: renter.Name, Avatar: renter.Avatar,
-				Rating: renter.Rating, TotalRatings: renter.TotalRatings,
-			}
-		}
-
-		populatedBookings = append(populatedBookings, pb)
+	for i := range bookings {
+		populateBooking(ctx, &bookings[i])
 	}
 
-	JSON(w, http.StatusOK, map[string]interface{}{"bookings": populatedBookings, "total": len(populatedBookings)})
+	JSON(w, http.StatusOK, map[string]interface{}{
+		"bookings":      bookings,
+		"total":         len(bookings),
+		"subscriptions": findSubscriptions(ctx, bson.M{"ownerId": userID}),
+	})
 }
 
 func getBooking(w http.ResponseWriter, r *http.Request, id string) {
@@ -350,52 +365,17 @@ func getBooking(w http.ResponseWriter, r *http.Request, id string) {
 		return
 	}
 
-	// Populate Item, Owner, Renter
-	itemCol := GetCollection("items")
-	userCol := GetCollection("users")
+	populateBooking(ctx, &booking)
 
-	type PopulatedBooking struct {
-		ID            primitive.ObjectID `json:"id" bson:"_id"`
-		TrackingID    string             `json:"trackingId" bson:"trackingId"`
-		ItemID        primitive.ObjectID `json:"itemId" bson:"itemId"`
-		RenterID      primitive.ObjectID `json:"renterId" bson:"renterId"`
-		OwnerID       primitive.ObjectID `json:"ownerId" bson:"ownerId"`
-		StartDate     time.Time          `json:"startDate" bson:"startDate"`
-		EndDate       time.Time          `json:"endDate" bson:"endDate"`
-		TotalAmount   float64            `json:"totalPrice" bson:"totalPrice"`
-		Status        string             `json:"status" bson:"status"`
-		PaymentStatus string             `json:"paymentStatus" bson:"paymentStatus"`
-		PickupAddress string             `json:"pickupAddress" bson:"pickupAddress"`
-		DropAddress   string             `json:"dropAddress" bson:"dropAddress"`
-		Notes         string             `json:"notes" bson:"notes"`
-		CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
-		UpdatedAt     time.Time          `json:"updatedAt" bson:"updatedAt"`
-		Item          *Item              `json:"item,omitempty"`
-		Owner         *User              `json:"owner,omitempty"`
-		Renter        *User              `json:"renter,omitempty"`
-	}
-
-	pb := PopulatedBooking{
-		ID:            booking.ID,
-		TrackingID:    booking.TrackingID,
-		ItemID:        booking.ItemID,
-		RenterID:      booking.RenterID,
-		OwnerID:       booking.OwnerID,
-		StartDate:     booking.StartDate,
-		EndDate:       booking.EndDate,
-		TotalAmount:   booking.TotalPrice,
-		Status:        booking.Status,
-		PaymentStatus: booking.PaymentStatus,
-		PickupAddress: booking.PickupAddress,
-		DropAddress:   booking.DropAddress,
-		Notes:         booking.Notes,
-		CreatedAt:     booking.CreatedAt,
-		UpdatedAt:     booking.UpdatedAt,
-	}
+	JSON(w, http.StatusOK, map[string]interface{}{"booking": booking})
+}
 
+// populateBooking attaches a summary of the item and the public profiles of
+// the owner and renter to a booking for API responses
+func populateBooking(ctx context.Context, b *Booking) {
 	var item Item
-	if err := itemCol.FindOne(ctx, bson.M{"_id": booking.ItemID}).Decode(&item); err == nil {
-		pb.Item = &Item{
+	if err := GetCollection("items").FindOne(ctx, bson.M{"_id": b.ItemID}).Decode(&item); err == nil {
+		b.Item = &Item{
 			ID: item.ID, Title: item.Title, Images: item.Images, Price: item.Price,
 			Category: item.Category, SubCategory: item.SubCategory, Brand: item.Brand, Model: item.Model,
 			Attributes: item.Attributes, Location: item.Location, Description: item.Description,
@@ -403,23 +383,23 @@ func getBooking(w http.ResponseWriter, r *http.Request, id string) {
 		}
 	}
 
+	userCol := GetCollection("users")
+
 	var owner User
-	if err := userCol.FindOne(ctx, bson.M{"_id": booking.OwnerID}).Decode(&owner); err == nil {
-		pb.Owner = &User{
+	if err := userCol.FindOne(ctx, bson.M{"_id": b.OwnerID}).Decode(&owner); err == nil {
+		b.Owner = &User{
 			ID: owner.ID, Name: owner.Name, Avatar: owner.Avatar,
 			Rating: owner.Rating, TotalRatings: owner.TotalRatings,
 		}
 	}
 
 	var renter User
-	if err := userCol.FindOne(ctx, bson.M{"_id": booking.RenterID}).Decode(&renter); err == nil {
-		pb.Renter = &User{
+	if err := userCol.FindOne(ctx, bson.M{"_id": b.RenterID}).Decode(&renter); err == nil {
+		b.Renter = &User{
 			ID: renter.ID, Name: renter.Name, Avatar: renter.Avatar,
 			Rating: renter.Rating, TotalRatings: renter.TotalRatings,
 		}
 	}
-
-	JSON(w, http.StatusOK, map[string]interface{}{"booking": pb})
 }
 
 func updateBookingStatus(w http.ResponseWriter, r *http.Request, id string) {
@@ -435,6 +415,16 @@ func updateBookingStatus(w http.ResponseWriter, r *http.Request, id string) {
 	}
 	DecodeJSON(r, &req)
 
+	if !isBookingStatus(req.Status) {
+		JSONError(w, http.StatusBadRequest, "Invalid status")
+		return
+	}
+	// These need the renter's code and a condition checklist
+	if req.Status == StatusHandedOver || req.Status == StatusReturned {
+		JSONError(w, http.StatusBadRequest, "Use POST /api/bookings/:id/handover or /return to record the handover")
+		return
+	}
+
 	userID, _ := GetUserID(r)
 	collection := GetCollection("bookings")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -447,97 +437,77 @@ func updateBookingStatus(w http.ResponseWriter, r *http.Request, id string) {
 		return
 	}
 
-	update := bson.M{}
-
-	if req.Status == "cancelled" {
-		// Both Owner and Renter can cancel
-		if booking.OwnerID != userID && booking.RenterID != userID {
-			JSONError(w, http.StatusForbidden, "Not authorized to cancel this booking")
-			return
-		}
+	role := bookingRole(&booking, userID)
+	if role == "" {
+		JSONError(w, http.StatusForbidden, "Not authorized to update this booking")
+		return
+	}
 
-		// Only allow cancelling properly (pending or confirmed)
-		if booking.Status == "completed" || booking.Status == "rejected" || booking.Status == "cancelled" {
-			JSONError(w, http.StatusBadRequest, "Cannot cancel a booking that is "+booking.Status)
-			return
-		}
+	if booking.AutoConfirm && booking.Status == StatusPending && (req.Status == StatusConfirmed || req.Status == StatusRejected) {
+		JSONError(w, http.StatusConflict, "Instant bookings are confirmed automatically once paid")
+		return
+	}
 
-		update = bson.M{
-			"$set": bson.M{
-				"status":             "cancelled",
-				"updatedAt":          time.Now(),
-				"cancelledBy":        userID,
-				"cancellationReason": req.Reason,
-			},
-		}
+	extra := bson.M{}
+	if req.Status == StatusCancelled {
+		extra["cancelledBy"] = userID
+		extra["cancellationReason"] = req.Reason
+	}
 
-	} else if req.Status == "confirmed" || req.Status == "rejected" {
-		// Only Owner can confirm or reject
-		if booking.OwnerID != userID {
-			JSONError(w, http.StatusForbidden, "Only the owner can update status")
+	if err := transitionBooking(ctx, &booking, req.Status, role, userID, req.Reason, extra); err != nil {
+		var te *transitionError
+		if errors.As(err, &te) {
+			JSONError(w, te.Code, te.Message)
 			return
 		}
-		update = bson.M{
-			"$set": bson.M{
-				"status":    req.Status,
-				"updatedAt": time.Now(),
-			},
-		}
-	} else {
-		JSONError(w, http.StatusBadRequest, "Invalid status")
-		return
-	}
-
-	_, err = collection.UpdateOne(ctx, bson.M{"_id": bookingID}, update)
-	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "Failed to update booking")
 		return
 	}
 
 	// If confirmed, increment Renter's TotalBookings
-	if req.Status == "confirmed" {
+	if req.Status == StatusConfirmed {
 		userCol := GetCollection("users")
 		_, err = userCol.UpdateOne(ctx, bson.M{"_id": booking.RenterID}, bson.M{"$inc": bson.M{"totalBookings": 1}})
 		if err != nil {
 			// Log error but don't fail the request
 			fmt.Println("Error incrementing totalBookings:", err)
 		}
+		notifyBookingEvent(ctx, &booking, booking.RenterID, "agreement_ready")
+		notifyBookingEvent(ctx, &booking, booking.OwnerID, "agreement_ready")
 	}
 
-	// Notify renter about booking status change via WebSocket
-	var notifyUserID primitive.ObjectID
-	var actionDesc string
-	if req.Status == "cancelled" {
-		// Notify the other party (not the canceller)
-		if booking.OwnerID == userID {
-			notifyUserID = booking.RenterID
-		} else {
-			notifyUserID = booking.OwnerID
-		}
-		actionDesc = "cancelled"
-	} else {
-		// For confirmed/rejected, notify the renter
-		notifyUserID = booking.RenterID
-		actionDesc = req.Status
+	// Notify the other party about the status change
+	notifyUserID := booking.RenterID
+	if role == RoleRenter {
+		notifyUserID = booking.OwnerID
 	}
+	notifyBookingStatus(ctx, &booking, notifyUserID)
+
+	JSON(w, http.StatusOK, map[string]interface{}{"message": "Booking updated", "status": booking.Status, "refund": booking.Refund})
+}
 
+// notifyBookingStatus tells a user about a booking's new status
+func notifyBookingStatus(ctx context.Context, booking *Booking, userID primitive.ObjectID) {
+	notifyBookingEvent(ctx, booking, userID, booking.Status)
+}
+
+// notifyBookingEvent tells a user about a booking event over the WebSocket
+// hub, and via FCM push for when they're offline
+func notifyBookingEvent(ctx context.Context, booking *Booking, userID primitive.ObjectID, action string) {
 	// Get item info for notification
 	var item Item
 	GetCollection("items").FindOne(ctx, bson.M{"_id": booking.ItemID}).Decode(&item)
 
 	notificationData, _ := json.Marshal(map[string]interface{}{
 		"type":       "booking_notification",
-		"action":     actionDesc,
+		"action":     action,
 		"bookingId":  booking.ID.Hex(),
 		"trackingId": booking.TrackingID,
 		"itemTitle":  item.Title,
-		"status":     req.Status,
+		"status":     booking.Status,
 		"timestamp":  time.Now(),
 	})
-	hub.NotifyUser(notifyUserID.Hex(), notificationData)
-
-	// Also send FCM push notification for when user is offline
-	SendBookingPushNotification(notifyUserID, actionDesc, item.Title, booking.ID.Hex())
+	hub.NotifyUser(userID.Hex(), notificationData)
 
-	JSON(w, http.StatusOK, map[string]string{"message": "Booking updated"})
+	SendBookingPushNotification(userID, action, item.Title, booking.ID.Hex())
 }
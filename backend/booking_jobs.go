@@ -0,0 +1,89 @@
+package backend
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RegisterBookingJobs adds the periodic booking maintenance jobs to s
+func RegisterBookingJobs(s *Scheduler) {
+	interval := envDuration("BOOKING_JOB_INTERVAL", 5*time.Minute)
+
+	s.Register("expire-pending-bookings", interval, expirePendingBookings)
+	s.Register("complete-finished-rentals", interval, completeFinishedRentals)
+	s.Register("cancel-missed-handovers", interval, cancelMissedHandovers)
+	s.Register("release-unclaimed-deposits", interval, releaseUnclaimedDeposits)
+	s.Register("accept-unanswered-claims", interval, acceptUnansweredClaims)
+	s.Register("retry-pending-refunds", interval, retryPendingRefunds)
+	s.Register("expire-unpaid-instant-bookings", interval, expireUnpaidInstantBookings)
+	s.Register("reject-unanswered-requests", interval, rejectUnansweredRequests)
+	s.Register("renew-subscriptions", interval, renewSubscriptions)
+	s.Register("end-subscriptions", interval, endSubscriptions)
+	s.Register("check-overdue-rentals", envDuration("OVERDUE_CHECK_INTERVAL", 15*time.Minute), checkOverdueRentals)
+}
+
+// expirePendingBookings moves pending requests whose start date has passed to expired
+func expirePendingBookings(ctx context.Context) error {
+	return transitionMatching(ctx,
+		bson.M{"status": StatusPending, "startDate": bson.M{"$lt": time.Now()}},
+		StatusExpired, "Start date passed before the request was confirmed",
+	)
+}
+
+// completeFinishedRentals moves returned bookings whose end date has passed
+// to completed. Ones still owing a late fee wait until it is paid.
+func completeFinishedRentals(ctx context.Context) error {
+	return transitionMatching(ctx,
+		bson.M{"status": StatusReturned, "paymentStatus": PaymentPaid, "endDate": bson.M{"$lt": time.Now()}},
+		StatusCompleted, "Rental period ended",
+	)
+}
+
+// cancelMissedHandovers cancels confirmed bookings that reach their end date
+// without a handover being recorded. Without one there is no telling whether
+// the renter or the owner didn't turn up, so, like other cancellations by the
+// system, the renter is refunded in full.
+func cancelMissedHandovers(ctx context.Context) error {
+	return transitionMatching(ctx,
+		bson.M{"status": StatusConfirmed, "endDate": bson.M{"$lt": time.Now()}},
+		StatusCancelled, "No handover was recorded before the end date",
+	)
+}
+
+// transitionMatching applies a system transition to every booking matching
+// filter and notifies both parties of each change
+func transitionMatching(ctx context.Context, filter bson.M, to, reason string) error {
+	cursor, err := GetCollection("bookings").Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var booking Booking
+		if err := cursor.Decode(&booking); err != nil {
+			log.Printf("Error decoding booking: %v", err)
+			continue
+		}
+
+		if err := transitionBooking(ctx, &booking, to, RoleSystem, primitive.NilObjectID, reason, nil); err != nil {
+			// Someone else changed it in the meantime; the next run will re-check
+			log.Printf("Could not move booking %s to %s: %v", booking.ID.Hex(), to, err)
+			continue
+		}
+
+		notifyBookingStatus(ctx, &booking, booking.RenterID)
+		notifyBookingStatus(ctx, &booking, booking.OwnerID)
+		count++
+	}
+
+	if count > 0 {
+		log.Printf("Moved %d bookings to %s", count, to)
+	}
+	return cursor.Err()
+}
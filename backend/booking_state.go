@@ -0,0 +1,196 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Booking statuses
+const (
+	StatusPending    = "pending"
+	StatusConfirmed  = "confirmed"
+	StatusHandedOver = "handed_over"
+	StatusReturned   = "returned"
+	StatusCompleted  = "completed"
+	StatusRejected   = "rejected"
+	StatusCancelled  = "cancelled"
+	StatusExpired    = "expired"
+)
+
+// Roles that may trigger a booking status change
+const (
+	RoleOwner  = "owner"
+	RoleRenter = "renter"
+	RoleSystem = "system"
+)
+
+// bookingTransitions is the booking state machine: for each status, the
+// statuses it may move to and the roles allowed to make that move.
+//
+//	pending → confirmed → handed_over → returned → completed
+//	pending → rejected (owner, or system after the response window) | cancelled | expired
+//	confirmed → cancelled (system, when never handed over before the end date)
+var bookingTransitions = map[string]map[string][]string{
+	StatusPending: {
+		StatusConfirmed: {RoleOwner, RoleSystem}, // system: instant book
+		StatusRejected:  {RoleOwner, RoleSystem}, // system: no response in time
+		StatusCancelled: {RoleOwner, RoleRenter},
+		StatusExpired:   {RoleSystem},
+	},
+	StatusConfirmed: {
+		StatusHandedOver: {RoleOwner},
+		StatusCancelled:  {RoleOwner, RoleRenter, RoleSystem}, // system: no handover
+	},
+	StatusHandedOver: {
+		StatusReturned: {RoleOwner},
+	},
+	StatusReturned: {
+		StatusCompleted: {RoleOwner, RoleSystem},
+	},
+}
+
+// transitionError is returned when a status change is rejected by the state machine
+type transitionError struct {
+	Code    int
+	Message string
+}
+
+func (e *transitionError) Error() string {
+	return e.Message
+}
+
+// isBookingStatus reports whether status is a known booking status
+func isBookingStatus(status string) bool {
+	switch status {
+	case StatusPending, StatusConfirmed, StatusHandedOver, StatusReturned,
+		StatusCompleted, StatusRejected, StatusCancelled, StatusExpired:
+		return true
+	}
+	return false
+}
+
+// bookingRole returns the role userID plays on a booking, or "" if none
+func bookingRole(booking *Booking, userID primitive.ObjectID) string {
+	switch userID {
+	case booking.OwnerID:
+		return RoleOwner
+	case booking.RenterID:
+		return RoleRenter
+	}
+	return ""
+}
+
+// checkTransition validates a status change against the state machine
+func checkTransition(from, to, role string) error {
+	roles, ok := bookingTransitions[from][to]
+	if !ok {
+		return &transitionError{
+			Code:    http.StatusConflict,
+			Message: fmt.Sprintf("Cannot change a %s booking to %s", from, to),
+		}
+	}
+	for _, r := range roles {
+		if r == role {
+			return nil
+		}
+	}
+	return &transitionError{
+		Code:    http.StatusForbidden,
+		Message: fmt.Sprintf("Only the %s can mark this booking as %s", roles[0], to),
+	}
+}
+
+// transitionBooking moves a booking to a new status and appends the change to
+// its statusHistory. The update only applies if the booking is still in the
+// status it was read with, so concurrent changes can't both succeed. Any
+// fields in extra are set in the same update. Paid bookings that end early
+// are refunded, see refundForTransition.
+func transitionBooking(ctx context.Context, booking *Booking, to, role string, actorID primitive.ObjectID, reason string, extra bson.M) error {
+	if err := checkTransition(booking.Status, to, role); err != nil {
+		return err
+	}
+	if (to == StatusConfirmed || to == StatusHandedOver) && booking.PaymentStatus != PaymentPaid {
+		return &transitionError{
+			Code:    http.StatusConflict,
+			Message: "Booking must be paid before it can be marked as " + to,
+		}
+	}
+
+	now := time.Now()
+	change := StatusChange{
+		From:   booking.Status,
+		To:     to,
+		Role:   role,
+		Reason: reason,
+		At:     now,
+	}
+	if !actorID.IsZero() {
+		change.By = &actorID
+	}
+
+	set := bson.M{"status": to, "updatedAt": now}
+	for k, v := range depositTransitionFields(booking, to, now) {
+		set[k] = v
+	}
+	for k, v := range handoverTransitionFields(booking, to) {
+		set[k] = v
+	}
+	for k, v := range responseTransitionFields(booking, to, role, now) {
+		set[k] = v
+	}
+	refund := refundForTransition(booking, to, role, now)
+	if refund != nil {
+		set["refund"] = refund
+		set["paymentStatus"] = refundPaymentStatus(booking, refund)
+	}
+	for k, v := range extra {
+		set[k] = v
+	}
+
+	result, err := GetCollection("bookings").UpdateOne(ctx,
+		bson.M{"_id": booking.ID, "status": booking.Status},
+		bson.M{"$set": set, "$push": bson.M{"statusHistory": change}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return &transitionError{
+			Code:    http.StatusConflict,
+			Message: "Booking status has changed, please refresh",
+		}
+	}
+
+	booking.Status = to
+	booking.StatusHistory = append(booking.StatusHistory, change)
+	booking.UpdatedAt = now
+	if booking.Deposit != nil {
+		if status, ok := set["deposit.status"].(string); ok {
+			booking.Deposit.Status = status
+		}
+	}
+	if pickup, ok := set["pickup"].(HandoverStep); ok {
+		booking.Pickup = &pickup
+	}
+	if ret, ok := set["return"].(HandoverStep); ok {
+		booking.Return = &ret
+	}
+	if response, ok := set["ownerResponse"].(OwnerResponse); ok {
+		booking.OwnerResponse = &response
+	}
+	if refund != nil {
+		booking.Refund = refund
+		booking.PaymentStatus = set["paymentStatus"].(string)
+		// A failed refund is retried by the scheduler
+		issueRefund(ctx, booking)
+	}
+	if booking.SubscriptionID != nil {
+		subscriptionBookingChanged(ctx, booking, to)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package backend
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestCheckTransition(t *testing.T) {
+	tests := []struct {
+		from, to, role string
+		wantCode       int // 0 when allowed
+	}{
+		{StatusPending, StatusConfirmed, RoleOwner, 0},
+		{StatusPending, StatusConfirmed, RoleSystem, 0},
+		{StatusPending, StatusConfirmed, RoleRenter, http.StatusForbidden},
+		{StatusPending, StatusRejected, RoleOwner, 0},
+		{StatusPending, StatusRejected, RoleRenter, http.StatusForbidden},
+		{StatusPending, StatusCancelled, RoleRenter, 0},
+		{StatusPending, StatusCancelled, RoleOwner, 0},
+		{StatusPending, StatusExpired, RoleSystem, 0},
+		{StatusPending, StatusExpired, RoleOwner, http.StatusForbidden},
+		{StatusPending, StatusHandedOver, RoleOwner, http.StatusConflict},
+		{StatusConfirmed, StatusHandedOver, RoleOwner, 0},
+		{StatusConfirmed, StatusHandedOver, RoleRenter, http.StatusForbidden},
+		{StatusConfirmed, StatusCancelled, RoleRenter, 0},
+		{StatusConfirmed, StatusCancelled, RoleSystem, 0},
+		{StatusConfirmed, StatusCompleted, RoleSystem, http.StatusConflict},
+		{StatusConfirmed, StatusReturned, RoleOwner, http.StatusConflict},
+		{StatusHandedOver, StatusReturned, RoleOwner, 0},
+		{StatusHandedOver, StatusReturned, RoleRenter, http.StatusForbidden},
+		{StatusHandedOver, StatusCancelled, RoleRenter, http.StatusConflict},
+		{StatusReturned, StatusCompleted, RoleOwner, 0},
+		{StatusReturned, StatusCompleted, RoleSystem, 0},
+		{StatusReturned, StatusCompleted, RoleRenter, http.StatusForbidden},
+		{StatusCompleted, StatusPending, RoleSystem, http.StatusConflict},
+		{StatusCancelled, StatusConfirmed, RoleOwner, http.StatusConflict},
+		{StatusRejected, StatusPending, RoleRenter, http.StatusConflict},
+		{"unknown", StatusConfirmed, RoleOwner, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to+" by "+tt.role, func(t *testing.T) {
+			err := checkTransition(tt.from, tt.to, tt.role)
+			if tt.wantCode == 0 {
+				if err != nil {
+					t.Errorf("checkTransition() error = %v, want nil", err)
+				}
+				return
+			}
+			var te *transitionError
+			if !errors.As(err, &te) {
+				t.Fatalf("checkTransition() error = %v, want a transitionError", err)
+			}
+			if te.Code != tt.wantCode {
+				t.Errorf("checkTransition() code = %d, want %d", te.Code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package backend
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of blocked range reported alongside booked ones
+const (
+	BlockBlackout = "blackout"
+	BlockWeekday  = "unavailable_weekday"
+)
+
+// maxBufferHours caps the gap an owner can require between rentals
+const maxBufferHours = 72
+
+// buffer is the gap the owner keeps free before and after each rental
+func (c *AvailabilityCalendar) buffer() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return time.Duration(c.BufferHours) * time.Hour
+}
+
+// calendarBlocks returns the ranges in [from, to) the owner has blocked:
+// blackouts, and whole days falling on an unavailable weekday
+func calendarBlocks(c *AvailabilityCalendar, from, to time.Time) []DateRange {
+	blocks := []DateRange{}
+	if c == nil {
+		return blocks
+	}
+
+	for _, b := range c.Blackouts {
+		if b.Start.Before(to) && b.End.After(from) {
+			blocks = append(blocks, DateRange{Start: b.Start, End: b.End, Status: BlockBlackout})
+		}
+	}
+
+	if len(c.UnavailableWeekdays) > 0 {
+		blocked := make(map[time.Weekday]bool)
+		for _, d := range c.UnavailableWeekdays {
+			blocked[time.Weekday(d)] = true
+		}
+		for day := startOfDay(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+			if blocked[day.Weekday()] {
+				blocks = append(blocks, DateRange{Start: day, End: day.AddDate(0, 0, 1), Status: BlockWeekday})
+			}
+		}
+	}
+	return blocks
+}
+
+// startOfDay is midnight at the start of t's day in rentalLocation, so an
+// unavailable Sunday is the owner's Sunday whatever offset the client sent
+func startOfDay(t time.Time) time.Time {
+	t = t.In(rentalLocation())
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// weekdaysIn returns the weekdays that [from, to) touches
+func weekdaysIn(from, to time.Time) []int {
+	var days []int
+	for day := startOfDay(from); day.Before(to) && len(days) < 7; day = day.AddDate(0, 0, 1) {
+		days = append(days, int(day.Weekday()))
+	}
+	return days
+}
+
+// checkAvailability returns everything that stops quantity units of item
+// being booked for [start, end): blocked calendar ranges, and active bookings
+// within the owner's buffer time of the range if they leave too few units
+// free. excludeID is skipped, as in findConflicts.
+func checkAvailability(ctx context.Context, item *Item, start, end time.Time, excludeID primitive.ObjectID, quantity int) ([]DateRange, error) {
+	conflicts := calendarBlocks(item.Calendar, start, end)
+
+	buffer := item.Calendar.buffer()
+	booked, err := findConflicts(ctx, item.ID, start.Add(-buffer), end.Add(buffer), excludeID)
+	if err != nil {
+		return nil, err
+	}
+
+	held := make([]DateRange, 0, len(booked))
+	for _, b := range booked {
+		held = append(held, DateRange{Start: b.Start.Add(-buffer), End: b.End.Add(buffer), Quantity: b.Quantity})
+	}
+	if peakUnits(held, start, end)+quantity > itemQuantity(item) {
+		conflicts = append(conflicts, booked...)
+	}
+	return conflicts, nil
+}
+
+// calendarSearchFilter matches items whose calendar leaves [from, to) open.
+// Buffer times are only checked when booking.
+func calendarSearchFilter(from, to time.Time) bson.M {
+	return bson.M{
+		"calendar.blackouts": bson.M{"$not": bson.M{"$elemMatch": bson.M{
+			"start": bson.M{"$lt": to},
+			"end":   bson.M{"$gt": from},
+		}}},
+		"calendar.unavailableWeekdays": bson.M{"$nin": weekdaysIn(from, to)},
+	}
+}
+
+// handleItemCalendar serves /api/items/{id}/calendar and its blackouts
+func handleItemCalendar(w http.ResponseWriter, r *http.Request, id, sub string) {
+	switch {
+	case sub == "" && r.Method == http.MethodGet:
+		getItemCalendar(w, r, id)
+	case sub == "" && r.Method == http.MethodPut:
+		AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			updateItemCalendar(w, r, id)
+		})(w, r)
+	case sub == "blackouts" && r.Method == http.MethodPost:
+		AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			addBlackout(w, r, id)
+		})(w, r)
+	case strings.HasPrefix(sub, "blackouts/") && r.Method == http.MethodDelete:
+		AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			removeBlackout(w, r, id, strings.TrimPrefix(sub, "blackouts/"))
+		})(w, r)
+	case sub == "" || sub == "blackouts" || strings.HasPrefix(sub, "blackouts/"):
+		JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		JSONError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// findOwnItem loads an item and checks userID owns it. It writes the error
+// response itself and returns nil if not.
+func findOwnItem(ctx context.Context, w http.ResponseWriter, id string, userID primitive.ObjectID) *Item {
+	itemID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid item ID")
+		return nil
+	}
+
+	var item Item
+	if err := GetCollection("items").FindOne(ctx, bson.M{"_id": itemID}).Decode(&item); err != nil {
+		JSONError(w, http.StatusNotFound, "Item not found")
+		return nil
+	}
+	if item.OwnerID != userID {
+		JSONError(w, http.StatusForbidden, "Access denied")
+		return nil
+	}
+	return &item
+}
+
+func getItemCalendar(w http.ResponseWriter, r *http.Request, id string) {
+	itemID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid item ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var item Item
+	if err := GetCollection("items").FindOne(ctx, bson.M{"_id": itemID}).Decode(&item); err != nil {
+		JSONError(w, http.StatusNotFound, "Item not found")
+		return
+	}
+
+	calendar := item.Calendar
+	if calendar == nil {
+		calendar = &AvailabilityCalendar{}
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{"calendar": calendar})
+}
+
+// updateItemCalendar sets the recurring rules of an item's calendar
+func updateItemCalendar(w http.ResponseWriter, r *http.Request, id string) {
+	userID, _ := GetUserID(r)
+
+	var req struct {
+		UnavailableWeekdays []int `json:"unavailableWeekdays"`
+		BufferHours         int   `json:"bufferHours"`
+	}
+	if err := DecodeJSON(r, &req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	for _, d := range req.UnavailableWeekdays {
+		if d < 0 || d > 6 {
+			JSONError(w, http.StatusBadRequest, "Weekdays must be between 0 (Sunday) and 6 (Saturday)")
+			return
+		}
+	}
+	if len(req.UnavailableWeekdays) == 7 {
+		JSONError(w, http.StatusBadRequest, "At least one weekday must stay available")
+		return
+	}
+	if req.BufferHours < 0 || req.BufferHours > maxBufferHours {
+		JSONError(w, http.StatusBadRequest, "Buffer time must be between 0 and 72 hours")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	item := findOwnItem(ctx, w, id, userID)
+	if item == nil {
+		return
+	}
+
+	if req.UnavailableWeekdays == nil {
+		req.UnavailableWeekdays = []int{}
+	}
+	_, err := GetCollection("items").UpdateOne(ctx, bson.M{"_id": item.ID}, bson.M{"$set": bson.M{
+		"calendar.unavailableWeekdays": req.UnavailableWeekdays,
+		"calendar.bufferHours":         req.BufferHours,
+		"updatedAt":                    time.Now(),
+	}})
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to update calendar")
+		return
+	}
+
+	GetCollection("items").FindOne(ctx, bson.M{"_id": item.ID}).Decode(item)
+	JSON(w, http.StatusOK, map[string]interface{}{"message": "Calendar updated", "calendar": item.Calendar})
+}
+
+// addBlackout blocks a range of an item's calendar. Ranges that overlap an
+// active booking are refused; the owner has to cancel the booking first.
+func addBlackout(w http.ResponseWriter, r *http.Request, id string) {
+	userID, _ := GetUserID(r)
+
+	var req struct {
+		Start string `json:"start"`
+		End   string `json:"end"`
+		Note  string `json:"note"`
+	}
+	if err := DecodeJSON(r, &req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	start, err := parseDateParam(req.Start)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid start date")
+		return
+	}
+	end, err := parseDateParam(req.End)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid end date")
+		return
+	}
+	if !end.After(start) {
+		JSONError(w, http.StatusBadRequest, "End date must be after start date")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	item := findOwnItem(ctx, w, id, userID)
+	if item == nil {
+		return
+	}
+
+	// Hold the item lock so a booking can't slip in between the check and the update
+	release, err := lockItem(ctx, item.ID)
+	if err != nil {
+		JSONError(w, http.StatusConflict, "Item is being booked by someone else, please retry")
+		return
+	}
+	defer release()
+
+	conflicts, err := findConflicts(ctx, item.ID, start, end, primitive.NilObjectID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to check availability")
+		return
+	}
+	if len(conflicts) > 0 {
+		JSON(w, http.StatusConflict, map[string]interface{}{
+			"error":     "The item is booked during this period",
+			"conflicts": conflicts,
+		})
+		return
+	}
+
+	blackout := Blackout{ID: primitive.NewObjectID(), Start: start, End: end, Note: req.Note}
+	_, err = GetCollection("items").UpdateOne(ctx, bson.M{"_id": item.ID}, bson.M{
+		"$push": bson.M{"calendar.blackouts": blackout},
+		"$set":  bson.M{"updatedAt": time.Now()},
+	})
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to add blackout")
+		return
+	}
+
+	JSON(w, http.StatusCreated, map[string]interface{}{"message": "Dates blocked", "blackout": blackout})
+}
+
+func removeBlackout(w http.ResponseWriter, r *http.Request, id, blackoutID string) {
+	userID, _ := GetUserID(r)
+
+	oid, err := primitive.ObjectIDFromHex(blackoutID)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid blackout ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	item := findOwnItem(ctx, w, id, userID)
+	if item == nil {
+		return
+	}
+
+	result, err := GetCollection("items").UpdateOne(ctx,
+		bson.M{"_id": item.ID, "calendar.blackouts._id": oid},
+		bson.M{"$pull": bson.M{"calendar.blackouts": bson.M{"_id": oid}}, "$set": bson.M{"updatedAt": time.Now()}},
+	)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to remove blackout")
+		return
+	}
+	if result.MatchedCount == 0 {
+		JSONError(w, http.StatusNotFound, "Blackout not found")
+		return
+	}
+
+	JSON(w, http.StatusOK, map[string]string{"message": "Blackout removed"})
+}
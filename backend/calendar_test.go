@@ -0,0 +1,105 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWeekdaysIn(t *testing.T) {
+	t.Setenv("TIME_ZONE", "Asia/Kolkata")
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+	// Saturday 1 March 2025
+	sat := time.Date(2025, 3, 1, 10, 0, 0, 0, ist)
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []int
+	}{
+		{"within a day", sat, sat.Add(2 * time.Hour), []int{6}},
+		{"over midnight", sat, sat.Add(20 * time.Hour), []int{6, 0}},
+		{"a whole week", sat, sat.AddDate(0, 0, 10), []int{6, 0, 1, 2, 3, 4, 5}},
+		// 20:00 UTC on Saturday is already Sunday in India
+		{"sent as UTC", time.Date(2025, 3, 1, 20, 0, 0, 0, time.UTC), time.Date(2025, 3, 1, 22, 0, 0, 0, time.UTC), []int{0}},
+		{"sent as UTC over the Indian midnight", time.Date(2025, 3, 1, 18, 0, 0, 0, time.UTC), time.Date(2025, 3, 1, 19, 0, 0, 0, time.UTC), []int{6, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := weekdaysIn(tt.from, tt.to); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("weekdaysIn() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalendarBlocks(t *testing.T) {
+	t.Setenv("TIME_ZONE", "Asia/Kolkata")
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, ist) }
+	sundays := &AvailabilityCalendar{UnavailableWeekdays: []int{0}}
+	blackout := &AvailabilityCalendar{Blackouts: []Blackout{{Start: day(4), End: day(6)}}}
+
+	tests := []struct {
+		name     string
+		calendar *AvailabilityCalendar
+		from, to time.Time
+		want     []DateRange
+	}{
+		{"no calendar", nil, day(1), day(10), []DateRange{}},
+		{"blackout inside", blackout, day(1), day(10), []DateRange{{Start: day(4), End: day(6), Status: BlockBlackout}}},
+		{"blackout outside", blackout, day(6), day(10), []DateRange{}},
+		{
+			name: "every sunday", calendar: sundays, from: day(1), to: day(10),
+			want: []DateRange{{Start: day(2), End: day(3), Status: BlockWeekday}, {Start: day(9), End: day(10), Status: BlockWeekday}},
+		},
+		{
+			name: "sunday in India asked for in UTC", calendar: sundays,
+			from: time.Date(2025, 3, 1, 20, 0, 0, 0, time.UTC), to: time.Date(2025, 3, 1, 22, 0, 0, 0, time.UTC),
+			want: []DateRange{{Start: day(2), End: day(3), Status: BlockWeekday}},
+		},
+		{
+			name: "saturday in India asked for in UTC", calendar: sundays,
+			from: time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC), to: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+			want: []DateRange{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := calendarBlocks(tt.calendar, tt.from, tt.to)
+			if len(got) != len(tt.want) {
+				t.Fatalf("calendarBlocks() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Start.Equal(tt.want[i].Start) || !got[i].End.Equal(tt.want[i].End) || got[i].Status != tt.want[i].Status {
+					t.Errorf("calendarBlocks()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseDateParam(t *testing.T) {
+	t.Setenv("TIME_ZONE", "Asia/Kolkata")
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "2025-03-02T10:00:00Z", want: time.Date(2025, 3, 2, 10, 0, 0, 0, time.UTC)},
+		{value: "2025-03-02T10:00:00+05:30", want: time.Date(2025, 3, 2, 4, 30, 0, 0, time.UTC)},
+		{value: "2025-03-02", want: time.Date(2025, 3, 1, 18, 30, 0, 0, time.UTC)},
+		{value: "tomorrow", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseDateParam(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDateParam() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("parseDateParam() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
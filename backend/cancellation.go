@@ -0,0 +1,201 @@
+package backend
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Cancellation policies an owner can choose for an item
+const (
+	PolicyFlexible = "flexible"
+	PolicyModerate = "moderate"
+	PolicyStrict   = "strict"
+)
+
+// Refund statuses
+const (
+	RefundPending   = "pending" // waiting on the payment provider
+	RefundProcessed = "processed"
+)
+
+// refundTier refunds Percent of the rental when the renter cancels at least
+// Notice before the start date
+type refundTier struct {
+	Notice  time.Duration
+	Percent float64
+}
+
+// cancellationPolicies lists each policy's tiers, longest notice first. A
+// cancellation with less notice than the last tier gets no rental refund.
+var cancellationPolicies = map[string][]refundTier{
+	PolicyFlexible: {{24 * time.Hour, 100}, {0, 50}},
+	PolicyModerate: {{5 * 24 * time.Hour, 100}, {24 * time.Hour, 50}},
+	PolicyStrict:   {{7 * 24 * time.Hour, 50}},
+}
+
+func isCancellationPolicy(policy string) bool {
+	_, ok := cancellationPolicies[policy]
+	return ok
+}
+
+// refundPercent is the share of the rental a renter gets back for cancelling
+// under policy with notice left before the start date
+func refundPercent(policy string, notice time.Duration) float64 {
+	for _, t := range cancellationPolicies[policy] {
+		if notice >= t.Notice {
+			return t.Percent
+		}
+	}
+	return 0
+}
+
+// refundForTransition works out what a paid booking refunds when it moves to
+// status to. Rejected and expired requests, owner cancellations and renter
+// cancellations before the owner confirmed are refunded in full. Renters
+// cancelling a confirmed booking get the rental back according to the
+// booking's policy. An unused deposit is always returned. Returns nil if
+// nothing was paid or the status change doesn't end the booking.
+func refundForTransition(booking *Booking, to, role string, now time.Time) *Refund {
+	// Bookings waiting on the difference of an extension still refund what was paid
+	if booking.Payment == nil || booking.Payment.AmountPaid <= 0 {
+		return nil
+	}
+	switch to {
+	case StatusRejected, StatusExpired, StatusCancelled:
+	default:
+		return nil
+	}
+
+	paid := booking.Payment.AmountPaid
+	deposit := 0.0
+	if booking.Deposit != nil {
+		deposit = booking.Deposit.Amount
+	}
+	rental := roundMoney(paid - deposit)
+
+	// Bookings made before items had a policy are treated as flexible
+	policy := booking.CancellationPolicy
+	if !isCancellationPolicy(policy) {
+		policy = PolicyFlexible
+	}
+
+	refund := &Refund{Policy: policy, Percent: 100, CreatedAt: now}
+	if to == StatusCancelled && role == RoleRenter && booking.Status == StatusConfirmed {
+		refund.Percent = refundPercent(policy, booking.StartDate.Sub(now))
+	}
+
+	refund.RentalAmount = roundMoney(rental * refund.Percent / 100)
+	refund.DepositAmount = deposit
+	refund.Amount = roundMoney(refund.RentalAmount + refund.DepositAmount)
+	if refund.Amount > 0 {
+		refund.Status = RefundPending
+	} else {
+		refund.Status = RefundProcessed
+	}
+	return refund
+}
+
+// refundPaymentStatus is the paymentStatus of a booking after refund
+func refundPaymentStatus(booking *Booking, refund *Refund) string {
+	switch {
+	case refund.Amount <= 0:
+		return booking.PaymentStatus
+	case refund.Amount >= booking.Payment.AmountPaid:
+		return PaymentRefunded
+	default:
+		return PaymentPartiallyRefunded
+	}
+}
+
+// issueRefund sends a booking's pending refund to the payment provider. On
+// failure the refund stays pending and retryPendingRefunds picks it up.
+func issueRefund(ctx context.Context, booking *Booking) error {
+	refund := booking.Refund
+	if refund == nil || refund.Status != RefundPending {
+		return nil
+	}
+
+	parts, err := refundCaptures(ctx, booking, refund.Amount, false, refund.Parts, "refund.parts", nil)
+	refund.Parts = parts
+	if err != nil {
+		log.Printf("Error refunding booking %s: %v", booking.ID.Hex(), err)
+		return err
+	}
+	refundID := lastRefundID(parts)
+
+	now := time.Now()
+	_, err = GetCollection("bookings").UpdateOne(ctx,
+		bson.M{"_id": booking.ID, "refund.status": RefundPending},
+		bson.M{"$set": bson.M{
+			"refund.status":      RefundProcessed,
+			"refund.refundId":    refundID,
+			"refund.processedAt": now,
+			"updatedAt":          now,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+
+	refund.Status = RefundProcessed
+	refund.RefundID = refundID
+	refund.ProcessedAt = &now
+	notifyBookingEvent(ctx, booking, booking.RenterID, "refund_processed")
+	return nil
+}
+
+// retryPendingRefunds re-sends refunds the provider failed to process
+func retryPendingRefunds(ctx context.Context) error {
+	cursor, err := GetCollection("bookings").Find(ctx, bson.M{"$or": []bson.M{
+		{"refund.status": RefundPending},
+		{"modifications.refundStatus": RefundPending},
+		{"deposit.refundStatus": RefundPending},
+	}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var booking Booking
+		if err := cursor.Decode(&booking); err != nil {
+			continue
+		}
+		issueRefund(ctx, &booking)
+		issueModificationRefunds(ctx, &booking)
+		issueDepositRefund(ctx, &booking)
+	}
+	return cursor.Err()
+}
+
+// ownerReliabilityScore is the percentage of an owner's confirmed bookings
+// they went through with rather than cancelling. Returns nil for owners with
+// no history yet.
+func ownerReliabilityScore(ctx context.Context, ownerID primitive.ObjectID) *float64 {
+	cancelled, err := GetCollection("bookings").CountDocuments(ctx, bson.M{
+		"ownerId": ownerID,
+		"statusHistory": bson.M{"$elemMatch": bson.M{
+			"from": StatusConfirmed,
+			"to":   StatusCancelled,
+			"role": RoleOwner,
+		}},
+	})
+	if err != nil {
+		return nil
+	}
+	fulfilled, err := GetCollection("bookings").CountDocuments(ctx, bson.M{
+		"ownerId": ownerID,
+		"status":  bson.M{"$in": []string{StatusHandedOver, StatusReturned, StatusCompleted}},
+	})
+	if err != nil || cancelled+fulfilled == 0 {
+		return nil
+	}
+
+	score := math.Round(float64(fulfilled)/float64(cancelled+fulfilled)*1000) / 10
+	return &score
+}
@@ -0,0 +1,165 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefundPercent(t *testing.T) {
+	const day = 24 * time.Hour
+	tests := []struct {
+		policy string
+		notice time.Duration
+		want   float64
+	}{
+		{PolicyFlexible, 3 * day, 100},
+		{PolicyFlexible, day, 100},
+		{PolicyFlexible, day - time.Minute, 50},
+		{PolicyFlexible, 0, 50},
+		{PolicyFlexible, -time.Hour, 0},
+		{PolicyModerate, 5 * day, 100},
+		{PolicyModerate, 5*day - time.Minute, 50},
+		{PolicyModerate, day, 50},
+		{PolicyModerate, day - time.Minute, 0},
+		{PolicyStrict, 30 * day, 50},
+		{PolicyStrict, 7 * day, 50},
+		{PolicyStrict, 7*day - time.Minute, 0},
+		{"unknown", 30 * day, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy+" "+tt.notice.String(), func(t *testing.T) {
+			if got := refundPercent(tt.policy, tt.notice); got != tt.want {
+				t.Errorf("refundPercent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefundForTransition(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	paid := func(status, policy string, startIn time.Duration, amountPaid, deposit float64) *Booking {
+		b := &Booking{
+			Status:             status,
+			CancellationPolicy: policy,
+			StartDate:          now.Add(startIn),
+			Payment:            &PaymentInfo{AmountPaid: amountPaid},
+		}
+		if deposit > 0 {
+			b.Deposit = &Deposit{Amount: deposit, Status: DepositHeld}
+		}
+		return b
+	}
+
+	tests := []struct {
+		name        string
+		booking     *Booking
+		to, role    string
+		wantNil     bool
+		wantPercent float64
+		wantRental  float64
+		wantDeposit float64
+		wantStatus  string
+	}{
+		{
+			name:    "unpaid",
+			booking: &Booking{Status: StatusPending},
+			to:      StatusCancelled, role: RoleRenter,
+			wantNil: true,
+		},
+		{
+			name:    "not ending",
+			booking: paid(StatusPending, PolicyStrict, 48*time.Hour, 1000, 0),
+			to:      StatusConfirmed, role: RoleOwner,
+			wantNil: true,
+		},
+		{
+			name:    "rejected",
+			booking: paid(StatusPending, PolicyStrict, time.Hour, 1500, 500),
+			to:      StatusRejected, role: RoleOwner,
+			wantPercent: 100, wantRental: 1000, wantDeposit: 500, wantStatus: RefundPending,
+		},
+		{
+			name:    "expired",
+			booking: paid(StatusPending, PolicyStrict, time.Hour, 1000, 0),
+			to:      StatusExpired, role: RoleSystem,
+			wantPercent: 100, wantRental: 1000, wantStatus: RefundPending,
+		},
+		{
+			name:    "renter cancels before confirmation",
+			booking: paid(StatusPending, PolicyStrict, time.Hour, 1000, 0),
+			to:      StatusCancelled, role: RoleRenter,
+			wantPercent: 100, wantRental: 1000, wantStatus: RefundPending,
+		},
+		{
+			name:    "owner cancels a confirmed booking",
+			booking: paid(StatusConfirmed, PolicyStrict, time.Hour, 1000, 0),
+			to:      StatusCancelled, role: RoleOwner,
+			wantPercent: 100, wantRental: 1000, wantStatus: RefundPending,
+		},
+		{
+			name:    "never handed over by the end date",
+			booking: paid(StatusConfirmed, PolicyStrict, -72*time.Hour, 1500, 500),
+			to:      StatusCancelled, role: RoleSystem,
+			wantPercent: 100, wantRental: 1000, wantDeposit: 500, wantStatus: RefundPending,
+		},
+		{
+			name:    "renter cancels a confirmed booking with enough notice",
+			booking: paid(StatusConfirmed, PolicyModerate, 6*24*time.Hour, 1500, 500),
+			to:      StatusCancelled, role: RoleRenter,
+			wantPercent: 100, wantRental: 1000, wantDeposit: 500, wantStatus: RefundPending,
+		},
+		{
+			name:    "renter cancels a confirmed booking late",
+			booking: paid(StatusConfirmed, PolicyModerate, 48*time.Hour, 1500, 500),
+			to:      StatusCancelled, role: RoleRenter,
+			wantPercent: 50, wantRental: 500, wantDeposit: 500, wantStatus: RefundPending,
+		},
+		{
+			name:    "renter cancels a strict booking too late, keeping the deposit refund",
+			booking: paid(StatusConfirmed, PolicyStrict, 48*time.Hour, 1500, 500),
+			to:      StatusCancelled, role: RoleRenter,
+			wantPercent: 0, wantRental: 0, wantDeposit: 500, wantStatus: RefundPending,
+		},
+		{
+			name:    "nothing left to refund",
+			booking: paid(StatusConfirmed, PolicyStrict, time.Hour, 1000, 0),
+			to:      StatusCancelled, role: RoleRenter,
+			wantPercent: 0, wantStatus: RefundProcessed,
+		},
+		{
+			name:    "bookings without a policy are flexible",
+			booking: paid(StatusConfirmed, "", 12*time.Hour, 1000, 0),
+			to:      StatusCancelled, role: RoleRenter,
+			wantPercent: 50, wantRental: 500, wantStatus: RefundPending,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refund := refundForTransition(tt.booking, tt.to, tt.role, now)
+			if tt.wantNil {
+				if refund != nil {
+					t.Errorf("refundForTransition() = %+v, want nil", refund)
+				}
+				return
+			}
+			if refund == nil {
+				t.Fatal("refundForTransition() = nil, want a refund")
+			}
+			if refund.Percent != tt.wantPercent {
+				t.Errorf("percent = %v, want %v", refund.Percent, tt.wantPercent)
+			}
+			if refund.RentalAmount != tt.wantRental {
+				t.Errorf("rental amount = %v, want %v", refund.RentalAmount, tt.wantRental)
+			}
+			if refund.DepositAmount != tt.wantDeposit {
+				t.Errorf("deposit amount = %v, want %v", refund.DepositAmount, tt.wantDeposit)
+			}
+			if want := tt.wantRental + tt.wantDeposit; refund.Amount != want {
+				t.Errorf("amount = %v, want %v", refund.Amount, want)
+			}
+			if refund.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", refund.Status, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxCartItems caps how many items can be checked out together
+const maxCartItems = 20
+
+// HandleCart serves /api/cart and its sub-routes:
+//
+//	GET    /api/cart             the cart, priced
+//	DELETE /api/cart             empty it
+//	POST   /api/cart/items       add an item
+//	DELETE /api/cart/items/{id}  remove one
+//	POST   /api/cart/checkout    book everything in one order
+func HandleCart(w http.ResponseWriter, r *http.Request) {
+	sub := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/cart"), "/")
+	switch {
+	case sub == "" && r.Method == http.MethodGet:
+		getCart(w, r)
+	case sub == "" && r.Method == http.MethodDelete:
+		clearCart(w, r)
+	case sub == "items" && r.Method == http.MethodPost:
+		addCartItem(w, r)
+	case strings.HasPrefix(sub, "items/") && r.Method == http.MethodDelete:
+		removeCartItem(w, r, strings.TrimPrefix(sub, "items/"))
+	case sub == "checkout" && r.Method == http.MethodPost:
+		checkoutCart(w, r)
+	case sub == "" || sub == "items" || sub == "checkout" || strings.HasPrefix(sub, "items/"):
+		JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		JSONError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// loadCart returns the user's cart, which is empty if they never had one
+func loadCart(ctx context.Context, userID primitive.ObjectID) (*Cart, error) {
+	cart := &Cart{UserID: userID, Items: []CartItem{}}
+	err := GetCollection("carts").FindOne(ctx, bson.M{"_id": userID}).Decode(cart)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	return cart, nil
+}
+
+// priceCart attaches each line's item and quote, and notes lines that can't
+// be booked. Returns the cart's total and deposit.
+func priceCart(ctx context.Context, cart *Cart) (float64, float64) {
+	total, deposit := 0.0, 0.0
+	for i := range cart.Items {
+		line := &cart.Items[i]
+		var item Item
+		if err := GetCollection("items").FindOne(ctx, bson.M{"_id": line.ItemID}).Decode(&item); err != nil {
+			line.Error = "Item is no longer listed"
+			continue
+		}
+		line.Item = &Item{
+			ID: item.ID, Title: item.Title, Images: item.Images, Price: item.Price, PriceUnit: item.PriceUnit,
+			Location: item.Location, OwnerID: item.OwnerID,
+		}
+
+		quote, err := calculateQuote(&item, line.StartDate, line.EndDate, line.Quantity)
+		if err != nil {
+			line.Error = err.Error()
+			continue
+		}
+		line.Quote = quote
+		total += quote.Total
+		deposit += quote.Deposit
+	}
+	return roundMoney(total), roundMoney(deposit)
+}
+
+func getCart(w http.ResponseWriter, r *http.Request) {
+	userID, _ := GetUserID(r)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cart, err := loadCart(ctx, userID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to fetch cart")
+		return
+	}
+	total, deposit := priceCart(ctx, cart)
+
+	JSON(w, http.StatusOK, map[string]interface{}{"cart": cart, "total": total, "deposit": deposit})
+}
+
+// addCartItem adds an item for a period to the cart. The period is checked
+// against the item's pricing rules, but availability is only guaranteed at
+// checkout.
+func addCartItem(w http.ResponseWriter, r *http.Request) {
+	userID, _ := GetUserID(r)
+
+	var req struct {
+		ItemID        string `json:"itemId"`
+		StartDate     string `json:"startDate"`
+		EndDate       string `json:"endDate"`
+		Quantity      int    `json:"quantity"`
+		PickupAddress string `json:"pickupAddress"`
+		DropAddress   string `json:"dropAddress"`
+		Notes         string `json:"notes"`
+	}
+	if err := DecodeJSON(r, &req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	itemID, err := primitive.ObjectIDFromHex(req.ItemID)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid item ID")
+		return
+	}
+	startDate, endDate, err := parseBookingDates(req.StartDate, req.EndDate)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var item Item
+	if err := GetCollection("items").FindOne(ctx, bson.M{"_id": itemID}).Decode(&item); err != nil {
+		JSONError(w, http.StatusNotFound, "Item not found")
+		return
+	}
+	if item.OwnerID == userID {
+		JSONError(w, http.StatusBadRequest, "You can't rent your own item")
+		return
+	}
+	quote, err := calculateQuote(&item, startDate, endDate, req.Quantity)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	line := CartItem{
+		ID:            primitive.NewObjectID(),
+		ItemID:        itemID,
+		StartDate:     startDate,
+		EndDate:       endDate,
+		Quantity:      quote.Quantity,
+		PickupAddress: req.PickupAddress,
+		DropAddress:   req.DropAddress,
+		Notes:         req.Notes,
+	}
+
+	// The size check is part of the filter so concurrent adds can't overfill it
+	_, err = GetCollection("carts").UpdateOne(ctx,
+		bson.M{"_id": userID, "items." + strconv.Itoa(maxCartItems-1): bson.M{"$exists": false}},
+		bson.M{"$push": bson.M{"items": line}, "$set": bson.M{"updatedAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	// A full cart fails the filter, and the upsert then collides on _id
+	if mongo.IsDuplicateKeyError(err) {
+		JSONError(w, http.StatusConflict, "Your cart is full")
+		return
+	}
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to update cart")
+		return
+	}
+
+	JSON(w, http.StatusCreated, map[string]interface{}{"message": "Added to cart", "item": line})
+}
+
+func removeCartItem(w http.ResponseWriter, r *http.Request, id string) {
+	userID, _ := GetUserID(r)
+	lineID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid cart item ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := GetCollection("carts").UpdateOne(ctx,
+		bson.M{"_id": userID, "items._id": lineID},
+		bson.M{"$pull": bson.M{"items": bson.M{"_id": lineID}}, "$set": bson.M{"updatedAt": time.Now()}},
+	)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to update cart")
+		return
+	}
+	if result.MatchedCount == 0 {
+		JSONError(w, http.StatusNotFound, "Cart item not found")
+		return
+	}
+
+	JSON(w, http.StatusOK, map[string]string{"message": "Removed from cart"})
+}
+
+func clearCart(w http.ResponseWriter, r *http.Request) {
+	userID, _ := GetUserID(r)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := GetCollection("carts").DeleteOne(ctx, bson.M{"_id": userID}); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to clear cart")
+		return
+	}
+	JSON(w, http.StatusOK, map[string]string{"message": "Cart cleared"})
+}
+
+// checkoutCart books everything in the cart as one order. Every item is
+// locked and checked for availability before any booking is created, so the
+// checkout either books the whole cart or nothing.
+func checkoutCart(w http.ResponseWriter, r *http.Request) {
+	userID, _ := GetUserID(r)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cart, err := loadCart(ctx, userID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to fetch cart")
+		return
+	}
+	if len(cart.Items) == 0 {
+		JSONError(w, http.StatusBadRequest, "Your cart is empty")
+		return
+	}
+
+	items := make(map[primitive.ObjectID]*Item)
+	for i := range cart.Items {
+		line := &cart.Items[i]
+		if _, ok := items[line.ItemID]; !ok {
+			var item Item
+			if err := GetCollection("items").FindOne(ctx, bson.M{"_id": line.ItemID}).Decode(&item); err != nil {
+				cartLineError(w, http.StatusNotFound, line, "Item is no longer listed")
+				return
+			}
+			items[line.ItemID] = &item
+		}
+		// Lines can sit in the cart until their dates have passed
+		if err := validateBookingStart(line.StartDate, time.Now()); err != nil {
+			cartLineError(w, http.StatusBadRequest, line, err.Error())
+			return
+		}
+		quote, err := calculateQuote(items[line.ItemID], line.StartDate, line.EndDate, line.Quantity)
+		if err != nil {
+			cartLineError(w, http.StatusBadRequest, line, err.Error())
+			return
+		}
+		line.Quote = quote
+
+		// Lines for the same item can't be checked against each other below
+		for _, other := range cart.Items[:i] {
+			if other.ItemID == line.ItemID && other.StartDate.Before(line.EndDate) && other.EndDate.After(line.StartDate) {
+				cartLineError(w, http.StatusBadRequest, line, "Overlaps another booking of the same item in your cart, change its quantity instead")
+				return
+			}
+		}
+	}
+
+	// Lock in a fixed order so two checkouts sharing items can't deadlock
+	ids := make([]primitive.ObjectID, 0, len(items))
+	for id := range items {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Hex() < ids[j].Hex() })
+	for _, id := range ids {
+		release, err := lockItem(ctx, id)
+		if err != nil {
+			JSONError(w, http.StatusConflict, "An item in your cart is being booked by someone else, please retry")
+			return
+		}
+		defer release()
+	}
+
+	for i := range cart.Items {
+		line := &cart.Items[i]
+		conflicts, err := checkAvailability(ctx, items[line.ItemID], line.StartDate, line.EndDate, primitive.NilObjectID, line.Quote.Quantity)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to check availability")
+			return
+		}
+		if len(conflicts) > 0 {
+			JSON(w, http.StatusConflict, map[string]interface{}{
+				"error":      "An item in your cart is not available for the selected dates",
+				"cartItemId": line.ID,
+				"itemId":     line.ItemID,
+				"conflicts":  conflicts,
+			})
+			return
+		}
+	}
+
+	now := time.Now()
+	order := Order{
+		ID:            primitive.NewObjectID(),
+		RenterID:      userID,
+		PaymentStatus: PaymentPending,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	bookings := make([]Booking, 0, len(cart.Items))
+	for _, line := range cart.Items {
+		booking := newBooking(ctx, items[line.ItemID], userID, line.Quote)
+		booking.OrderID = &order.ID
+		booking.PickupAddress = line.PickupAddress
+		booking.DropAddress = line.DropAddress
+		booking.Notes = line.Notes
+		bookings = append(bookings, booking)
+
+		order.BookingIDs = append(order.BookingIDs, booking.ID)
+		order.TotalPrice += booking.TotalPrice
+		if booking.Deposit != nil {
+			order.Deposit += booking.Deposit.Amount
+		}
+	}
+	order.TotalPrice = roundMoney(order.TotalPrice)
+	order.Deposit = roundMoney(order.Deposit)
+
+	if _, err := GetCollection("orders").InsertOne(ctx, order); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to create order")
+		return
+	}
+	for i := range bookings {
+		if err := insertBooking(ctx, &bookings[i]); err != nil {
+			log.Printf("Error creating booking for order %s: %v", order.ID.Hex(), err)
+			GetCollection("bookings").DeleteMany(ctx, bson.M{"orderId": order.ID})
+			GetCollection("orders").DeleteOne(ctx, bson.M{"_id": order.ID})
+			JSONError(w, http.StatusInternalServerError, "Failed to create bookings")
+			return
+		}
+	}
+
+	GetCollection("carts").DeleteOne(ctx, bson.M{"_id": userID})
+
+	// Instant bookings are confirmed once the order is paid
+	for i := range bookings {
+		if !bookings[i].AutoConfirm {
+			notifyNewRequest(&bookings[i], items[bookings[i].ItemID])
+		}
+	}
+
+	order.Bookings = bookings
+	JSON(w, http.StatusCreated, map[string]interface{}{"message": "Order created, pay to confirm it", "order": order})
+}
+
+// cartLineError reports a cart line that stops the checkout
+func cartLineError(w http.ResponseWriter, code int, line *CartItem, message string) {
+	JSON(w, code, map[string]interface{}{
+		"error":      message,
+		"cartItemId": line.ID,
+		"itemId":     line.ItemID,
+	})
+}
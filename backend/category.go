@@ -0,0 +1,452 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Attribute types
+const (
+	AttributeText    = "text"
+	AttributeNumber  = "number"
+	AttributeInteger = "integer"
+	AttributeEnum    = "enum"
+	AttributeBoolean = "boolean"
+)
+
+// maxAttributeLength caps text attribute values
+const maxAttributeLength = 100
+
+// errCategoryLookup marks a failure to read the taxonomy, as opposed to an
+// item that doesn't fit it
+var errCategoryLookup = errors.New("failed to look up category")
+
+// categoriesFile is the JSON file the taxonomy is seeded from
+func categoriesFile() string {
+	if path := os.Getenv("CATEGORIES_FILE"); path != "" {
+		return path
+	}
+	return "data/categories.json"
+}
+
+// caseInsensitive compares names the way the app does when matching them
+var caseInsensitive = &options.Collation{Locale: "en", Strength: 2}
+
+// seedCategories adds the categories in the seed file that aren't stored
+// yet. Stored ones are left alone, so brands added in the database survive
+// restarts, unless CATEGORIES_RESEED=true, which replaces them from the file.
+func seedCategories(ctx context.Context) error {
+	data, err := os.ReadFile(categoriesFile())
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("No category seed file at %s, skipping", categoriesFile())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var categories []Category
+	if err := json.Unmarshal(data, &categories); err != nil {
+		return fmt.Errorf("%s: %w", categoriesFile(), err)
+	}
+	reseed := os.Getenv("CATEGORIES_RESEED") == "true"
+
+	collection := GetCollection("categories")
+	added := 0
+	for i := range categories {
+		c := &categories[i]
+		if err := validateCategory(c); err != nil {
+			return fmt.Errorf("category %q: %w", c.Name, err)
+		}
+		c.UpdatedAt = time.Now()
+
+		var result *mongo.UpdateResult
+		if reseed {
+			result, err = collection.ReplaceOne(ctx, bson.M{"_id": c.ID}, c, options.Replace().SetUpsert(true))
+		} else {
+			result, err = collection.UpdateOne(ctx, bson.M{"_id": c.ID}, bson.M{"$setOnInsert": c}, options.Update().SetUpsert(true))
+		}
+		if err != nil {
+			return err
+		}
+		if result.UpsertedCount > 0 {
+			added++
+		}
+	}
+	if added > 0 || reseed {
+		log.Printf("Seeded categories: %d added, %d in file", added, len(categories))
+	}
+	return nil
+}
+
+// validateCategory checks a category before it is stored
+func validateCategory(c *Category) error {
+	if c.ID == "" || c.Name == "" {
+		return errors.New("id and name are required")
+	}
+	if err := validateAttributeSchemas(c.Attributes); err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, sub := range c.SubCategories {
+		if sub.Name == "" || sub.Label == "" {
+			return errors.New("sub-categories need a name and label")
+		}
+		if seen[strings.ToLower(sub.Name)] {
+			return fmt.Errorf("sub-category %q is listed twice", sub.Name)
+		}
+		seen[strings.ToLower(sub.Name)] = true
+		for _, opt := range sub.Options {
+			if opt.Name == "" || len(opt.Options) > 0 && opt.Label == "" {
+				return fmt.Errorf("sub-category %q: options need a name, and a label if they have options", sub.Name)
+			}
+		}
+		// Sub-category attributes add to the category's
+		if err := validateAttributeSchemas(append(append([]AttributeSchema{}, c.Attributes...), sub.Attributes...)); err != nil {
+			return fmt.Errorf("sub-category %q: %w", sub.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateAttributeSchemas(schemas []AttributeSchema) error {
+	seen := map[string]bool{}
+	for _, s := range schemas {
+		if !validAttributeKey(s.Key) || s.Label == "" {
+			return fmt.Errorf("attribute %q needs a valid key and a label", s.Key)
+		}
+		if seen[strings.ToLower(s.Key)] {
+			return fmt.Errorf("attribute %q is defined twice", s.Key)
+		}
+		seen[strings.ToLower(s.Key)] = true
+
+		switch s.Type {
+		case AttributeText, AttributeBoolean:
+		case AttributeEnum:
+			if len(s.Options) == 0 {
+				return fmt.Errorf("attribute %q has no options", s.Key)
+			}
+		case AttributeNumber, AttributeInteger:
+			if s.Min != nil && s.Max != nil && *s.Min > *s.Max {
+				return fmt.Errorf("attribute %q has min above max", s.Key)
+			}
+		default:
+			return fmt.Errorf("attribute %q has unknown type %q", s.Key, s.Type)
+		}
+	}
+	return nil
+}
+
+// HandleCategories lists the category taxonomy
+func HandleCategories(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := GetCollection("categories").Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "order", Value: 1}, {Key: "name", Value: 1}}))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to fetch categories")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	categories := []Category{}
+	if err := cursor.All(ctx, &categories); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to decode categories")
+		return
+	}
+
+	JSON(w, http.StatusOK, map[string]interface{}{"categories": categories, "total": len(categories)})
+}
+
+// HandleCategoryByID gets one category by its ID
+func HandleCategoryByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/categories/")
+	if id == "" {
+		JSONError(w, http.StatusBadRequest, "Invalid category ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var category Category
+	if err := GetCollection("categories").FindOne(ctx, bson.M{"_id": id}).Decode(&category); err != nil {
+		JSONError(w, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	JSON(w, http.StatusOK, map[string]interface{}{"category": category})
+}
+
+// findCategory finds a category by name, ignoring case, or by ID
+func findCategory(ctx context.Context, name string) (*Category, error) {
+	var category Category
+	err := GetCollection("categories").FindOne(ctx,
+		bson.M{"$or": bson.A{bson.M{"name": name}, bson.M{"_id": name}}},
+		options.FindOne().SetCollation(caseInsensitive),
+	).Decode(&category)
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// validateItemTaxonomy checks an item's category, sub-category, brand,
+// model and attributes against the taxonomy, and sets them to the names as
+// the taxonomy spells them. Lookup failures wrap errCategoryLookup; other
+// errors describe what is wrong with the item. Nothing is checked while the
+// taxonomy is empty.
+func validateItemTaxonomy(ctx context.Context, item *Item) error {
+	if strings.TrimSpace(item.Category) == "" {
+		return errors.New("Category is required")
+	}
+	category, err := findCategory(ctx, strings.TrimSpace(item.Category))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		n, err := GetCollection("categories").EstimatedDocumentCount(ctx)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errCategoryLookup, err)
+		}
+		if n == 0 {
+			return nil
+		}
+		return fmt.Errorf("Unknown category: %s", item.Category)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", errCategoryLookup, err)
+	}
+	return fitTaxonomy(category, item)
+}
+
+// fitTaxonomy does the checks of validateItemTaxonomy once the category is
+// found
+func fitTaxonomy(category *Category, item *Item) error {
+	item.Category = category.Name
+
+	// The app used to send "Cars - Maruti Suzuki" as the sub-category
+	var sub *SubCategory
+	legacyOption := ""
+	for i := range category.SubCategories {
+		s := &category.SubCategories[i]
+		if strings.EqualFold(item.SubCategory, s.Name) {
+			sub = s
+			break
+		}
+		if len(item.SubCategory) > len(s.Name)+3 && strings.EqualFold(item.SubCategory[:len(s.Name)+3], s.Name+" - ") {
+			sub, legacyOption = s, item.SubCategory[len(s.Name)+3:]
+		}
+	}
+	if sub == nil {
+		if item.SubCategory == "" {
+			return errors.New("Sub-category is required")
+		}
+		return fmt.Errorf("Unknown sub-category of %s: %s", category.Name, item.SubCategory)
+	}
+	item.SubCategory = sub.Name
+
+	// The app also repeats the option and model in the attributes, under
+	// their labels
+	if item.Attributes == nil {
+		item.Attributes = map[string]string{}
+	}
+	labelled := func(label, value string) (string, error) {
+		given, ok := item.Attributes[label]
+		if !ok {
+			return value, nil
+		}
+		if value != "" && !strings.EqualFold(given, value) {
+			return "", fmt.Errorf("%s in attributes doesn't match %s", label, value)
+		}
+		return given, nil
+	}
+
+	var option *CategoryOption
+	if len(sub.Options) > 0 {
+		value := strings.TrimSpace(item.Brand)
+		if value == "" {
+			value = legacyOption
+		}
+		value, err := labelled(sub.Label, value)
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			return fmt.Errorf("%s is required for %s", sub.Label, sub.Name)
+		}
+		for i := range sub.Options {
+			if strings.EqualFold(value, sub.Options[i].Name) {
+				option = &sub.Options[i]
+				break
+			}
+		}
+		if option == nil {
+			return fmt.Errorf("Unknown %s for %s: %s", strings.ToLower(sub.Label), sub.Name, value)
+		}
+		item.Brand = option.Name
+		if _, ok := item.Attributes[sub.Label]; ok {
+			item.Attributes[sub.Label] = option.Name
+		}
+	}
+
+	if option != nil && len(option.Options) > 0 {
+		value, err := labelled(option.Label, strings.TrimSpace(item.Model))
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			return fmt.Errorf("%s is required for %s", option.Label, option.Name)
+		}
+		model := ""
+		for _, m := range option.Options {
+			if strings.EqualFold(value, m) {
+				model = m
+				break
+			}
+		}
+		if model == "" {
+			return fmt.Errorf("Unknown %s for %s: %s", strings.ToLower(option.Label), option.Name, value)
+		}
+		item.Model = model
+		if _, ok := item.Attributes[option.Label]; ok {
+			item.Attributes[option.Label] = model
+		}
+	}
+
+	schemas := append(append([]AttributeSchema{}, category.Attributes...), sub.Attributes...)
+	attributes := map[string]string{}
+	for key, value := range item.Attributes {
+		if key == sub.Label || option != nil && option.Label != "" && key == option.Label {
+			attributes[key] = value
+			continue
+		}
+		var schema *AttributeSchema
+		for i := range schemas {
+			if strings.EqualFold(key, schemas[i].Key) {
+				schema = &schemas[i]
+				break
+			}
+		}
+		if schema == nil {
+			return fmt.Errorf("Unknown attribute for %s: %s", sub.Name, key)
+		}
+		value, err := checkAttribute(schema, value)
+		if err != nil {
+			return err
+		}
+		if value != "" {
+			attributes[schema.Key] = value
+		}
+	}
+	for _, s := range schemas {
+		if _, ok := attributes[s.Key]; s.Required && !ok {
+			return fmt.Errorf("%s is required for %s", s.Label, sub.Name)
+		}
+	}
+	item.Attributes = attributes
+	if len(attributes) == 0 {
+		item.Attributes = nil
+	}
+	return nil
+}
+
+// checkAttribute checks a value against its schema and returns it as
+// stored. An empty value means the attribute isn't set.
+func checkAttribute(s *AttributeSchema, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+
+	switch s.Type {
+	case AttributeEnum:
+		for _, opt := range s.Options {
+			if strings.EqualFold(value, opt) {
+				return opt, nil
+			}
+		}
+		return "", fmt.Errorf("%s must be one of: %s", s.Label, strings.Join(s.Options, ", "))
+	case AttributeNumber, AttributeInteger:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return "", fmt.Errorf("%s must be a number", s.Label)
+		}
+		if s.Type == AttributeInteger && n != math.Trunc(n) {
+			return "", fmt.Errorf("%s must be a whole number", s.Label)
+		}
+		if s.Min != nil && n < *s.Min || s.Max != nil && n > *s.Max {
+			return "", fmt.Errorf("%s must be %s", s.Label, describeRange(s.Min, s.Max))
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	case AttributeBoolean:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%s must be true or false", s.Label)
+		}
+		return strconv.FormatBool(b), nil
+	default:
+		if len([]rune(value)) > maxAttributeLength {
+			return "", fmt.Errorf("%s must be at most %d characters", s.Label, maxAttributeLength)
+		}
+		return value, nil
+	}
+}
+
+func describeRange(min, max *float64) string {
+	format := func(f *float64) string { return strconv.FormatFloat(*f, 'f', -1, 64) }
+	switch {
+	case min != nil && max != nil:
+		return "between " + format(min) + " and " + format(max)
+	case min != nil:
+		return "at least " + format(min)
+	default:
+		return "at most " + format(max)
+	}
+}
+
+// attributeValues reads the attributes of an update request, formatting
+// numbers and booleans the way they are stored
+func attributeValues(raw interface{}) (map[string]string, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	fields, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("Attributes must be an object")
+	}
+	attributes := make(map[string]string, len(fields))
+	for key, v := range fields {
+		switch v := v.(type) {
+		case string:
+			attributes[key] = v
+		case float64:
+			attributes[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			attributes[key] = strconv.FormatBool(v)
+		case nil:
+		default:
+			return nil, fmt.Errorf("Attribute %s must be a string, number or boolean", key)
+		}
+	}
+	return attributes, nil
+}
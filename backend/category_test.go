@@ -0,0 +1,142 @@
+package backend
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFitTaxonomy(t *testing.T) {
+	two, nine := 2.0, 9.0
+	category := &Category{
+		Name: "Vehicles",
+		Attributes: []AttributeSchema{
+			{Key: "fuel", Label: "Fuel", Type: AttributeEnum, Options: []string{"Petrol", "Diesel"}, Required: true},
+		},
+		SubCategories: []SubCategory{
+			{
+				Name: "Cars", Label: "Brand",
+				Options: []CategoryOption{
+					{Name: "Maruti Suzuki", Label: "Model", Options: []string{"Swift", "Baleno"}},
+					{Name: "Others"},
+				},
+				Attributes: []AttributeSchema{{Key: "seats", Label: "Seats", Type: AttributeInteger, Min: &two, Max: &nine}},
+			},
+			{Name: "Accessories"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		item    Item
+		want    Item // category, sub-category, brand, model and attributes after fitting
+		wantErr string
+	}{
+		{
+			name: "canonical names",
+			item: Item{SubCategory: "cars", Brand: "maruti suzuki", Model: "SWIFT", Attributes: map[string]string{"Fuel": "petrol", "seats": "5"}},
+			want: Item{Category: "Vehicles", SubCategory: "Cars", Brand: "Maruti Suzuki", Model: "Swift", Attributes: map[string]string{"fuel": "Petrol", "seats": "5"}},
+		},
+		{
+			name: "legacy sub-category with the option",
+			item: Item{SubCategory: "Cars - Maruti Suzuki", Model: "Baleno", Attributes: map[string]string{"fuel": "Diesel"}},
+			want: Item{Category: "Vehicles", SubCategory: "Cars", Brand: "Maruti Suzuki", Model: "Baleno", Attributes: map[string]string{"fuel": "Diesel"}},
+		},
+		{
+			name: "option and model in the attributes",
+			item: Item{SubCategory: "Cars", Attributes: map[string]string{"Brand": "maruti suzuki", "Model": "swift", "fuel": "Petrol"}},
+			want: Item{Category: "Vehicles", SubCategory: "Cars", Brand: "Maruti Suzuki", Model: "Swift", Attributes: map[string]string{"Brand": "Maruti Suzuki", "Model": "Swift", "fuel": "Petrol"}},
+		},
+		{
+			name: "option without models",
+			item: Item{SubCategory: "Cars", Brand: "Others", Attributes: map[string]string{"fuel": "Petrol"}},
+			want: Item{Category: "Vehicles", SubCategory: "Cars", Brand: "Others", Attributes: map[string]string{"fuel": "Petrol"}},
+		},
+		{
+			name: "sub-category without options",
+			item: Item{SubCategory: "Accessories", Attributes: map[string]string{"fuel": "Petrol"}},
+			want: Item{Category: "Vehicles", SubCategory: "Accessories", Attributes: map[string]string{"fuel": "Petrol"}},
+		},
+		{
+			name:    "attributes disagreeing with the option",
+			item:    Item{SubCategory: "Cars", Brand: "Maruti Suzuki", Model: "Swift", Attributes: map[string]string{"Brand": "Honda", "fuel": "Petrol"}},
+			wantErr: "Brand in attributes doesn't match Maruti Suzuki",
+		},
+		{name: "no sub-category", item: Item{}, wantErr: "Sub-category is required"},
+		{name: "unknown sub-category", item: Item{SubCategory: "Boats"}, wantErr: "Unknown sub-category of Vehicles: Boats"},
+		{name: "no option", item: Item{SubCategory: "Cars"}, wantErr: "Brand is required for Cars"},
+		{name: "unknown option", item: Item{SubCategory: "Cars", Brand: "Tesla"}, wantErr: "Unknown brand for Cars: Tesla"},
+		{name: "no model", item: Item{SubCategory: "Cars", Brand: "Maruti Suzuki"}, wantErr: "Model is required for Maruti Suzuki"},
+		{name: "unknown model", item: Item{SubCategory: "Cars", Brand: "Maruti Suzuki", Model: "Alto"}, wantErr: "Unknown model for Maruti Suzuki: Alto"},
+		{
+			name:    "unknown attribute",
+			item:    Item{SubCategory: "Accessories", Attributes: map[string]string{"fuel": "Petrol", "seats": "4"}},
+			wantErr: "Unknown attribute for Accessories: seats",
+		},
+		{
+			name:    "invalid attribute",
+			item:    Item{SubCategory: "Cars", Brand: "Others", Attributes: map[string]string{"fuel": "Petrol", "seats": "12"}},
+			wantErr: "Seats must be between 2 and 9",
+		},
+		{name: "missing required attribute", item: Item{SubCategory: "Accessories"}, wantErr: "Fuel is required for Accessories"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := tt.item
+			err := fitTaxonomy(category, &item)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("fitTaxonomy() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fitTaxonomy() error = %v", err)
+			}
+			got := Item{Category: item.Category, SubCategory: item.SubCategory, Brand: item.Brand, Model: item.Model, Attributes: item.Attributes}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fitTaxonomy() gave %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckAttribute(t *testing.T) {
+	zero, ten := 0.0, 10.0
+	tests := []struct {
+		name    string
+		schema  AttributeSchema
+		value   string
+		want    string
+		wantErr string
+	}{
+		{"empty", AttributeSchema{Type: AttributeNumber}, "  ", "", ""},
+		{"text", AttributeSchema{Type: AttributeText}, " Red ", "Red", ""},
+		{"text too long", AttributeSchema{Label: "Colour", Type: AttributeText}, strings.Repeat("a", maxAttributeLength+1), "", "Colour must be at most 100 characters"},
+		{"enum", AttributeSchema{Type: AttributeEnum, Options: []string{"Petrol", "Diesel"}}, "diesel", "Diesel", ""},
+		{"unknown enum", AttributeSchema{Label: "Fuel", Type: AttributeEnum, Options: []string{"Petrol", "Diesel"}}, "Hydrogen", "", "Fuel must be one of: Petrol, Diesel"},
+		{"number", AttributeSchema{Type: AttributeNumber}, "2.50", "2.5", ""},
+		{"not a number", AttributeSchema{Label: "Weight", Type: AttributeNumber}, "heavy", "", "Weight must be a number"},
+		{"infinite", AttributeSchema{Label: "Weight", Type: AttributeNumber}, "Inf", "", "Weight must be a number"},
+		{"integer", AttributeSchema{Type: AttributeInteger}, "4.0", "4", ""},
+		{"fractional integer", AttributeSchema{Label: "Seats", Type: AttributeInteger}, "4.5", "", "Seats must be a whole number"},
+		{"within bounds", AttributeSchema{Type: AttributeNumber, Min: &zero, Max: &ten}, "10", "10", ""},
+		{"below the minimum", AttributeSchema{Label: "Age", Type: AttributeNumber, Min: &zero}, "-1", "", "Age must be at least 0"},
+		{"above the maximum", AttributeSchema{Label: "Age", Type: AttributeNumber, Max: &ten}, "11", "", "Age must be at most 10"},
+		{"boolean", AttributeSchema{Type: AttributeBoolean}, "TRUE", "true", ""},
+		{"boolean from a digit", AttributeSchema{Type: AttributeBoolean}, "0", "false", ""},
+		{"not a boolean", AttributeSchema{Label: "Automatic", Type: AttributeBoolean}, "maybe", "", "Automatic must be true or false"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkAttribute(&tt.schema, tt.value)
+			gotErr := ""
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if got != tt.want || gotErr != tt.wantErr {
+				t.Errorf("checkAttribute() = %q, %q, want %q, %q", got, gotErr, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -36,7 +36,9 @@ func HandleUnreadCount(w http.ResponseWriter, r *http.Request) {
 
 func HandleChatByID(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api/chats/")
-	if strings.HasSuffix(path, "/messages") {
+	if chatID, rest, ok := strings.Cut(path, "/offers/"); ok {
+		handleChatOffer(w, r, chatID, rest)
+	} else if strings.HasSuffix(path, "/messages") {
 		chatID := strings.TrimSuffix(path, "/messages")
 		getMessages(w, r, chatID)
 	} else if strings.HasSuffix(path, "/read") {
@@ -177,11 +179,28 @@ func getMessages(w http.ResponseWriter, r *http.Request, chatID string) {
 func sendMessage(w http.ResponseWriter, r *http.Request) {
 	userID, _ := GetUserID(r)
 	var req struct {
-		ChatID  string `json:"chatId"`
-		Content string `json:"content"`
+		ChatID  string        `json:"chatId"`
+		Content string        `json:"content"`
+		Type    string        `json:"type"`
+		Offer   *offerRequest `json:"offer"`
 	}
 	DecodeJSON(r, &req)
 
+	// Offers are delivered to the other participant straight away
+	if req.Type == MessageOffer {
+		if req.Offer == nil {
+			JSONError(w, http.StatusBadRequest, "Offer details are required")
+			return
+		}
+		message, err := sendOffer(userID, req.ChatID, *req.Offer, nil)
+		if err != nil {
+			offerResponseError(w, err)
+			return
+		}
+		JSON(w, http.StatusCreated, map[string]interface{}{"message": message})
+		return
+	}
+
 	chatID, _ := primitive.ObjectIDFromHex(req.ChatID)
 
 	collection := GetCollection("messages")
@@ -27,6 +27,15 @@ func main() {
 	}
 	defer backend.DisconnectDB(context.Background())
 
+	if err := backend.SetupPaymentProvider(); err != nil {
+		log.Fatal("Failed to set up payments: ", err)
+	}
+
+	// Start background jobs
+	scheduler := backend.NewScheduler()
+	backend.RegisterBookingJobs(scheduler)
+	scheduler.Start()
+
 	// Setup router
 	mux := backend.SetupRouter()
 
@@ -60,5 +69,7 @@ func main() {
 		log.Fatal("Server forced to shutdown:", err)
 	}
 
+	scheduler.Stop()
+
 	log.Println("Server exited")
 }
@@ -0,0 +1,51 @@
+package backend
+
+import (
+	"os"
+	"strconv"
+	"time"
+	_ "time/tzdata" // so time zones load on hosts without a zoneinfo database
+)
+
+// envFloat reads a float environment variable, falling back to def when unset or invalid
+func envFloat(key string, def float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
+// envInt reads an integer environment variable, falling back to def when unset or invalid
+func envInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			return i
+		}
+	}
+	return def
+}
+
+// envDuration reads a duration environment variable such as "24h", falling back to def
+func envDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
+
+// rentalLocation is the time zone rental hours and days are counted in,
+// TIME_ZONE or India's by default. Clients send instants in any offset, often
+// UTC, so "on the hour" and "Sunday" have to be worked out here.
+func rentalLocation() *time.Location {
+	if name := os.Getenv("TIME_ZONE"); name != "" {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	loc, _ := time.LoadLocation("Asia/Kolkata")
+	return loc
+}
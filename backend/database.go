@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -35,6 +36,82 @@ func ConnectDB(ctx context.Context) error {
 
 	db = client.Database(dbName)
 	log.Println("Connected to MongoDB")
+
+	if err := reassignDuplicateTrackingIDs(ctx); err != nil {
+		return fmt.Errorf("failed to fix tracking IDs: %w", err)
+	}
+	if err := seedCategories(ctx); err != nil {
+		return fmt.Errorf("failed to seed categories: %w", err)
+	}
+	if err := ensureIndexes(ctx); err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+
+	// Items missing search fields can't be found by a search until this is
+	// done, but the server doesn't need to wait for it
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), searchIndexTimeout)
+		defer cancel()
+		if err := indexItemsForSearch(ctx); err != nil {
+			log.Printf("Failed to index items for search: %v", err)
+		}
+	}()
+	return nil
+}
+
+// ensureIndexes creates the indexes the handlers rely on. CreateMany is a
+// no-op for indexes that already exist, so this is safe on every startup.
+func ensureIndexes(ctx context.Context) error {
+	indexes := map[string][]mongo.IndexModel{
+		"bookings": {
+			{Keys: bson.D{{Key: "itemId", Value: 1}, {Key: "startDate", Value: 1}, {Key: "endDate", Value: 1}}},
+			{Keys: bson.D{{Key: "payment.orderIds", Value: 1}}},
+			{Keys: bson.D{{Key: "trackingId", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "orderId", Value: 1}}, Options: options.Index().SetSparse(true)},
+			{Keys: bson.D{{Key: "subscriptionId", Value: 1}, {Key: "cycle", Value: 1}}, Options: options.Index().SetSparse(true)},
+		},
+		// Items without coordinates are left out of 2dsphere indexes
+		"items": {
+			{Keys: bson.D{{Key: "geo", Value: "2dsphere"}}},
+			itemTextIndex,
+			{Keys: bson.D{{Key: "search.grams", Value: 1}}},
+			{Keys: bson.D{{Key: "category", Value: 1}, {Key: "subCategory", Value: 1}, {Key: "brand", Value: 1}}},
+			{Keys: bson.D{{Key: "price", Value: 1}}},
+		},
+		"orders": {
+			{Keys: bson.D{{Key: "renterId", Value: 1}, {Key: "createdAt", Value: -1}}},
+			{Keys: bson.D{{Key: "payment.orderIds", Value: 1}}},
+		},
+		"subscriptions": {
+			{Keys: bson.D{{Key: "itemId", Value: 1}, {Key: "status", Value: 1}}},
+			{Keys: bson.D{{Key: "renterId", Value: 1}, {Key: "createdAt", Value: -1}}},
+			{Keys: bson.D{{Key: "ownerId", Value: 1}, {Key: "createdAt", Value: -1}}},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "periodEnd", Value: 1}}},
+		},
+		// Pending offers are superseded per chat
+		"messages": {
+			{Keys: bson.D{{Key: "chatId", Value: 1}, {Key: "type", Value: 1}, {Key: "offer.status", Value: 1}}, Options: options.Index().SetSparse(true)},
+		},
+		// Queries nobody searched for in a while are dropped
+		"search_queries": {
+			{Keys: bson.D{{Key: "prefixes", Value: 1}, {Key: "count", Value: -1}}},
+			{Keys: bson.D{{Key: "lastSearchedAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(searchQueryRetentionDays * 24 * 60 * 60)},
+		},
+		// Who searched a query is kept as long as the query would be
+		"search_query_searchers": {
+			{Keys: bson.D{{Key: "searchedAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(searchQueryRetentionDays * 24 * 60 * 60)},
+		},
+		// Stale reservation locks are cleaned up once they expire
+		"item_locks": {
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(60)},
+		},
+	}
+
+	for name, models := range indexes {
+		if _, err := db.Collection(name).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
 	return nil
 }
 
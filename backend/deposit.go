@@ -0,0 +1,464 @@
+package backend
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Deposit statuses
+const (
+	DepositPending          = "pending" // not yet collected
+	DepositHeld             = "held"
+	DepositReleased         = "released"
+	DepositPartiallyClaimed = "partially_claimed"
+	DepositFullyClaimed     = "fully_claimed"
+)
+
+// Damage claim statuses
+const (
+	ClaimOpen     = "open"
+	ClaimAccepted = "accepted"
+	ClaimDisputed = "disputed"
+	ClaimResolved = "resolved" // settled by support
+)
+
+// depositClaimWindow is how long after return the owner has to file a claim
+func depositClaimWindow() time.Duration {
+	return time.Duration(envInt("DEPOSIT_CLAIM_WINDOW_DAYS", 3)) * 24 * time.Hour
+}
+
+// depositClaimResponseWindow is how long the renter has to answer a claim
+// before it is accepted for them
+func depositClaimResponseWindow() time.Duration {
+	return time.Duration(envInt("DEPOSIT_CLAIM_RESPONSE_DAYS", 3)) * 24 * time.Hour
+}
+
+// newDeposit returns the deposit to attach to a new booking of quantity units
+// of item, if any
+func newDeposit(item *Item, quantity int) *Deposit {
+	if item.DepositAmount <= 0 {
+		return nil
+	}
+	return &Deposit{Amount: roundMoney(item.DepositAmount * float64(quantity)), Status: DepositPending}
+}
+
+// depositTransitionFields returns the deposit updates that go with a booking
+// status change: the deposit is released in full if the booking ends before
+// the item is handed over, and goes back to the renter with the booking's
+// refund, see refundForTransition. It is collected with the payment, see
+// markBookingPaid.
+func depositTransitionFields(booking *Booking, to string, now time.Time) bson.M {
+	d := booking.Deposit
+	if d == nil {
+		return nil
+	}
+
+	switch to {
+	case StatusRejected, StatusCancelled, StatusExpired:
+		if d.Status == DepositPending || d.Status == DepositHeld {
+			return bson.M{
+				"deposit.status":         DepositReleased,
+				"deposit.refundedAmount": d.Amount,
+				"deposit.releasedAt":     now,
+			}
+		}
+	}
+	return nil
+}
+
+// fileDamageClaim lets the owner claim part or all of the deposit for damage
+func fileDamageClaim(w http.ResponseWriter, r *http.Request, id string) {
+	userID, _ := GetUserID(r)
+
+	var req struct {
+		Amount      float64  `json:"amount"`
+		Description string   `json:"description"`
+		Photos      []string `json:"photos"`
+	}
+	if err := DecodeJSON(r, &req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	booking, role, ok := findBookingForUser(ctx, w, id, userID)
+	if !ok {
+		return
+	}
+	if role != RoleOwner {
+		JSONError(w, http.StatusForbidden, "Only the owner can file a damage claim")
+		return
+	}
+
+	switch booking.Status {
+	case StatusHandedOver, StatusReturned, StatusCompleted:
+	default:
+		JSONError(w, http.StatusConflict, "Damage claims can only be filed after handover")
+		return
+	}
+	if booking.Deposit == nil || booking.Deposit.Status != DepositHeld {
+		JSONError(w, http.StatusConflict, "No deposit is held for this booking")
+		return
+	}
+	if booking.Deposit.Claim != nil {
+		JSONError(w, http.StatusConflict, "A claim has already been filed")
+		return
+	}
+	if req.Amount <= 0 || req.Amount > booking.Deposit.Amount {
+		JSONError(w, http.StatusBadRequest, "Claim amount must be between 0 and the deposit amount")
+		return
+	}
+	if len(req.Photos) == 0 {
+		JSONError(w, http.StatusBadRequest, "At least one photo of the damage is required")
+		return
+	}
+
+	now := time.Now()
+	claim := DamageClaim{
+		Amount:      roundMoney(req.Amount),
+		Description: req.Description,
+		Photos:      req.Photos,
+		Status:      ClaimOpen,
+		FiledAt:     now,
+		RespondBy:   now.Add(depositClaimResponseWindow()),
+	}
+
+	// Only file against a deposit that is still held and unclaimed, in case
+	// the auto-release job got there first
+	result, err := GetCollection("bookings").UpdateOne(ctx,
+		bson.M{"_id": booking.ID, "deposit.status": DepositHeld, "deposit.claim": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"deposit.claim": claim, "updatedAt": now}},
+	)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to file claim")
+		return
+	}
+	if result.MatchedCount == 0 {
+		JSONError(w, http.StatusConflict, "The deposit is no longer available to claim")
+		return
+	}
+
+	booking.Deposit.Claim = &claim
+	notifyBookingEvent(ctx, booking, booking.RenterID, "deposit_claim_filed")
+
+	JSON(w, http.StatusCreated, map[string]interface{}{
+		"message":  "Claim filed",
+		"deposit":  booking.Deposit,
+		"evidence": handoverRecords(booking),
+	})
+}
+
+// respondToDamageClaim lets the renter accept or dispute the owner's claim
+func respondToDamageClaim(w http.ResponseWriter, r *http.Request, id string) {
+	userID, _ := GetUserID(r)
+
+	var req struct {
+		Action string `json:"action"` // "accept" or "dispute"
+		Note   string `json:"note"`
+	}
+	if err := DecodeJSON(r, &req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if req.Action != "accept" && req.Action != "dispute" {
+		JSONError(w, http.StatusBadRequest, "Action must be 'accept' or 'dispute'")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	booking, role, ok := findBookingForUser(ctx, w, id, userID)
+	if !ok {
+		return
+	}
+	if role != RoleRenter {
+		JSONError(w, http.StatusForbidden, "Only the renter can respond to a claim")
+		return
+	}
+	if booking.Deposit == nil || booking.Deposit.Claim == nil || booking.Deposit.Claim.Status != ClaimOpen {
+		JSONError(w, http.StatusConflict, "There is no open claim on this booking")
+		return
+	}
+
+	d := booking.Deposit
+	now := time.Now()
+	set := bson.M{"deposit.claim.respondedAt": now, "deposit.claim.renterNote": req.Note, "updatedAt": now}
+	action := "deposit_claim_disputed"
+
+	if req.Action == "accept" {
+		action = "deposit_claim_accepted"
+		for k, v := range claimSettlementFields(d, d.Claim.Amount, now) {
+			set[k] = v
+		}
+		set["deposit.claim.status"] = ClaimAccepted
+	} else {
+		// Disputed claims keep the deposit held until support resolves them,
+		// see resolveDamageClaim
+		set["deposit.claim.status"] = ClaimDisputed
+	}
+
+	result, err := GetCollection("bookings").UpdateOne(ctx,
+		bson.M{"_id": booking.ID, "deposit.claim.status": ClaimOpen},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to update claim")
+		return
+	}
+	if result.MatchedCount == 0 {
+		JSONError(w, http.StatusConflict, "There is no open claim on this booking")
+		return
+	}
+
+	GetCollection("bookings").FindOne(ctx, bson.M{"_id": booking.ID}).Decode(booking)
+	notifyBookingEvent(ctx, booking, booking.OwnerID, action)
+	// A failed refund is retried by the scheduler
+	issueDepositRefund(ctx, booking)
+
+	JSON(w, http.StatusOK, map[string]interface{}{"message": "Claim updated", "deposit": booking.Deposit})
+}
+
+// resolveDamageClaim lets support settle a claim the renter disputed, or
+// hasn't answered yet, for any amount up to the deposit; the rest goes back
+// to the renter
+func resolveDamageClaim(w http.ResponseWriter, r *http.Request, id string) {
+	userID, _ := GetUserID(r)
+
+	var req struct {
+		Amount float64 `json:"amount"` // awarded to the owner, 0 to reject the claim
+		Note   string  `json:"note"`
+	}
+	if err := DecodeJSON(r, &req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	bookingID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid booking ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user User
+	GetCollection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if user.Role != UserRoleSupport {
+		JSONError(w, http.StatusForbidden, "Only support can resolve a claim")
+		return
+	}
+
+	var booking Booking
+	if err := GetCollection("bookings").FindOne(ctx, bson.M{"_id": bookingID}).Decode(&booking); err != nil {
+		JSONError(w, http.StatusNotFound, "Booking not found")
+		return
+	}
+	d := booking.Deposit
+	if d == nil || d.Status != DepositHeld || d.Claim == nil || (d.Claim.Status != ClaimOpen && d.Claim.Status != ClaimDisputed) {
+		JSONError(w, http.StatusConflict, "There is no unresolved claim on this booking")
+		return
+	}
+	if req.Amount < 0 || req.Amount > d.Amount {
+		JSONError(w, http.StatusBadRequest, "Amount must be between 0 and the deposit amount")
+		return
+	}
+
+	now := time.Now()
+	set := claimSettlementFields(d, req.Amount, now)
+	set["deposit.claim.status"] = ClaimResolved
+	set["deposit.claim.resolvedBy"] = userID
+	set["deposit.claim.resolvedAt"] = now
+	set["deposit.claim.resolutionNote"] = req.Note
+	set["updatedAt"] = now
+
+	result, err := GetCollection("bookings").UpdateOne(ctx,
+		bson.M{"_id": booking.ID, "deposit.status": DepositHeld, "deposit.claim.status": d.Claim.Status},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to resolve claim")
+		return
+	}
+	if result.MatchedCount == 0 {
+		JSONError(w, http.StatusConflict, "There is no unresolved claim on this booking")
+		return
+	}
+
+	GetCollection("bookings").FindOne(ctx, bson.M{"_id": booking.ID}).Decode(&booking)
+	notifyBookingEvent(ctx, &booking, booking.RenterID, "deposit_claim_resolved")
+	notifyBookingEvent(ctx, &booking, booking.OwnerID, "deposit_claim_resolved")
+	// A failed refund is retried by the scheduler
+	issueDepositRefund(ctx, &booking)
+
+	JSON(w, http.StatusOK, map[string]interface{}{"message": "Claim resolved", "deposit": booking.Deposit})
+}
+
+// claimSettlementFields returns the deposit updates that settle its claim
+// with claimed going to the owner. Whatever is left of the deposit is
+// released and queued for refund.
+func claimSettlementFields(d *Deposit, claimed float64, now time.Time) bson.M {
+	claimed = roundMoney(math.Min(math.Max(claimed, 0), d.Amount))
+	status := DepositPartiallyClaimed
+	switch {
+	case claimed >= d.Amount:
+		status = DepositFullyClaimed
+	case claimed <= 0:
+		status = DepositReleased
+	}
+
+	set := bson.M{
+		"deposit.status":         status,
+		"deposit.claimedAmount":  claimed,
+		"deposit.refundedAmount": roundMoney(d.Amount - claimed),
+		"deposit.releasedAt":     now,
+	}
+	if claimed < d.Amount {
+		set["deposit.refundStatus"] = RefundPending
+	}
+	return set
+}
+
+// acceptUnansweredClaims accepts open claims the renter hasn't answered by
+// their respondBy, so the deposit doesn't stay held
+func acceptUnansweredClaims(ctx context.Context) error {
+	cursor, err := GetCollection("bookings").Find(ctx, bson.M{
+		"deposit.status":          DepositHeld,
+		"deposit.claim.status":    ClaimOpen,
+		"deposit.claim.respondBy": bson.M{"$lt": time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var booking Booking
+		if err := cursor.Decode(&booking); err != nil {
+			continue
+		}
+
+		now := time.Now()
+		set := claimSettlementFields(booking.Deposit, booking.Deposit.Claim.Amount, now)
+		set["deposit.claim.status"] = ClaimAccepted
+		set["updatedAt"] = now
+		result, err := GetCollection("bookings").UpdateOne(ctx,
+			bson.M{"_id": booking.ID, "deposit.status": DepositHeld, "deposit.claim.status": ClaimOpen},
+			bson.M{"$set": set},
+		)
+		if err != nil || result.MatchedCount == 0 {
+			continue
+		}
+
+		GetCollection("bookings").FindOne(ctx, bson.M{"_id": booking.ID}).Decode(&booking)
+		notifyBookingEvent(ctx, &booking, booking.RenterID, "deposit_claim_lapsed")
+		notifyBookingEvent(ctx, &booking, booking.OwnerID, "deposit_claim_lapsed")
+		issueDepositRefund(ctx, &booking)
+		count++
+	}
+
+	if count > 0 {
+		log.Printf("Accepted %d unanswered damage claims", count)
+	}
+	return cursor.Err()
+}
+
+// releaseUnclaimedDeposits releases deposits that are still held once the
+// claim window after return has passed without a claim being filed
+func releaseUnclaimedDeposits(ctx context.Context) error {
+	cutoff := time.Now().Add(-depositClaimWindow())
+	filter := bson.M{
+		"deposit.status": DepositHeld,
+		"deposit.claim":  bson.M{"$exists": false},
+		"status":         bson.M{"$in": []string{StatusReturned, StatusCompleted}},
+		"statusHistory": bson.M{"$elemMatch": bson.M{
+			"to": bson.M{"$in": []string{StatusReturned, StatusCompleted}},
+			"at": bson.M{"$lt": cutoff},
+		}},
+	}
+
+	cursor, err := GetCollection("bookings").Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var booking Booking
+		if err := cursor.Decode(&booking); err != nil {
+			continue
+		}
+
+		now := time.Now()
+		result, err := GetCollection("bookings").UpdateOne(ctx,
+			bson.M{"_id": booking.ID, "deposit.status": DepositHeld, "deposit.claim": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{
+				"deposit.status":         DepositReleased,
+				"deposit.refundedAmount": booking.Deposit.Amount,
+				"deposit.refundStatus":   RefundPending,
+				"deposit.releasedAt":     now,
+				"updatedAt":              now,
+			}},
+		)
+		if err != nil || result.MatchedCount == 0 {
+			continue
+		}
+
+		booking.Deposit.Status = DepositReleased
+		booking.Deposit.RefundedAmount = booking.Deposit.Amount
+		booking.Deposit.RefundStatus = RefundPending
+		notifyBookingEvent(ctx, &booking, booking.RenterID, "deposit_released")
+		issueDepositRefund(ctx, &booking)
+		count++
+	}
+
+	if count > 0 {
+		log.Printf("Released %d unclaimed deposits", count)
+	}
+	return cursor.Err()
+}
+
+// issueDepositRefund sends the released part of a deposit kept until after
+// return to the payment provider. On failure the refund stays pending and
+// retryPendingRefunds picks it up.
+func issueDepositRefund(ctx context.Context, booking *Booking) error {
+	d := booking.Deposit
+	if d == nil || d.RefundStatus != RefundPending {
+		return nil
+	}
+
+	parts, err := refundCaptures(ctx, booking, d.RefundedAmount, true, d.RefundParts, "deposit.refundParts", nil)
+	d.RefundParts = parts
+	if err != nil {
+		log.Printf("Error refunding deposit of booking %s: %v", booking.ID.Hex(), err)
+		return err
+	}
+	refundID := lastRefundID(parts)
+
+	_, err = GetCollection("bookings").UpdateOne(ctx,
+		bson.M{"_id": booking.ID, "deposit.refundStatus": RefundPending},
+		bson.M{"$set": bson.M{
+			"deposit.refundStatus": RefundProcessed,
+			"deposit.refundId":     refundID,
+			"updatedAt":            time.Now(),
+		}},
+	)
+	if err != nil {
+		return err
+	}
+
+	d.RefundStatus = RefundProcessed
+	d.RefundID = refundID
+	notifyBookingEvent(ctx, booking, booking.RenterID, "refund_processed")
+	return nil
+}
@@ -0,0 +1,117 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestClaimSettlementFields(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	deposit := &Deposit{Amount: 2000, Status: DepositHeld}
+
+	tests := []struct {
+		name    string
+		claimed float64
+		want    bson.M
+	}{
+		{
+			name:    "part of the deposit",
+			claimed: 500,
+			want: bson.M{
+				"deposit.status":         DepositPartiallyClaimed,
+				"deposit.claimedAmount":  500.0,
+				"deposit.refundedAmount": 1500.0,
+				"deposit.refundStatus":   RefundPending,
+				"deposit.releasedAt":     now,
+			},
+		},
+		{
+			name:    "the whole deposit",
+			claimed: 2000,
+			want: bson.M{
+				"deposit.status":         DepositFullyClaimed,
+				"deposit.claimedAmount":  2000.0,
+				"deposit.refundedAmount": 0.0,
+				"deposit.releasedAt":     now,
+			},
+		},
+		{
+			name:    "rejected claim",
+			claimed: 0,
+			want: bson.M{
+				"deposit.status":         DepositReleased,
+				"deposit.claimedAmount":  0.0,
+				"deposit.refundedAmount": 2000.0,
+				"deposit.refundStatus":   RefundPending,
+				"deposit.releasedAt":     now,
+			},
+		},
+		{
+			name:    "capped at the deposit",
+			claimed: 2500,
+			want: bson.M{
+				"deposit.status":         DepositFullyClaimed,
+				"deposit.claimedAmount":  2000.0,
+				"deposit.refundedAmount": 0.0,
+				"deposit.releasedAt":     now,
+			},
+		},
+		{
+			name:    "rounded to the paisa",
+			claimed: 333.333,
+			want: bson.M{
+				"deposit.status":         DepositPartiallyClaimed,
+				"deposit.claimedAmount":  333.33,
+				"deposit.refundedAmount": 1666.67,
+				"deposit.refundStatus":   RefundPending,
+				"deposit.releasedAt":     now,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := claimSettlementFields(deposit, tt.claimed, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("claimSettlementFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDepositTransitionFields(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	released := bson.M{
+		"deposit.status":         DepositReleased,
+		"deposit.refundedAmount": 1000.0,
+		"deposit.releasedAt":     now,
+	}
+	withDeposit := func(status string) *Booking {
+		return &Booking{Deposit: &Deposit{Amount: 1000, Status: status}}
+	}
+
+	tests := []struct {
+		name    string
+		booking *Booking
+		to      string
+		want    bson.M
+	}{
+		{"no deposit", &Booking{}, StatusCancelled, nil},
+		{"cancelled before payment", withDeposit(DepositPending), StatusCancelled, released},
+		{"cancelled while held", withDeposit(DepositHeld), StatusCancelled, released},
+		{"rejected", withDeposit(DepositHeld), StatusRejected, released},
+		{"expired", withDeposit(DepositPending), StatusExpired, released},
+		{"confirmed", withDeposit(DepositHeld), StatusConfirmed, nil},
+		{"returned", withDeposit(DepositHeld), StatusReturned, nil},
+		{"already released", withDeposit(DepositReleased), StatusCancelled, nil},
+		{"already claimed", withDeposit(DepositFullyClaimed), StatusCancelled, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := depositTransitionFields(tt.booking, tt.to, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("depositTransitionFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,512 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Documents generated for a booking
+const (
+	DocumentAgreement = "agreement"
+	DocumentInvoice   = "invoice"
+)
+
+// rentalSAC is the GST services accounting code for renting out goods
+const rentalSAC = "9973"
+
+// gstinPattern matches a GST identification number
+var gstinPattern = regexp.MustCompile(`^[0-9]{2}[A-Z]{5}[0-9]{4}[A-Z][1-9A-Z]Z[0-9A-Z]$`)
+
+// agreementStatuses are the booking statuses that have a rental agreement
+var agreementStatuses = []string{StatusConfirmed, StatusHandedOver, StatusReturned, StatusCompleted}
+
+// documentData is what the agreement and invoice are rendered from
+type documentData struct {
+	Kind      string
+	Title     string
+	Number    string
+	IssuedAt  time.Time
+	Booking   *Booking
+	Item      *Item
+	Owner     *User
+	Renter    *User
+	Lines     []PriceLineItem
+	Taxable   float64 // everything but GST
+	Tax       float64
+	Total     float64
+	Deposit   float64
+	Terms     []string
+	TaxNumber string // the item's SAC code
+
+	// Invoices only
+	SupplierGSTIN string
+	PlatformLines []PriceLineItem
+}
+
+// issueInvoice gives a paid booking the next invoice number in its owner's
+// sequence, with its amounts as they are now. Bookings that already have one
+// keep it.
+func issueInvoice(ctx context.Context, booking *Booking) (*Invoice, error) {
+	if booking.Invoice != nil {
+		return booking.Invoice, nil
+	}
+
+	var owner User
+	if err := GetCollection("users").FindOne(ctx, bson.M{"_id": booking.OwnerID}).Decode(&owner); err != nil {
+		return nil, err
+	}
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := GetCollection("invoice_counters").FindOneAndUpdate(ctx,
+		bson.M{"_id": booking.OwnerID},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return nil, err
+	}
+
+	// The sequence is per owner, so the number carries the whole owner ID
+	invoice := Invoice{
+		Number:   fmt.Sprintf("RK-%s-%06d", strings.ToUpper(booking.OwnerID.Hex()), counter.Seq),
+		IssuedAt: time.Now(),
+	}
+	invoice.setAmounts(booking, owner.GSTIN)
+	result, err := GetCollection("bookings").UpdateOne(ctx,
+		bson.M{"_id": booking.ID, "invoice": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"invoice": invoice}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		// Issued concurrently; use that one
+		if err := GetCollection("bookings").FindOne(ctx, bson.M{"_id": booking.ID}).Decode(booking); err != nil {
+			return nil, err
+		}
+		return booking.Invoice, nil
+	}
+	booking.Invoice = &invoice
+	return &invoice, nil
+}
+
+// setAmounts fills in the invoice's lines and totals from booking. An owner
+// without a GSTIN can't charge GST, so the platform fee and GST are listed as
+// charged by RentKar rather than under the owner.
+func (invoice *Invoice) setAmounts(booking *Booking, gstin string) {
+	invoice.SupplierGSTIN = gstin
+	invoice.Lines, invoice.PlatformLines = nil, nil
+	invoice.Taxable, invoice.Tax = 0, 0
+	for _, l := range booking.LineItems {
+		if gstin == "" && (l.Code == "platform_fee" || l.Code == "tax") {
+			invoice.PlatformLines = append(invoice.PlatformLines, l)
+		} else {
+			invoice.Lines = append(invoice.Lines, l)
+		}
+		if l.Code == "tax" {
+			invoice.Tax += l.Amount
+		} else {
+			invoice.Taxable += l.Amount
+		}
+	}
+	invoice.Taxable = roundMoney(invoice.Taxable)
+	invoice.Tax = roundMoney(invoice.Tax)
+	invoice.Total = booking.TotalPrice
+}
+
+// handleBookingDocument serves GET /api/bookings/{id}/documents/{kind} as HTML,
+// or as PDF with ?format=pdf. Either party can download both documents.
+func handleBookingDocument(w http.ResponseWriter, r *http.Request, id, kind string) {
+	if kind != DocumentAgreement && kind != DocumentInvoice {
+		JSONError(w, http.StatusNotFound, "Unknown document, expected 'agreement' or 'invoice'")
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "html"
+	}
+	if format != "html" && format != "pdf" {
+		JSONError(w, http.StatusBadRequest, "Format must be 'html' or 'pdf'")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	booking, _, ok := findBookingForUser(ctx, w, id, userID)
+	if !ok {
+		return
+	}
+
+	var data *documentData
+	switch kind {
+	case DocumentAgreement:
+		if !containsString(agreementStatuses, booking.Status) {
+			JSONError(w, http.StatusConflict, "The agreement is available once the booking is confirmed")
+			return
+		}
+		data = newDocumentData(ctx, booking, kind)
+		data.Title = "Rental Agreement"
+		data.Number = booking.TrackingID
+		data.IssuedAt = confirmedAt(booking)
+		data.Terms = agreementTerms(booking, data.Item)
+	case DocumentInvoice:
+		if booking.Payment == nil || booking.Payment.PaidAt == nil {
+			JSONError(w, http.StatusConflict, "The invoice is available once the booking is paid")
+			return
+		}
+		invoice, err := issueInvoice(ctx, booking)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to issue invoice")
+			return
+		}
+		data = newDocumentData(ctx, booking, kind)
+		data.Title = "Tax Invoice"
+		data.Number = invoice.Number
+		data.IssuedAt = invoice.IssuedAt
+		// Invoices issued before amounts were kept are rendered from the booking
+		if invoice.Lines == nil {
+			invoice.setAmounts(booking, data.Owner.GSTIN)
+		}
+		data.SupplierGSTIN = invoice.SupplierGSTIN
+		data.Lines = invoice.Lines
+		data.PlatformLines = invoice.PlatformLines
+		data.Taxable = invoice.Taxable
+		data.Tax = invoice.Tax
+		data.Total = invoice.Total
+	}
+
+	filename := fmt.Sprintf("rentkar-%s-%s", kind, booking.TrackingID)
+	if format == "pdf" {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.pdf"`)
+		w.Write(renderDocumentPDF(data))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := documentTemplate.Execute(&buf, data); err != nil {
+		log.Printf("Error rendering %s for booking %s: %v", kind, booking.ID.Hex(), err)
+		JSONError(w, http.StatusInternalServerError, "Failed to generate document")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="`+filename+`.html"`)
+	w.Write(buf.Bytes())
+}
+
+// newDocumentData loads the item and both parties of a booking and totals its
+// line items
+func newDocumentData(ctx context.Context, booking *Booking, kind string) *documentData {
+	data := &documentData{Kind: kind, Booking: booking, Item: &Item{}, Owner: &User{}, Renter: &User{}, TaxNumber: rentalSAC}
+	GetCollection("items").FindOne(ctx, bson.M{"_id": booking.ItemID}).Decode(data.Item)
+	GetCollection("users").FindOne(ctx, bson.M{"_id": booking.OwnerID}).Decode(data.Owner)
+	GetCollection("users").FindOne(ctx, bson.M{"_id": booking.RenterID}).Decode(data.Renter)
+
+	data.Lines = booking.LineItems
+	for _, l := range data.Lines {
+		if l.Code == "tax" {
+			data.Tax += l.Amount
+		} else {
+			data.Taxable += l.Amount
+		}
+	}
+	data.Taxable = roundMoney(data.Taxable)
+	data.Tax = roundMoney(data.Tax)
+	data.Total = booking.TotalPrice
+	if booking.Deposit != nil {
+		data.Deposit = booking.Deposit.Amount
+	}
+	return data
+}
+
+// confirmedAt is when the booking was confirmed, which is when the agreement
+// was entered into
+func confirmedAt(booking *Booking) time.Time {
+	for _, c := range booking.StatusHistory {
+		if c.To == StatusConfirmed {
+			return c.At
+		}
+	}
+	return booking.CreatedAt
+}
+
+// agreementTerms lists the terms the booking was made on
+func agreementTerms(booking *Booking, item *Item) []string {
+	rented := "the item"
+	if booking.units() > 1 {
+		rented = fmt.Sprintf("%d units of the item", booking.units())
+	}
+	terms := []string{
+		fmt.Sprintf("The owner rents %s to the renter from %s to %s for the total shown above.",
+			rented, booking.StartDate.Format(documentTimeLayout), booking.EndDate.Format(documentTimeLayout)),
+		"The item is handed over and returned in person. The renter shares the code shown in the app with the owner, " +
+			"who records the item's condition with photos at both handovers.",
+		"Cancellation: " + policySummary(booking.CancellationPolicy),
+	}
+	if booking.Deposit != nil && booking.Deposit.Amount > 0 {
+		terms = append(terms, fmt.Sprintf("A refundable security deposit of %s is held during the rental. "+
+			"The owner may claim it for damage within %d days of the return; the renter may dispute a claim.",
+			formatMoney(booking.Deposit.Amount), int(depositClaimWindow().Hours()/24)))
+	}
+	if item.LateFee != nil && item.LateFee.Amount > 0 {
+		perUnit := ""
+		if booking.units() > 1 {
+			perUnit = " for each unit"
+		}
+		terms = append(terms, fmt.Sprintf("Returning the item after the end date is charged %s per started %s%s after a grace period of %s.",
+			formatMoney(item.LateFee.Amount), item.LateFee.Unit, perUnit, humanDuration(lateFeeGrace())))
+	}
+	terms = append(terms, "The renter uses the item with reasonable care and only for its intended purpose, "+
+		"and does not sublet it.")
+	return terms
+}
+
+// policySummary describes a cancellation policy in words
+func policySummary(policy string) string {
+	if !isCancellationPolicy(policy) {
+		policy = PolicyFlexible
+	}
+	tiers := cancellationPolicies[policy]
+	var parts []string
+	for _, t := range tiers {
+		notice := "with less notice"
+		if t.Notice > 0 {
+			notice = humanDuration(t.Notice) + " or more before the start"
+		}
+		parts = append(parts, fmt.Sprintf("%g%% of the rental is refunded when cancelling %s", t.Percent, notice))
+	}
+	summary := strings.Join(parts, "; ") + "."
+	if tiers[len(tiers)-1].Notice > 0 {
+		summary += " Otherwise the rental is not refunded."
+	}
+	return summary + " The deposit is always refunded."
+}
+
+// humanDuration formats d in days, hours or minutes, whichever is largest
+func humanDuration(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	case d >= time.Hour:
+		return unitLabel(int(d.Hours()), "hour")
+	}
+	return unitLabel(int(d.Minutes()), "minute")
+}
+
+const documentTimeLayout = "02 Jan 2006 15:04"
+
+func formatMoney(v float64) string {
+	return fmt.Sprintf("₹%.2f", v)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// renderDocumentPDF lays out the same content as documentTemplate
+func renderDocumentPDF(d *documentData) []byte {
+	p := newPDF()
+	p.text("RentKar", 10, true)
+	p.text(d.Title, 18, true)
+	p.space(4)
+	if d.Kind == DocumentInvoice {
+		p.row("Invoice number", d.Number, 10, false)
+		p.row("Invoice date", d.IssuedAt.Format("02 Jan 2006"), 10, false)
+		p.row("Booking", d.Booking.TrackingID, 10, false)
+	} else {
+		p.row("Booking", d.Number, 10, false)
+		p.row("Agreed on", d.IssuedAt.Format("02 Jan 2006"), 10, false)
+	}
+	p.rule()
+
+	party := func(label string, u *User, gstin string) {
+		p.text(label, 11, true)
+		p.text(u.Name, 10, false)
+		if u.Email != "" {
+			p.text(u.Email, 10, false)
+		}
+		if u.Phone != "" {
+			p.text(u.Phone, 10, false)
+		}
+		if gstin != "" {
+			p.text("GSTIN: "+gstin, 10, false)
+		}
+		p.space(6)
+	}
+	if d.Kind == DocumentInvoice {
+		party("Supplier (owner)", d.Owner, d.SupplierGSTIN)
+		party("Billed to (renter)", d.Renter, d.Renter.GSTIN)
+	} else {
+		party("Owner", d.Owner, "")
+		party("Renter", d.Renter, "")
+	}
+
+	p.text("Item", 11, true)
+	p.text(d.Item.Title, 10, false)
+	if model := strings.TrimSpace(d.Item.Brand + " " + d.Item.Model); model != "" {
+		p.text(model, 10, false)
+	}
+	p.text("Location: "+d.Item.Location, 10, false)
+	p.text(fmt.Sprintf("Rental period: %s to %s", d.Booking.StartDate.Format(documentTimeLayout), d.Booking.EndDate.Format(documentTimeLayout)), 10, false)
+	if d.Kind == DocumentInvoice {
+		p.text("SAC: "+d.TaxNumber+"   Place of supply: "+d.Item.Location, 10, false)
+	}
+	p.rule()
+
+	lines := func(lines []PriceLineItem) {
+		for _, l := range lines {
+			label := l.Label
+			if l.Quantity != 1 {
+				label = fmt.Sprintf("%s (%g x %s)", l.Label, l.Quantity, formatMoney(l.UnitPrice))
+			}
+			p.row(label, formatMoney(l.Amount), 10, false)
+		}
+	}
+	lines(d.Lines)
+	p.rule()
+	if d.Kind == DocumentInvoice && d.SupplierGSTIN != "" {
+		p.row("Taxable value", formatMoney(d.Taxable), 10, false)
+		p.row("GST", formatMoney(d.Tax), 10, false)
+	}
+	if len(d.PlatformLines) > 0 {
+		p.text("Charged by RentKar", 11, true)
+		lines(d.PlatformLines)
+		p.rule()
+	}
+	p.row("Total", formatMoney(d.Total), 11, true)
+	if d.Deposit > 0 {
+		p.row("Refundable security deposit (not part of the total)", formatMoney(d.Deposit), 10, false)
+	}
+
+	if len(d.Terms) > 0 {
+		p.space(10)
+		p.text("Terms", 11, true)
+		for i, t := range d.Terms {
+			p.text(fmt.Sprintf("%d. %s", i+1, t), 10, false)
+		}
+		p.space(16)
+		p.text("Accepted in the RentKar app by both parties when the booking was requested and confirmed.", 9, false)
+	}
+	if d.Kind == DocumentInvoice {
+		p.space(16)
+		p.text("This is a computer generated invoice and needs no signature.", 9, false)
+	}
+	return p.Bytes()
+}
+
+var documentTemplate = template.Must(template.New("document").Funcs(template.FuncMap{
+	"money": formatMoney,
+	"date":  func(t time.Time) string { return t.Format("02 Jan 2006") },
+	"time":  func(t time.Time) string { return t.Format(documentTimeLayout) },
+	"ne1":   func(f float64) bool { return f != 1 },
+	"isInvoice": func(kind string) bool {
+		return kind == DocumentInvoice
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} {{.Number}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; font-size: 14px; color: #222; max-width: 720px; margin: 32px auto; padding: 0 16px; }
+h1 { font-size: 24px; margin: 4px 0 16px; }
+h2 { font-size: 15px; margin: 20px 0 6px; }
+table { width: 100%; border-collapse: collapse; }
+td { padding: 4px 0; vertical-align: top; }
+td.amount { text-align: right; white-space: nowrap; }
+tr.total td { font-weight: bold; border-top: 1px solid #222; padding-top: 8px; }
+.parties { display: flex; gap: 32px; }
+.parties div { flex: 1; }
+.muted { color: #777; font-size: 12px; }
+hr { border: 0; border-top: 1px solid #ccc; margin: 16px 0; }
+</style>
+</head>
+<body>
+<div class="muted">RentKar</div>
+<h1>{{.Title}}</h1>
+<table>
+{{- if isInvoice .Kind}}
+<tr><td>Invoice number</td><td class="amount">{{.Number}}</td></tr>
+<tr><td>Invoice date</td><td class="amount">{{date .IssuedAt}}</td></tr>
+<tr><td>Booking</td><td class="amount">{{.Booking.TrackingID}}</td></tr>
+{{- else}}
+<tr><td>Booking</td><td class="amount">{{.Number}}</td></tr>
+<tr><td>Agreed on</td><td class="amount">{{date .IssuedAt}}</td></tr>
+{{- end}}
+</table>
+<hr>
+<div class="parties">
+<div>
+<h2>{{if isInvoice .Kind}}Supplier (owner){{else}}Owner{{end}}</h2>
+{{.Owner.Name}}<br>{{.Owner.Email}}<br>{{.Owner.Phone}}
+{{- if and (isInvoice .Kind) .SupplierGSTIN}}<br>GSTIN: {{.SupplierGSTIN}}{{end}}
+</div>
+<div>
+<h2>{{if isInvoice .Kind}}Billed to (renter){{else}}Renter{{end}}</h2>
+{{.Renter.Name}}<br>{{.Renter.Email}}<br>{{.Renter.Phone}}
+{{- if and (isInvoice .Kind) .Renter.GSTIN}}<br>GSTIN: {{.Renter.GSTIN}}{{end}}
+</div>
+</div>
+<h2>Item</h2>
+<div>{{.Item.Title}}</div>
+{{- if or .Item.Brand .Item.Model}}<div>{{.Item.Brand}} {{.Item.Model}}</div>{{end}}
+<div>Location: {{.Item.Location}}</div>
+<div>Rental period: {{time .Booking.StartDate}} to {{time .Booking.EndDate}}</div>
+{{- if isInvoice .Kind}}
+<div>SAC: {{.TaxNumber}} &nbsp; Place of supply: {{.Item.Location}}</div>
+{{- end}}
+<hr>
+<table>
+{{- range .Lines}}
+{{template "line" .}}
+{{- end}}
+{{- if and (isInvoice .Kind) .SupplierGSTIN}}
+<tr class="total"><td>Taxable value</td><td class="amount">{{money .Taxable}}</td></tr>
+<tr><td>GST</td><td class="amount">{{money .Tax}}</td></tr>
+{{- end}}
+{{- if .PlatformLines}}
+<tr class="total"><td>Charged by RentKar</td><td></td></tr>
+{{- range .PlatformLines}}
+{{template "line" .}}
+{{- end}}
+{{- end}}
+<tr class="total"><td>Total</td><td class="amount">{{money .Total}}</td></tr>
+{{- if gt .Deposit 0.0}}
+<tr><td>Refundable security deposit (not part of the total)</td><td class="amount">{{money .Deposit}}</td></tr>
+{{- end}}
+</table>
+{{- if .Terms}}
+<h2>Terms</h2>
+<ol>
+{{- range .Terms}}
+<li>{{.}}</li>
+{{- end}}
+</ol>
+<p class="muted">Accepted in the RentKar app by both parties when the booking was requested and confirmed.</p>
+{{- end}}
+{{- if isInvoice .Kind}}
+<p class="muted">This is a computer generated invoice and needs no signature.</p>
+{{- end}}
+</body>
+</html>
+{{- define "line"}}<tr><td>{{.Label}}{{if ne1 .Quantity}} ({{.Quantity}} × {{money .UnitPrice}}){{end}}</td><td class="amount">{{money .Amount}}</td></tr>{{end}}
+`))
@@ -0,0 +1,168 @@
+package backend
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInvoiceSetAmounts(t *testing.T) {
+	rental := PriceLineItem{Code: "rental_daily", Label: "3 days", Quantity: 3, UnitPrice: 1000, Amount: 3000}
+	cleaning := PriceLineItem{Code: "cleaning_fee", Label: "Cleaning", Amount: 200.005}
+	fee := PriceLineItem{Code: "platform_fee", Label: "Platform fee", Amount: 150}
+	tax := PriceLineItem{Code: "tax", Label: "GST", Amount: 567}
+	booking := &Booking{LineItems: []PriceLineItem{rental, cleaning, fee, tax}, TotalPrice: 3917}
+
+	tests := []struct {
+		name              string
+		gstin             string
+		wantLines         []PriceLineItem
+		wantPlatformLines []PriceLineItem
+	}{
+		{"registered owner", "27AAPFU0939F1ZV", []PriceLineItem{rental, cleaning, fee, tax}, nil},
+		{"unregistered owner", "", []PriceLineItem{rental, cleaning}, []PriceLineItem{fee, tax}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Amounts set before are replaced
+			invoice := &Invoice{Lines: []PriceLineItem{rental}, Taxable: 1, Tax: 1}
+			invoice.setAmounts(booking, tt.gstin)
+			if invoice.SupplierGSTIN != tt.gstin {
+				t.Errorf("SupplierGSTIN = %q, want %q", invoice.SupplierGSTIN, tt.gstin)
+			}
+			if !reflect.DeepEqual(invoice.Lines, tt.wantLines) {
+				t.Errorf("Lines = %v, want %v", invoice.Lines, tt.wantLines)
+			}
+			if !reflect.DeepEqual(invoice.PlatformLines, tt.wantPlatformLines) {
+				t.Errorf("PlatformLines = %v, want %v", invoice.PlatformLines, tt.wantPlatformLines)
+			}
+			if invoice.Taxable != 3350.01 || invoice.Tax != 567 || invoice.Total != 3917 {
+				t.Errorf("taxable, tax, total = %v, %v, %v, want 3350.01, 567, 3917", invoice.Taxable, invoice.Tax, invoice.Total)
+			}
+		})
+	}
+}
+
+func TestConfirmedAt(t *testing.T) {
+	created := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	confirmed := created.Add(2 * time.Hour)
+	tests := []struct {
+		name    string
+		history []StatusChange
+		want    time.Time
+	}{
+		{"never confirmed", nil, created},
+		{"confirmed", []StatusChange{{To: StatusConfirmed, At: confirmed}, {To: StatusHandedOver, At: confirmed.Add(time.Hour)}}, confirmed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			booking := &Booking{CreatedAt: created, StatusHistory: tt.history}
+			if got := confirmedAt(booking); !got.Equal(tt.want) {
+				t.Errorf("confirmedAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicySummary(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   string
+	}{
+		{PolicyFlexible, "100% of the rental is refunded when cancelling 24 hours or more before the start; " +
+			"50% of the rental is refunded when cancelling with less notice. The deposit is always refunded."},
+		{PolicyStrict, "50% of the rental is refunded when cancelling 7 days or more before the start. " +
+			"Otherwise the rental is not refunded. The deposit is always refunded."},
+		{"", "100% of the rental is refunded when cancelling 24 hours or more before the start; " +
+			"50% of the rental is refunded when cancelling with less notice. The deposit is always refunded."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			if got := policySummary(tt.policy); got != tt.want {
+				t.Errorf("policySummary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHumanDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{30 * time.Minute, "30 minutes"},
+		{time.Minute, "1 minute"},
+		{time.Hour, "1 hour"},
+		{24 * time.Hour, "24 hours"},
+		{48 * time.Hour, "2 days"},
+		{7 * 24 * time.Hour, "7 days"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := humanDuration(tt.d); got != tt.want {
+				t.Errorf("humanDuration() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAgreementTerms(t *testing.T) {
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	booking := &Booking{StartDate: start, EndDate: start.AddDate(0, 0, 3), CancellationPolicy: PolicyModerate}
+	withDeposit := &Booking{StartDate: start, EndDate: start.AddDate(0, 0, 3), Deposit: &Deposit{Amount: 2000}}
+	lateFee := &Item{LateFee: &LateFeeRule{Amount: 100, Unit: "hour"}}
+
+	tests := []struct {
+		name     string
+		booking  *Booking
+		item     *Item
+		want     []string
+		wantNone []string
+	}{
+		{"plain", booking, &Item{}, []string{"from 01 Mar 2025 10:00 to 04 Mar 2025 10:00", "Cancellation: 100%"}, []string{"security deposit", "grace period"}},
+		{"deposit", withDeposit, &Item{}, []string{"security deposit of ₹2000.00"}, []string{"grace period"}},
+		{"late fee", booking, lateFee, []string{"₹100.00 per started hour after a grace period of 30 minutes"}, []string{"security deposit"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Join(agreementTerms(tt.booking, tt.item), "\n")
+			for _, s := range tt.want {
+				if !strings.Contains(got, s) {
+					t.Errorf("agreementTerms() = %q, want it to contain %q", got, s)
+				}
+			}
+			for _, s := range tt.wantNone {
+				if strings.Contains(got, s) {
+					t.Errorf("agreementTerms() = %q, want it not to contain %q", got, s)
+				}
+			}
+		})
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  []string
+	}{
+		{"", 10, []string{""}},
+		{"short", 10, []string{"short"}},
+		{"one two three four", 9, []string{"one two", "three", "four"}},
+		{"unbreakablewordhere ok", 5, []string{"unbreakablewordhere", "ok"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			if got := wrapText(tt.s, tt.width); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("wrapText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPDFString(t *testing.T) {
+	if got, want := escapePDF(pdfString("₹1,200 (incl.\tGST) — ok")), `Rs. 1,200 \(incl. GST\) ? ok`; got != want {
+		t.Errorf("escapePDF(pdfString()) = %q, want %q", got, want)
+	}
+}
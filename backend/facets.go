@@ -0,0 +1,274 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	// maxFacetValues caps the brands and sub-categories counted
+	maxFacetValues = 20
+
+	// maxAttributeFilters caps the attr.* parameters of one search
+	maxAttributeFilters = 10
+)
+
+// priceBuckets are the lower bounds of the price ranges counted for the
+// price facet. Prices are per the item's price unit.
+var priceBuckets = []float64{0, 250, 500, 1000, 2500, 5000}
+
+// Facets that are counted. Each is counted with every filter applied but
+// its own, so the app can offer the other values of a facet being filtered.
+const (
+	facetBrand       = "brand"
+	facetSubCategory = "subCategory"
+	facetPrice       = "price"
+)
+
+// itemFilters are the filters of an item search beyond category and text
+type itemFilters struct {
+	Facets map[string]bson.M // per counted facet
+	Other  bson.M            // model, attributes and rating
+}
+
+// splitValues splits a comma-separated parameter, dropping empty values
+func splitValues(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// validAttributeKey reports whether key can be used in a field path
+func validAttributeKey(key string) bool {
+	if key == "" || len(key) > 50 {
+		return false
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == ' ') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseItemFilters reads the filters of an item search:
+//
+//	subCategory=a,b   brand=a,b   model=x
+//	minPrice=100      maxPrice=1000
+//	minRating=4
+//	attr.<key>=a,b    e.g. attr.color=Black
+//
+// Several comma-separated values match any of them.
+func parseItemFilters(q url.Values) (*itemFilters, error) {
+	filters := &itemFilters{Facets: map[string]bson.M{}, Other: bson.M{}}
+
+	if values := splitValues(q.Get("subCategory")); len(values) > 0 {
+		filters.Facets[facetSubCategory] = bson.M{"subCategory": bson.M{"$in": values}}
+	}
+	if values := splitValues(q.Get("brand")); len(values) > 0 {
+		filters.Facets[facetBrand] = bson.M{"brand": bson.M{"$in": values}}
+	}
+	if model := strings.TrimSpace(q.Get("model")); model != "" {
+		filters.Other["model"] = model
+	}
+
+	price := bson.M{}
+	minPrice := 0.0
+	if v := q.Get("minPrice"); v != "" {
+		p, err := strconv.ParseFloat(v, 64)
+		if err != nil || p < 0 {
+			return nil, errors.New("minPrice must be a number, 0 or more")
+		}
+		minPrice = p
+		price["$gte"] = p
+	}
+	if v := q.Get("maxPrice"); v != "" {
+		p, err := strconv.ParseFloat(v, 64)
+		if err != nil || p < minPrice {
+			return nil, errors.New("maxPrice must be a number, at least minPrice")
+		}
+		price["$lte"] = p
+	}
+	if len(price) > 0 {
+		filters.Facets[facetPrice] = bson.M{"price": price}
+	}
+
+	if v := q.Get("minRating"); v != "" {
+		rating, err := strconv.ParseFloat(v, 64)
+		if err != nil || rating < 0 || rating > 5 {
+			return nil, errors.New("minRating must be between 0 and 5")
+		}
+		filters.Other["rating"] = bson.M{"$gte": rating}
+	}
+
+	attributes := 0
+	for param, values := range q {
+		key, ok := strings.CutPrefix(param, "attr.")
+		if !ok {
+			continue
+		}
+		if !validAttributeKey(key) {
+			return nil, errors.New("Invalid attribute name: " + key)
+		}
+		if attributes++; attributes > maxAttributeFilters {
+			return nil, errors.New("Too many attribute filters")
+		}
+		var matches []string
+		for _, v := range values {
+			matches = append(matches, splitValues(v)...)
+		}
+		if len(matches) > 0 {
+			filters.Other["attributes."+key] = bson.M{"$in": matches}
+		}
+	}
+	return filters, nil
+}
+
+// applyOther adds the filters that aren't counted as facets to filter
+func (f *itemFilters) applyOther(filter bson.M) {
+	for k, v := range f.Other {
+		filter[k] = v
+	}
+}
+
+// applyFacets adds the facet filters to filter
+func (f *itemFilters) applyFacets(filter bson.M) {
+	for _, cond := range f.Facets {
+		for k, v := range cond {
+			filter[k] = v
+		}
+	}
+}
+
+// except returns the facet filters other than facet's, for counting it
+func (f *itemFilters) except(facet string) bson.M {
+	filter := bson.M{}
+	for name, cond := range f.Facets {
+		if name == facet {
+			continue
+		}
+		for k, v := range cond {
+			filter[k] = v
+		}
+	}
+	return filter
+}
+
+// narrowToText restricts a facet scope to the items a text search matches,
+// by the text index or, when that finds nothing, as findItemsMatching does
+func narrowToText(ctx context.Context, q *textQuery, scope bson.M) (bson.M, error) {
+	textScope := bson.M{"$text": bson.M{"$search": strings.Join(q.Words, " ")}}
+	for k, v := range scope {
+		textScope[k] = v
+	}
+	n, err := GetCollection("items").CountDocuments(ctx, textScope)
+	if err != nil || n > 0 {
+		return textScope, err
+	}
+
+	ids, err := textMatchIDs(ctx, q, scope)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{"$and": []bson.M{scope, {"_id": bson.M{"$in": ids}}}}, nil
+}
+
+// FacetValue is a value of a facet and how many items have it
+type FacetValue struct {
+	Value string `json:"value" bson:"_id"`
+	Count int64  `json:"count" bson:"count"`
+}
+
+// PriceBucket is a price range and how many items are priced in it
+type PriceBucket struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max,omitempty"` // exclusive, none for the top bucket
+	Count int64    `json:"count"`
+}
+
+// ItemFacets are the counts the app builds filter chips from
+type ItemFacets struct {
+	Brands        []FacetValue  `json:"brands"`
+	SubCategories []FacetValue  `json:"subCategories"`
+	Prices        []PriceBucket `json:"prices"`
+}
+
+// valueFacet counts the items per value of field
+func valueFacet(field string, filter bson.M) bson.A {
+	return bson.A{
+		bson.M{"$match": filter},
+		bson.M{"$match": bson.M{field: bson.M{"$nin": bson.A{nil, ""}}}},
+		bson.M{"$group": bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}},
+		bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+		bson.M{"$limit": maxFacetValues},
+	}
+}
+
+// itemFacets counts brands, sub-categories and price buckets in one
+// aggregation over the items matching scope, which holds every filter of
+// the search but the facet filters in f
+func itemFacets(ctx context.Context, scope bson.M, f *itemFilters) (*ItemFacets, error) {
+	cursor, err := GetCollection("items").Aggregate(ctx, bson.A{
+		bson.M{"$match": scope},
+		bson.M{"$facet": bson.M{
+			"brands":        valueFacet("brand", f.except(facetBrand)),
+			"subCategories": valueFacet("subCategory", f.except(facetSubCategory)),
+			"prices": bson.A{
+				bson.M{"$match": f.except(facetPrice)},
+				bson.M{"$bucket": bson.M{
+					"groupBy":    "$price",
+					"boundaries": priceBuckets,
+					"default":    priceBuckets[len(priceBuckets)-1],
+					"output":     bson.M{"count": bson.M{"$sum": 1}},
+				}},
+			},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Brands        []FacetValue `bson:"brands"`
+		SubCategories []FacetValue `bson:"subCategories"`
+		Prices        []struct {
+			Min   float64 `bson:"_id"`
+			Count int64   `bson:"count"`
+		} `bson:"prices"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, err
+	}
+
+	facets := &ItemFacets{Brands: []FacetValue{}, SubCategories: []FacetValue{}, Prices: []PriceBucket{}}
+	if len(result) == 0 {
+		return facets, nil
+	}
+	if result[0].Brands != nil {
+		facets.Brands = result[0].Brands
+	}
+	if result[0].SubCategories != nil {
+		facets.SubCategories = result[0].SubCategories
+	}
+	for _, b := range result[0].Prices {
+		bucket := PriceBucket{Min: b.Min, Count: b.Count}
+		for i, bound := range priceBuckets[:len(priceBuckets)-1] {
+			if bound == b.Min {
+				max := priceBuckets[i+1]
+				bucket.Max = &max
+			}
+		}
+		facets.Prices = append(facets.Prices, bucket)
+	}
+	return facets, nil
+}
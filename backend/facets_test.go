@@ -0,0 +1,158 @@
+package backend
+
+import (
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSplitValues(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{"Canon", []string{"Canon"}},
+		{"Canon, Nikon", []string{"Canon", "Nikon"}},
+		{" ,Canon,, ", []string{"Canon"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := splitValues(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitValues() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidAttributeKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"color", true},
+		{"lens_mount", true},
+		{"Screen Size", true},
+		{"", false},
+		{"a.b", false},
+		{"$where", false},
+		{string(make([]byte, 51)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := validAttributeKey(tt.key); got != tt.want {
+				t.Errorf("validAttributeKey(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseItemFilters(t *testing.T) {
+	tooMany := url.Values{}
+	for i := 0; i <= maxAttributeFilters; i++ {
+		tooMany.Set("attr.key"+strconv.Itoa(i), "x")
+	}
+
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantFacets map[string]bson.M
+		wantOther  bson.M
+		wantErr    bool
+	}{
+		{
+			name:       "none",
+			query:      url.Values{"category": {"Electronics"}},
+			wantFacets: map[string]bson.M{},
+			wantOther:  bson.M{},
+		},
+		{
+			name:  "facets",
+			query: url.Values{"brand": {"Canon,Nikon"}, "subCategory": {"Cameras"}, "minPrice": {"100"}, "maxPrice": {"1000"}},
+			wantFacets: map[string]bson.M{
+				facetBrand:       {"brand": bson.M{"$in": []string{"Canon", "Nikon"}}},
+				facetSubCategory: {"subCategory": bson.M{"$in": []string{"Cameras"}}},
+				facetPrice:       {"price": bson.M{"$gte": 100.0, "$lte": 1000.0}},
+			},
+			wantOther: bson.M{},
+		},
+		{
+			name:       "other filters",
+			query:      url.Values{"model": {" EOS R6 "}, "minRating": {"4"}, "attr.color": {"Black,Grey", "White"}},
+			wantFacets: map[string]bson.M{},
+			wantOther: bson.M{
+				"model":            "EOS R6",
+				"rating":           bson.M{"$gte": 4.0},
+				"attributes.color": bson.M{"$in": []string{"Black", "Grey", "White"}},
+			},
+		},
+		{
+			name:       "empty values are ignored",
+			query:      url.Values{"brand": {" , "}, "attr.color": {""}},
+			wantFacets: map[string]bson.M{},
+			wantOther:  bson.M{},
+		},
+		{name: "negative min price", query: url.Values{"minPrice": {"-1"}}, wantErr: true},
+		{name: "max below min", query: url.Values{"minPrice": {"500"}, "maxPrice": {"100"}}, wantErr: true},
+		{name: "price not a number", query: url.Values{"maxPrice": {"cheap"}}, wantErr: true},
+		{name: "rating above 5", query: url.Values{"minRating": {"6"}}, wantErr: true},
+		{name: "attribute name with operators", query: url.Values{"attr.$where": {"1"}}, wantErr: true},
+		{name: "nested attribute name", query: url.Values{"attr.a.b": {"1"}}, wantErr: true},
+		{name: "too many attributes", query: tooMany, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseItemFilters(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseItemFilters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got.Facets, tt.wantFacets) {
+				t.Errorf("Facets = %v, want %v", got.Facets, tt.wantFacets)
+			}
+			if !reflect.DeepEqual(got.Other, tt.wantOther) {
+				t.Errorf("Other = %v, want %v", got.Other, tt.wantOther)
+			}
+		})
+	}
+}
+
+func TestItemFiltersExcept(t *testing.T) {
+	f, err := parseItemFilters(url.Values{"brand": {"Canon"}, "subCategory": {"Cameras"}, "minPrice": {"100"}, "minRating": {"4"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	brand := bson.M{"$in": []string{"Canon"}}
+	subCategory := bson.M{"$in": []string{"Cameras"}}
+	price := bson.M{"$gte": 100.0}
+
+	tests := []struct {
+		facet string
+		want  bson.M
+	}{
+		{facetBrand, bson.M{"subCategory": subCategory, "price": price}},
+		{facetSubCategory, bson.M{"brand": brand, "price": price}},
+		{facetPrice, bson.M{"brand": brand, "subCategory": subCategory}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.facet, func(t *testing.T) {
+			if got := f.except(tt.facet); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("except() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The rating isn't a facet, so it is only added by applyOther
+	filter := bson.M{"status": "active"}
+	f.applyOther(filter)
+	f.applyFacets(filter)
+	want := bson.M{"status": "active", "rating": bson.M{"$gte": 4.0}, "brand": brand, "subCategory": subCategory, "price": price}
+	if !reflect.DeepEqual(filter, want) {
+		t.Errorf("applyOther and applyFacets = %v, want %v", filter, want)
+	}
+}
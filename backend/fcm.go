@@ -159,12 +159,108 @@ func SendBookingPushNotification(recipientID primitive.ObjectID, action, itemTit
 	case "confirmed":
 		title = "Booking Confirmed!"
 		body = "Your booking for " + itemTitle + " has been confirmed"
+	case "instant_booked":
+		title = "New Instant Booking"
+		body = itemTitle + " has been booked and paid for with Instant Book"
+	case "offer_accepted":
+		title = "Offer Accepted"
+		body = "Your offer for " + itemTitle + " was accepted. Pay now to confirm the booking"
+	case "counter_accepted":
+		title = "Counter-Offer Accepted"
+		body = "The renter accepted your counter-offer for " + itemTitle + " and will pay to confirm it"
+	case "offer_booked":
+		title = "Negotiated Booking Paid"
+		body = itemTitle + " has been booked and paid for at the price you agreed"
+	case "subscription_renewed":
+		title = "Subscription Renewed"
+		body = "Another month of " + itemTitle + " has been paid for"
+	case "subscription_payment_due":
+		title = "Subscription Payment Due"
+		body = "Pay for next month of " + itemTitle + " to keep your subscription going"
+	case "subscription_lapsed":
+		title = "Subscription Not Renewed"
+		body = "Next month of " + itemTitle + " wasn't paid for, so the subscription ends with the current month"
+	case "subscription_ending":
+		title = "Subscription Ending"
+		body = "Notice has been given on the subscription for " + itemTitle
+	case "subscription_ended":
+		title = "Subscription Ended"
+		body = "The subscription for " + itemTitle + " has ended"
 	case "rejected":
 		title = "Booking Rejected"
 		body = "Your booking for " + itemTitle + " was not approved"
 	case "cancelled":
 		title = "Booking Cancelled"
 		body = "A booking for " + itemTitle + " has been cancelled"
+	case "handed_over":
+		title = "Item Handed Over"
+		body = itemTitle + " has been handed over. Enjoy your rental!"
+	case "returned":
+		title = "Item Returned"
+		body = itemTitle + " has been marked as returned"
+	case "completed":
+		title = "Rental Completed"
+		body = "Your rental of " + itemTitle + " is complete"
+	case "expired":
+		title = "Booking Request Expired"
+		body = "A booking request for " + itemTitle + " expired before it was confirmed"
+	case "response_timeout":
+		title = "Booking Request Declined"
+		body = "The owner of " + itemTitle + " didn't respond in time. Try another listing"
+	case "response_missed":
+		title = "Booking Request Missed"
+		body = "A booking request for " + itemTitle + " was declined because you didn't respond in time"
+	case "agreement_ready":
+		title = "Rental Agreement Ready"
+		body = "The rental agreement for " + itemTitle + " is ready to download"
+	case "invoice_ready":
+		title = "Invoice Ready"
+		body = "Your tax invoice for " + itemTitle + " is ready to download"
+	case "payment_received":
+		title = "Payment Received"
+		body = "Payment for the booking of " + itemTitle + " has been received"
+	case "payment_partial":
+		title = "Payment Incomplete"
+		body = "Your payment for " + itemTitle + " didn't cover the full amount. Please pay the rest"
+	case "modification_requested":
+		title = "Change Requested"
+		body = "The renter of " + itemTitle + " has asked to change the booking dates"
+	case "modification_accepted":
+		title = "Change Accepted"
+		body = "Your new dates for " + itemTitle + " have been accepted"
+	case "modification_rejected":
+		title = "Change Declined"
+		body = "The owner declined your new dates for " + itemTitle
+	case "overdue":
+		title = "Rental Overdue"
+		body = itemTitle + " was due back and hasn't been returned yet"
+	case "overdue_reminder":
+		title = "Rental Still Overdue"
+		body = itemTitle + " is still overdue. Late fees are adding up"
+	case "overdue_escalated":
+		title = "Rental Seriously Overdue"
+		body = itemTitle + " is more than a day overdue. Please arrange the return now"
+	case "refund_processed":
+		title = "Refund Processed"
+		body = "Your refund for " + itemTitle + " is on its way"
+	case "deposit_claim_filed":
+		title = "Damage Claim Filed"
+		body = "The owner of " + itemTitle + " has filed a claim against your deposit"
+	case "deposit_claim_accepted":
+		title = "Damage Claim Accepted"
+		body = "The renter accepted your damage claim for " + itemTitle
+	case "deposit_claim_disputed":
+		title = "Damage Claim Disputed"
+		body = "The renter disputed your damage claim for " + itemTitle
+	case "deposit_claim_lapsed":
+		title = "Damage Claim Accepted"
+		body = "The damage claim for " + itemTitle + " wasn't answered in time and has been accepted"
+	case "deposit_claim_resolved":
+		title = "Damage Claim Resolved"
+		body = "Support has resolved the damage claim for " + itemTitle
+	case "deposit_released":
+		title = "Deposit Released"
+		body = "Your deposit for " + itemTitle + " has been released"
 	default:
 		title = "Booking Update"
 		body = "There's an update on your booking for " + itemTitle
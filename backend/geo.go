@@ -0,0 +1,186 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	earthRadiusKm = 6378.1
+
+	// Search radius around lat/lng when none is given, and the most allowed
+	defaultSearchRadiusKm = 10.0
+	maxSearchRadiusKm     = 100.0
+
+	// Decimal places item coordinates are rounded to in responses. Two
+	// places is about a kilometre, enough to place an item on a map without
+	// giving away the owner's address.
+	publicCoordinatePlaces = 2
+)
+
+// newGeoPoint validates coordinates and turns them into a GeoJSON point
+func newGeoPoint(c *Coordinates) (*GeoPoint, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.Lat < -90 || c.Lat > 90 {
+		return nil, errors.New("Latitude must be between -90 and 90")
+	}
+	if c.Lng < -180 || c.Lng > 180 {
+		return nil, errors.New("Longitude must be between -180 and 180")
+	}
+	return &GeoPoint{Type: "Point", Coordinates: []float64{c.Lng, c.Lat}}, nil
+}
+
+// roundCoordinate rounds to publicCoordinatePlaces decimal places
+func roundCoordinate(v float64) float64 {
+	scale := math.Pow(10, publicCoordinatePlaces)
+	return math.Round(v*scale) / scale
+}
+
+// publicLocation sets the coordinates returned for an item from its stored
+// point, rounded so the exact spot stays private
+func (item *Item) publicLocation() {
+	item.Coordinates = nil
+	if item.Geo == nil || len(item.Geo.Coordinates) != 2 {
+		return
+	}
+	item.Coordinates = &Coordinates{
+		Lat: roundCoordinate(item.Geo.Coordinates[1]),
+		Lng: roundCoordinate(item.Geo.Coordinates[0]),
+	}
+}
+
+// geoQuery is the location part of an item search
+type geoQuery struct {
+	Near     *GeoPoint // sort by distance from here
+	RadiusKm float64
+	Box      bson.M // $geometry of a map view, nil for none
+}
+
+// parseGeoQuery reads lat, lng and radius (km), and bbox
+// (minLng,minLat,maxLng,maxLat) from a search query. It returns nil when
+// neither is given.
+func parseGeoQuery(q url.Values) (*geoQuery, error) {
+	var query geoQuery
+
+	if q.Get("lat") != "" || q.Get("lng") != "" {
+		lat, errLat := strconv.ParseFloat(q.Get("lat"), 64)
+		lng, errLng := strconv.ParseFloat(q.Get("lng"), 64)
+		if errLat != nil || errLng != nil {
+			return nil, errors.New("lat and lng must both be numbers")
+		}
+		near, err := newGeoPoint(&Coordinates{Lat: lat, Lng: lng})
+		if err != nil {
+			return nil, err
+		}
+		query.Near = near
+
+		query.RadiusKm = defaultSearchRadiusKm
+		if v := q.Get("radius"); v != "" {
+			radius, err := strconv.ParseFloat(v, 64)
+			if err != nil || radius <= 0 || radius > maxSearchRadiusKm {
+				return nil, errors.New("radius must be between 0 and 100 km")
+			}
+			query.RadiusKm = radius
+		}
+	}
+
+	if v := q.Get("bbox"); v != "" {
+		box, err := parseBoundingBox(v)
+		if err != nil {
+			return nil, err
+		}
+		query.Box = box
+	}
+
+	if query.Near == nil && query.Box == nil {
+		return nil, nil
+	}
+	return &query, nil
+}
+
+// parseBoundingBox turns "minLng,minLat,maxLng,maxLat" into a GeoJSON polygon
+func parseBoundingBox(value string) (bson.M, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return nil, errors.New("bbox must be minLng,minLat,maxLng,maxLat")
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, errors.New("bbox must be minLng,minLat,maxLng,maxLat")
+		}
+		v[i] = f
+	}
+	minLng, minLat, maxLng, maxLat := v[0], v[1], v[2], v[3]
+	if minLng < -180 || maxLng > 180 || minLat < -90 || maxLat > 90 || minLng >= maxLng || minLat >= maxLat {
+		return nil, errors.New("bbox is out of range or empty")
+	}
+	return bson.M{
+		"type": "Polygon",
+		"coordinates": [][][]float64{{
+			{minLng, minLat}, {maxLng, minLat}, {maxLng, maxLat}, {minLng, maxLat}, {minLng, minLat},
+		}},
+	}, nil
+}
+
+// apply adds the bounding box of the query to an item filter. The radius
+// around lat/lng is applied by findItemsNear.
+func (q *geoQuery) apply(filter bson.M) {
+	if q.Box != nil {
+		filter["geo"] = bson.M{"$geoWithin": bson.M{"$geometry": q.Box}}
+	}
+}
+
+// withinRadius narrows filter to the items findItemsNear would return, for
+// counting them
+func (q *geoQuery) withinRadius(filter bson.M) bson.M {
+	return bson.M{"$and": []bson.M{filter, {"geo": bson.M{"$geoWithin": bson.M{
+		"$centerSphere": bson.A{q.Near.Coordinates, q.RadiusKm / earthRadiusKm},
+	}}}}}
+}
+
+// findItemsNear returns the items matching filter within the query's radius,
+// nearest first, with their distance set
+func findItemsNear(ctx context.Context, q *geoQuery, filter bson.M, skip, limit int64) ([]Item, error) {
+	cursor, err := GetCollection("items").Aggregate(ctx, bson.A{
+		bson.M{"$geoNear": bson.M{
+			"near":          q.Near,
+			"key":           "geo",
+			"distanceField": "distance",
+			"maxDistance":   q.RadiusKm * 1000,
+			"spherical":     true,
+			"query":         filter,
+		}},
+		bson.M{"$skip": skip},
+		bson.M{"$limit": limit},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Item     `bson:",inline"`
+		Distance float64 `bson:"distance"` // metres
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	items := make([]Item, 0, len(results))
+	for _, r := range results {
+		km := math.Round(r.Distance/10) / 100
+		r.Item.Distance = &km
+		items = append(items, r.Item)
+	}
+	return items, nil
+}
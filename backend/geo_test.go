@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseBoundingBox(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    [][][]float64
+		wantErr bool
+	}{
+		{
+			name:  "valid",
+			value: "72.8,18.9,73.0,19.1",
+			want:  [][][]float64{{{72.8, 18.9}, {73.0, 18.9}, {73.0, 19.1}, {72.8, 19.1}, {72.8, 18.9}}},
+		},
+		{
+			name:  "spaces around values",
+			value: " 72.8, 18.9 ,73, 19.1",
+			want:  [][][]float64{{{72.8, 18.9}, {73, 18.9}, {73, 19.1}, {72.8, 19.1}, {72.8, 18.9}}},
+		},
+		{
+			name:  "whole world",
+			value: "-180,-90,180,90",
+			want:  [][][]float64{{{-180, -90}, {180, -90}, {180, 90}, {-180, 90}, {-180, -90}}},
+		},
+		{name: "too few values", value: "72.8,18.9,73.0", wantErr: true},
+		{name: "too many values", value: "72.8,18.9,73.0,19.1,5", wantErr: true},
+		{name: "not a number", value: "72.8,north,73.0,19.1", wantErr: true},
+		{name: "longitude out of range", value: "-181,18.9,73.0,19.1", wantErr: true},
+		{name: "latitude out of range", value: "72.8,18.9,73.0,91", wantErr: true},
+		{name: "corners swapped", value: "73.0,19.1,72.8,18.9", wantErr: true},
+		{name: "empty box", value: "72.8,18.9,72.8,19.1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBoundingBox(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseBoundingBox() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseBoundingBox() error = %v", err)
+			}
+			want := bson.M{"type": "Polygon", "coordinates": tt.want}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parseBoundingBox() = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package backend
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// maxOTPAttempts is how many wrong codes are accepted before the renter has
+// to issue a new one
+const maxOTPAttempts = 5
+
+// newOTP returns a random 6 digit code
+func newOTP() string {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%06d", n.Int64())
+}
+
+// isMotorVehicle reports whether an item is a vehicle with an odometer, for
+// which handover and return checklists must record the reading
+func isMotorVehicle(item *Item) bool {
+	switch item.Category {
+	case "Automobile":
+		return item.SubCategory != "Spare Parts & Accessories"
+	case "Bikes":
+		return item.SubCategory != "Bicycles"
+	}
+	return false
+}
+
+// handoverTransitionFields returns the handover updates that go with a
+// booking status change: confirming a booking issues the pickup and return
+// codes the renter shares with the owner.
+func handoverTransitionFields(booking *Booking, to string) bson.M {
+	if to != StatusConfirmed || booking.Pickup != nil {
+		return nil
+	}
+	return bson.M{
+		"pickup": HandoverStep{OTP: newOTP()},
+		"return": HandoverStep{OTP: newOTP()},
+	}
+}
+
+// validateChecklist checks a condition checklist submitted for item
+func validateChecklist(c *ConditionChecklist, item *Item) error {
+	if c == nil {
+		return errors.New("A condition checklist is required")
+	}
+	if len(c.Photos) == 0 {
+		return errors.New("At least one photo of the item is required")
+	}
+	if isMotorVehicle(item) {
+		if _, ok := c.Readings["odometer"]; !ok {
+			return errors.New("An odometer reading is required for vehicles")
+		}
+	}
+	return nil
+}
+
+// handoverStep returns the step a booking in status is waiting on, with the
+// status it moves to and its field name
+func handoverStep(booking *Booking, status string) (*HandoverStep, string, string) {
+	switch status {
+	case StatusConfirmed:
+		return booking.Pickup, StatusHandedOver, "pickup"
+	case StatusHandedOver:
+		return booking.Return, StatusReturned, "return"
+	}
+	return nil, "", ""
+}
+
+// recordHandover lets the owner hand over or take back an item. The owner
+// enters the code the renter shares with them and records the item's
+// condition, which moves the booking to handed_over or returned.
+func recordHandover(w http.ResponseWriter, r *http.Request, id, step string) {
+	userID, _ := GetUserID(r)
+
+	var req struct {
+		OTP       string             `json:"otp"`
+		Checklist ConditionChecklist `json:"checklist"`
+	}
+	if err := DecodeJSON(r, &req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	booking, role, ok := findBookingForUser(ctx, w, id, userID)
+	if !ok {
+		return
+	}
+	if role != RoleOwner {
+		JSONError(w, http.StatusForbidden, "Only the owner can record the "+step)
+		return
+	}
+
+	current, to, field := handoverStep(booking, booking.Status)
+	if field != step || current == nil {
+		JSONError(w, http.StatusConflict, "Cannot record the "+step+" of a "+booking.Status+" booking")
+		return
+	}
+	if current.Attempts >= maxOTPAttempts {
+		JSONError(w, http.StatusTooManyRequests, "Too many incorrect codes, ask the renter to issue a new one")
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(req.OTP), []byte(current.OTP)) != 1 {
+		GetCollection("bookings").UpdateOne(ctx, bson.M{"_id": booking.ID}, bson.M{"$inc": bson.M{field + ".attempts": 1}})
+		JSONError(w, http.StatusBadRequest, "Incorrect code")
+		return
+	}
+
+	var item Item
+	GetCollection("items").FindOne(ctx, bson.M{"_id": booking.ItemID}).Decode(&item)
+	if err := validateChecklist(&req.Checklist, &item); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if step == "return" && booking.Pickup != nil && booking.Pickup.Checklist != nil {
+		if before, ok := booking.Pickup.Checklist.Readings["odometer"]; ok && req.Checklist.Readings["odometer"] < before {
+			JSONError(w, http.StatusBadRequest, "Odometer reading is lower than at pickup")
+			return
+		}
+	}
+
+	now := time.Now()
+	extra := bson.M{
+		field + ".checklist":  req.Checklist,
+		field + ".verifiedBy": userID,
+		field + ".verifiedAt": now,
+	}
+	if step == "return" {
+		for k, v := range lateFeeSettlementFields(booking, &item, now) {
+			extra[k] = v
+		}
+	}
+
+	if err := transitionBooking(ctx, booking, to, RoleOwner, userID, "", extra); err != nil {
+		var te *transitionError
+		if errors.As(err, &te) {
+			JSONError(w, te.Code, te.Message)
+			return
+		}
+		JSONError(w, http.StatusInternalServerError, "Failed to record "+step)
+		return
+	}
+
+	GetCollection("bookings").FindOne(ctx, bson.M{"_id": booking.ID}).Decode(booking)
+	notifyBookingStatus(ctx, booking, booking.RenterID)
+
+	JSON(w, http.StatusOK, map[string]interface{}{"message": "Booking " + booking.Status, "booking": booking})
+}
+
+// getHandoverCodes returns the renter's pickup and return codes. POST issues
+// a new code for the next step, e.g. after too many wrong attempts.
+func getHandoverCodes(w http.ResponseWriter, r *http.Request, id string) {
+	userID, _ := GetUserID(r)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	booking, role, ok := findBookingForUser(ctx, w, id, userID)
+	if !ok {
+		return
+	}
+	if role != RoleRenter {
+		JSONError(w, http.StatusForbidden, "Only the renter can see the handover codes")
+		return
+	}
+
+	current, _, field := handoverStep(booking, booking.Status)
+	if field == "" {
+		JSONError(w, http.StatusConflict, "No handover is due for a "+booking.Status+" booking")
+		return
+	}
+	// Bookings confirmed before codes were issued get one on request
+	if current == nil {
+		if r.Method != http.MethodPost {
+			JSONError(w, http.StatusNotFound, "No code has been issued yet")
+			return
+		}
+		current = &HandoverStep{}
+	}
+
+	if r.Method == http.MethodPost {
+		current.OTP = newOTP()
+		current.Attempts = 0
+		_, err := GetCollection("bookings").UpdateOne(ctx,
+			bson.M{"_id": booking.ID, "status": booking.Status},
+			bson.M{"$set": bson.M{field + ".otp": current.OTP, field + ".attempts": 0, "updatedAt": time.Now()}},
+		)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to issue a new code")
+			return
+		}
+	}
+
+	// Only the code for the next step is shown, so the return code can't be
+	// given away at pickup
+	JSON(w, http.StatusOK, map[string]interface{}{"step": field, "otp": current.OTP})
+}
+
+// handoverRecords returns the pickup and return checklists of a booking, the
+// evidence a deposit claim is judged against
+func handoverRecords(booking *Booking) map[string]*ConditionChecklist {
+	records := map[string]*ConditionChecklist{}
+	if booking.Pickup != nil && booking.Pickup.Checklist != nil {
+		records["pickup"] = booking.Pickup.Checklist
+	}
+	if booking.Return != nil && booking.Return.Checklist != nil {
+		records["return"] = booking.Return.Checklist
+	}
+	return records
+}
@@ -0,0 +1,146 @@
+package backend
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNewOTP(t *testing.T) {
+	sixDigits := regexp.MustCompile(`^\d{6}$`)
+	for i := 0; i < 100; i++ {
+		if otp := newOTP(); !sixDigits.MatchString(otp) {
+			t.Fatalf("newOTP() = %q, want 6 digits", otp)
+		}
+	}
+}
+
+func TestIsMotorVehicle(t *testing.T) {
+	tests := []struct {
+		category, subCategory string
+		want                  bool
+	}{
+		{"Automobile", "Cars", true},
+		{"Automobile", "Spare Parts & Accessories", false},
+		{"Bikes", "Scooters", true},
+		{"Bikes", "Bicycles", false},
+		{"Electronics", "Cameras", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.category+"/"+tt.subCategory, func(t *testing.T) {
+			item := &Item{Category: tt.category, SubCategory: tt.subCategory}
+			if got := isMotorVehicle(item); got != tt.want {
+				t.Errorf("isMotorVehicle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateChecklist(t *testing.T) {
+	car := &Item{Category: "Automobile", SubCategory: "Cars"}
+	camera := &Item{Category: "Electronics", SubCategory: "Cameras"}
+	photos := []string{"front.jpg"}
+
+	tests := []struct {
+		name      string
+		checklist *ConditionChecklist
+		item      *Item
+		wantErr   bool
+	}{
+		{"missing", nil, camera, true},
+		{"no photos", &ConditionChecklist{}, camera, true},
+		{"with photos", &ConditionChecklist{Photos: photos}, camera, false},
+		{"vehicle without odometer", &ConditionChecklist{Photos: photos, Readings: map[string]float64{"fuel": 0.5}}, car, true},
+		{"vehicle with odometer", &ConditionChecklist{Photos: photos, Readings: map[string]float64{"odometer": 12040}}, car, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateChecklist(tt.checklist, tt.item); (err != nil) != tt.wantErr {
+				t.Errorf("validateChecklist() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandoverTransitionFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		booking  *Booking
+		to       string
+		wantOTPs bool
+	}{
+		{"confirmed", &Booking{Status: StatusPending}, StatusConfirmed, true},
+		{"codes already issued", &Booking{Status: StatusPending, Pickup: &HandoverStep{OTP: "123456"}}, StatusConfirmed, false},
+		{"cancelled", &Booking{Status: StatusPending}, StatusCancelled, false},
+		{"handed over", &Booking{Status: StatusConfirmed}, StatusHandedOver, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := handoverTransitionFields(tt.booking, tt.to)
+			if (got != nil) != tt.wantOTPs {
+				t.Fatalf("handoverTransitionFields() = %v, want codes %v", got, tt.wantOTPs)
+			}
+			if !tt.wantOTPs {
+				return
+			}
+			pickup, ret := got["pickup"].(HandoverStep), got["return"].(HandoverStep)
+			if pickup.OTP == "" || ret.OTP == "" {
+				t.Errorf("handoverTransitionFields() = %v, want both codes", got)
+			}
+		})
+	}
+}
+
+func TestHandoverStep(t *testing.T) {
+	booking := &Booking{Pickup: &HandoverStep{OTP: "111111"}, Return: &HandoverStep{OTP: "222222"}}
+	tests := []struct {
+		status    string
+		wantOTP   string
+		wantNext  string
+		wantField string
+	}{
+		{StatusConfirmed, "111111", StatusHandedOver, "pickup"},
+		{StatusHandedOver, "222222", StatusReturned, "return"},
+		{StatusReturned, "", "", ""},
+		{StatusPending, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			step, next, field := handoverStep(booking, tt.status)
+			otp := ""
+			if step != nil {
+				otp = step.OTP
+			}
+			if otp != tt.wantOTP || next != tt.wantNext || field != tt.wantField {
+				t.Errorf("handoverStep() = %q, %q, %q, want %q, %q, %q", otp, next, field, tt.wantOTP, tt.wantNext, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestHandoverRecords(t *testing.T) {
+	pickup := &ConditionChecklist{Photos: []string{"pickup.jpg"}}
+	ret := &ConditionChecklist{Photos: []string{"return.jpg"}}
+	tests := []struct {
+		name    string
+		booking *Booking
+		want    []string
+	}{
+		{"none", &Booking{}, nil},
+		{"code issued but not used", &Booking{Pickup: &HandoverStep{OTP: "111111"}}, nil},
+		{"picked up", &Booking{Pickup: &HandoverStep{Checklist: pickup}}, []string{"pickup"}},
+		{"returned", &Booking{Pickup: &HandoverStep{Checklist: pickup}, Return: &HandoverStep{Checklist: ret}}, []string{"pickup", "return"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := handoverRecords(tt.booking)
+			if len(got) != len(tt.want) {
+				t.Fatalf("handoverRecords() = %v, want %v", got, tt.want)
+			}
+			for _, step := range tt.want {
+				if got[step] == nil {
+					t.Errorf("handoverRecords() is missing %s", step)
+				}
+			}
+		})
+	}
+}
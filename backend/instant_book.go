@@ -0,0 +1,88 @@
+package backend
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// instantBookPaymentWindow is how long an instant booking holds the dates
+// while waiting for payment
+func instantBookPaymentWindow() time.Duration {
+	return envDuration("INSTANT_BOOK_PAYMENT_WINDOW", 30*time.Minute)
+}
+
+// qualifiesForInstantBook reports whether renterID may book item without the
+// owner's approval
+func qualifiesForInstantBook(ctx context.Context, item *Item, renterID primitive.ObjectID) bool {
+	rules := item.InstantBook
+	if rules == nil || !rules.Enabled {
+		return false
+	}
+	if rules.MinRenterRating <= 0 && !rules.RequireVerifiedID {
+		return true
+	}
+
+	var renter User
+	if err := GetCollection("users").FindOne(ctx, bson.M{"_id": renterID}).Decode(&renter); err != nil {
+		return false
+	}
+	if rules.RequireVerifiedID && !renter.IDVerified {
+		return false
+	}
+	if rules.MinRenterRating <= 0 {
+		return true
+	}
+
+	// The rating is computed from the renter's reviews rather than read from
+	// their profile. Renters nobody has rated yet don't meet a threshold.
+	rating, count, err := averageRating(ctx, "user", renterID)
+	if err != nil || count == 0 {
+		return false
+	}
+	return rating >= rules.MinRenterRating
+}
+
+// autoConfirmBooking confirms a paid instant booking, or one made from an
+// accepted chat offer, on the owner's behalf. The owner is told about it
+// rather than asked. Paid subscription renewals are confirmed the same way;
+// the subscription sends their notices.
+func autoConfirmBooking(ctx context.Context, booking *Booking) {
+	reason, action := "Instant book", "instant_booked"
+	if booking.OfferID != nil {
+		reason, action = "Accepted offer", "offer_booked"
+	}
+	if err := transitionBooking(ctx, booking, StatusConfirmed, RoleSystem, primitive.NilObjectID, reason, nil); err != nil {
+		log.Printf("Could not auto-confirm booking %s: %v", booking.ID.Hex(), err)
+		return
+	}
+	if booking.Cycle > 1 {
+		return
+	}
+
+	GetCollection("users").UpdateOne(ctx, bson.M{"_id": booking.RenterID}, bson.M{"$inc": bson.M{"totalBookings": 1}})
+
+	notifyBookingStatus(ctx, booking, booking.RenterID)
+	notifyBookingEvent(ctx, booking, booking.OwnerID, action)
+	notifyBookingEvent(ctx, booking, booking.RenterID, "agreement_ready")
+	notifyBookingEvent(ctx, booking, booking.OwnerID, "agreement_ready")
+}
+
+// expireUnpaidInstantBookings releases the dates held by instant bookings
+// that weren't paid for within the payment window. Subscription renewals can
+// be paid up to their start date instead.
+func expireUnpaidInstantBookings(ctx context.Context) error {
+	return transitionMatching(ctx,
+		bson.M{
+			"status":         StatusPending,
+			"autoConfirm":    true,
+			"subscriptionId": bson.M{"$exists": false},
+			"paymentStatus":  bson.M{"$ne": PaymentPaid},
+			"createdAt":      bson.M{"$lt": time.Now().Add(-instantBookPaymentWindow())},
+		},
+		StatusExpired, "Instant booking was not paid in time",
+	)
+}
@@ -0,0 +1,51 @@
+package backend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestQualifiesForInstantBook(t *testing.T) {
+	// Only rules that don't need the renter's profile or reviews, which would
+	// be read from the database
+	tests := []struct {
+		name  string
+		rules *InstantBookSettings
+		want  bool
+	}{
+		{"not set", nil, false},
+		{"disabled", &InstantBookSettings{Enabled: false}, false},
+		{"disabled with rules", &InstantBookSettings{Enabled: false, MinRenterRating: 4, RequireVerifiedID: true}, false},
+		{"any renter", &InstantBookSettings{Enabled: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := &Item{InstantBook: tt.rules}
+			if got := qualifiesForInstantBook(context.Background(), item, primitive.NewObjectID()); got != tt.want {
+				t.Errorf("qualifiesForInstantBook() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstantBookPaymentWindow(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 30 * time.Minute},
+		{"1h", time.Hour},
+		{"soon", 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("INSTANT_BOOK_PAYMENT_WINDOW", tt.value)
+			if got := instantBookPaymentWindow(); got != tt.want {
+				t.Errorf("instantBookPaymentWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
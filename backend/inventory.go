@@ -0,0 +1,134 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// maxItemQuantity caps the units a single listing can hold
+const maxItemQuantity = 1000
+
+// itemQuantity is the number of identical units an item has. Items listed
+// before quantities existed are single units.
+func itemQuantity(item *Item) int {
+	if item.Quantity < 1 {
+		return 1
+	}
+	return item.Quantity
+}
+
+// units is the number of units a booking rents
+func (b *Booking) units() int {
+	if b.Quantity < 1 {
+		return 1
+	}
+	return b.Quantity
+}
+
+// validateQuantity checks the unit count of an item being listed
+func validateQuantity(quantity int) error {
+	if quantity < 0 {
+		return errors.New("Quantity can't be negative")
+	}
+	if quantity > maxItemQuantity {
+		return fmt.Errorf("Quantity can't exceed %d", maxItemQuantity)
+	}
+	return nil
+}
+
+// rentalQuantity checks the units a renter asked for against what the item
+// has. Leaving it out rents one unit.
+func rentalQuantity(item *Item, quantity int) (int, error) {
+	if quantity == 0 {
+		return 1, nil
+	}
+	if quantity < 0 {
+		return 0, errors.New("Quantity must be at least 1")
+	}
+	if available := itemQuantity(item); quantity > available {
+		if available == 1 {
+			return 0, errors.New("Only 1 unit of this item is listed")
+		}
+		return 0, fmt.Errorf("Only %d units of this item are listed", available)
+	}
+	return quantity, nil
+}
+
+// unitChange is a point in time where the number of units out on rent
+// changes by delta
+type unitChange struct {
+	at    time.Time
+	delta int
+}
+
+// unitChanges turns booked ranges into a time-ordered list of changes.
+// Ranges are half-open, so at the same instant units come back before they
+// go out again.
+func unitChanges(booked []DateRange) []unitChange {
+	changes := make([]unitChange, 0, 2*len(booked))
+	for _, b := range booked {
+		if !b.End.After(b.Start) {
+			continue
+		}
+		units := b.Quantity
+		if units < 1 {
+			units = 1
+		}
+		changes = append(changes, unitChange{b.Start, units}, unitChange{b.End, -units})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].at.Equal(changes[j].at) {
+			return changes[i].delta < changes[j].delta
+		}
+		return changes[i].at.Before(changes[j].at)
+	})
+	return changes
+}
+
+// peakUnits returns the most units booked at any one time within [from, to)
+func peakUnits(booked []DateRange, from, to time.Time) int {
+	clipped := make([]DateRange, 0, len(booked))
+	for _, b := range booked {
+		if b.Start.Before(from) {
+			b.Start = from
+		}
+		if b.End.After(to) {
+			b.End = to
+		}
+		clipped = append(clipped, b)
+	}
+
+	peak, out := 0, 0
+	for _, c := range unitChanges(clipped) {
+		out += c.delta
+		if out > peak {
+			peak = out
+		}
+	}
+	return peak
+}
+
+// saturatedRanges returns the periods in which booked ranges take up at
+// least capacity units, so no unit is left to rent
+func saturatedRanges(booked []DateRange, capacity int) []DateRange {
+	ranges := []DateRange{}
+	out := 0
+	var start time.Time
+	for _, c := range unitChanges(booked) {
+		before := out
+		out += c.delta
+		switch {
+		case before < capacity && out >= capacity:
+			start = c.at
+		case before >= capacity && out < capacity:
+			if n := len(ranges); n > 0 && ranges[n-1].End.Equal(start) {
+				ranges[n-1].End = c.at
+			} else if c.at.After(start) {
+				ranges = append(ranges, DateRange{Start: start, End: c.at})
+			}
+		}
+	}
+	return ranges
+}
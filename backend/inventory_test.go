@@ -0,0 +1,38 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeakUnits(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+	r := func(start, end, quantity int) DateRange {
+		return DateRange{Start: day(start), End: day(end), Quantity: quantity}
+	}
+
+	tests := []struct {
+		name   string
+		booked []DateRange
+		want   int
+	}{
+		{"nothing booked", nil, 0},
+		{"one booking", []DateRange{r(2, 4, 2)}, 2},
+		{"no quantity counts as one unit", []DateRange{r(2, 4, 0)}, 1},
+		{"overlapping", []DateRange{r(2, 5, 1), r(3, 6, 2)}, 3},
+		{"back to back", []DateRange{r(2, 4, 2), r(4, 6, 3)}, 3},
+		{"apart", []DateRange{r(2, 3, 2), r(5, 6, 2)}, 2},
+		{"overlap before the window", []DateRange{r(-5, 2, 2), r(-4, 3, 2)}, 4},
+		{"overlap only before the window", []DateRange{r(-5, -2, 2), r(-4, 3, 2)}, 2},
+		{"overlap only after the window", []DateRange{r(8, 12, 2), r(11, 14, 2)}, 2},
+		{"entirely outside", []DateRange{r(-5, 1, 4), r(10, 12, 4)}, 0},
+		{"empty range", []DateRange{r(4, 4, 3)}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := peakUnits(tt.booked, day(1), day(10)); got != tt.want {
+				t.Errorf("peakUnits() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package backend
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -32,6 +34,20 @@ func HandleItemByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if itemID, sub, ok := strings.Cut(id, "/"); ok && (sub == "calendar" || strings.HasPrefix(sub, "calendar/")) {
+		handleItemCalendar(w, r, itemID, strings.TrimPrefix(strings.TrimPrefix(sub, "calendar"), "/"))
+		return
+	}
+
+	if strings.HasSuffix(id, "/availability") {
+		if r.Method != http.MethodGet {
+			JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		getItemAvailability(w, r, strings.TrimSuffix(id, "/availability"))
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		getItemByID(w, r, id)
@@ -69,6 +85,9 @@ func HandleMyListings(w http.ResponseWriter, r *http.Request) {
 
 	var items []Item
 	cursor.All(ctx, &items)
+	for i := range items {
+		items[i].publicLocation()
+	}
 
 	JSON(w, http.StatusOK, map[string]interface{}{
 		"items": items,
@@ -82,7 +101,7 @@ func getItems(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	filter := bson.M{}
-	
+
 	// When filtering by specific owner, show all their items
 	// Otherwise only show active items that are not currently booked
 	if ownerId := r.URL.Query().Get("ownerId"); ownerId != "" {
@@ -91,48 +110,62 @@ func getItems(w http.ResponseWriter, r *http.Request) {
 		filter["status"] = "active" // Only show active items for now
 	} else {
 		filter["status"] = "active"
-		
-		// Exclude items that have CURRENTLY active bookings
-		// - pending bookings where startDate hasn't passed yet
-		// - confirmed bookings where endDate hasn't passed yet
+
+		// With a date range, hide items booked for that range. Without one,
+		// hide only items that are out on rent right now.
 		now := time.Now()
-		bookingCol := GetCollection("bookings")
-		bookingCursor, err := bookingCol.Find(ctx, bson.M{
-			"$or": []bson.M{
-				{
-					"status": "pending",
-					"startDate": bson.M{"$gte": now}, // Pending booking with future start date
-				},
-				{
-					"status": "confirmed",
-					"endDate": bson.M{"$gte": now}, // Confirmed booking that hasn't ended yet
-				},
-			},
-		})
-		if err == nil {
-			defer bookingCursor.Close(ctx)
-			var bookedItemIDs []primitive.ObjectID
-			for bookingCursor.Next(ctx) {
-				var booking struct {
-					ItemID primitive.ObjectID `bson:"itemId"`
-				}
-				if err := bookingCursor.Decode(&booking); err == nil {
-					bookedItemIDs = append(bookedItemIDs, booking.ItemID)
-				}
+		from, to := now, now.Add(time.Second)
+		if v := r.URL.Query().Get("from"); v != "" {
+			if t, err := parseDateParam(v); err == nil {
+				from, to = t, t.AddDate(0, 0, 1)
 			}
-			if len(bookedItemIDs) > 0 {
-				filter["_id"] = bson.M{"$nin": bookedItemIDs}
+		}
+		if v := r.URL.Query().Get("to"); v != "" {
+			if t, err := parseDateParam(v); err == nil && t.After(from) {
+				to = t
 			}
 		}
+		if bookedItemIDs, err := unavailableItemIDs(ctx, from, to); err == nil && len(bookedItemIDs) > 0 {
+			filter["_id"] = bson.M{"$nin": bookedItemIDs}
+		}
+		for k, v := range calendarSearchFilter(from, to) {
+			filter[k] = v
+		}
 	}
-	
+
 	if cat := r.URL.Query().Get("category"); cat != "" {
 		filter["category"] = cat
 	}
-	if search := r.URL.Query().Get("search"); search != "" {
-		filter["$or"] = []bson.M{
-			{"title": bson.M{"$regex": search, "$options": "i"}},
-			{"description": bson.M{"$regex": search, "$options": "i"}},
+	filters, err := parseItemFilters(r.URL.Query())
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filters.applyOther(filter)
+	text := parseTextQuery(r.URL.Query().Get("search"))
+	geo, err := parseGeoQuery(r.URL.Query())
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if geo != nil {
+		geo.apply(filter)
+	}
+
+	// Facets are counted with every filter but their own
+	scope := bson.M{}
+	for k, v := range filter {
+		scope[k] = v
+	}
+	filters.applyFacets(filter)
+	// Text matches are capped, so they are looked for within the radius
+	if geo != nil && geo.Near != nil {
+		scope = geo.withinRadius(scope)
+	}
+	if text != nil {
+		if scope, err = narrowToText(ctx, text, scope); err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to search items")
+			return
 		}
 	}
 
@@ -151,20 +184,52 @@ func getItems(w http.ResponseWriter, r *http.Request) {
 	}
 	skip := (page - 1) * limit
 
-	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit).SetSkip(skip)
+	var items []Item
+	var totalCount int64
+	fuzzy := false
+	switch {
+	case geo != nil && geo.Near != nil:
+		// Searching around a point sorts by distance, also when searching
+		// for text
+		if text != nil {
+			ids, err := textMatchIDs(ctx, text, geo.withinRadius(filter))
+			if err != nil {
+				JSONError(w, http.StatusInternalServerError, "Failed to search items")
+				return
+			}
+			filter = bson.M{"$and": []bson.M{filter, {"_id": bson.M{"$in": ids}}}}
+		}
+		items, err = findItemsNear(ctx, geo, filter, skip, limit)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to fetch items")
+			return
+		}
+		totalCount, _ = collection.CountDocuments(ctx, geo.withinRadius(filter))
+	case text != nil:
+		items, totalCount, fuzzy, err = findItemsMatching(ctx, text, filter, skip, limit)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to search items")
+			return
+		}
+	default:
+		findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit).SetSkip(skip)
 
-	cursor, err := collection.Find(ctx, filter, findOptions)
-	if err != nil {
-		JSONError(w, http.StatusInternalServerError, "Failed to fetch items")
-		return
-	}
-	defer cursor.Close(ctx)
+		cursor, err := collection.Find(ctx, filter, findOptions)
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to fetch items")
+			return
+		}
+		defer cursor.Close(ctx)
+		cursor.All(ctx, &items)
 
-	var items []Item
-	cursor.All(ctx, &items)
+		// Get total count for metadata
+		totalCount, _ = collection.CountDocuments(ctx, filter)
+	}
 
-	// Get total count for metadata
-	totalCount, _ := collection.CountDocuments(ctx, filter)
+	// Searches that found something as typed are suggested to others
+	if text != nil && !fuzzy && page == 1 && totalCount > 0 {
+		go recordSearch(text, searcherKey(r))
+	}
 
 	// Populate owners
 	userCol := GetCollection("users")
@@ -172,15 +237,31 @@ func getItems(w http.ResponseWriter, r *http.Request) {
 		var user User
 		userCol.FindOne(ctx, bson.M{"_id": items[i].OwnerID}).Decode(&user)
 		items[i].Owner = &User{ID: user.ID, Name: user.Name, Avatar: user.Avatar, Rating: user.Rating}
+		items[i].publicLocation()
+		if text != nil {
+			highlightItem(&items[i], text)
+		}
 	}
 
-	JSON(w, http.StatusOK, map[string]interface{}{
-		"items": items,
-		"total": totalCount,
-		"page":  page,
-		"limit": limit,
-		"pages": (totalCount + limit - 1) / limit,
-	})
+	facets, err := itemFacets(ctx, scope, filters)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to count facets")
+		return
+	}
+
+	response := map[string]interface{}{
+		"items":  items,
+		"total":  totalCount,
+		"page":   page,
+		"limit":  limit,
+		"pages":  (totalCount + limit - 1) / limit,
+		"facets": facets,
+	}
+	// Nothing matched the words as typed; these are the closest spellings
+	if fuzzy {
+		response["fuzzy"] = true
+	}
+	JSON(w, http.StatusOK, response)
 }
 
 func getItemByID(w http.ResponseWriter, r *http.Request, id string) {
@@ -207,6 +288,7 @@ func getItemByID(w http.ResponseWriter, r *http.Request, id string) {
 	var user User
 	GetCollection("users").FindOne(ctx, bson.M{"_id": item.OwnerID}).Decode(&user)
 	item.Owner = &user
+	item.publicLocation()
 
 	JSON(w, http.StatusOK, map[string]interface{}{"item": item})
 }
@@ -224,8 +306,48 @@ func createItem(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if item.CancellationPolicy == "" {
+		item.CancellationPolicy = PolicyFlexible
+	}
+	if !isCancellationPolicy(item.CancellationPolicy) {
+		JSONError(w, http.StatusBadRequest, "Invalid cancellation policy")
+		return
+	}
+	if err := validateLateFee(item.LateFee); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateSubscriptionSettings(item.Subscription); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validatePricing(&item); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateQuantity(item.Quantity); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateItemTaxonomy(ctx, &item); err != nil {
+		if errors.Is(err, errCategoryLookup) {
+			JSONError(w, http.StatusInternalServerError, "Failed to check category")
+		} else {
+			JSONError(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+	geo, err := newGeoPoint(item.Coordinates)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	item.ID = primitive.NewObjectID()
+	item.Geo = geo
+	item.Search = itemSearchFields(&item)
 	item.OwnerID = userID
+	item.Calendar = nil // managed through /api/items/{id}/calendar
 	item.Status = "active"
 	item.Views = 0
 	item.Favorites = 0
@@ -236,6 +358,7 @@ func createItem(w http.ResponseWriter, r *http.Request) {
 		JSONError(w, http.StatusInternalServerError, "Failed to create item")
 		return
 	}
+	item.publicLocation()
 
 	JSON(w, http.StatusCreated, map[string]interface{}{
 		"message": "Item created successfully",
@@ -265,11 +388,139 @@ func updateItem(w http.ResponseWriter, r *http.Request, id string) {
 
 	var updateData map[string]interface{}
 	DecodeJSON(r, &updateData)
+	if policy, ok := updateData["cancellationPolicy"]; ok {
+		if s, _ := policy.(string); !isCancellationPolicy(s) {
+			JSONError(w, http.StatusBadRequest, "Invalid cancellation policy")
+			return
+		}
+	}
+	if raw, ok := updateData["lateFee"]; ok && raw != nil {
+		fee, _ := raw.(map[string]interface{})
+		amount, _ := fee["amount"].(float64)
+		unit, _ := fee["unit"].(string)
+		if err := validateLateFee(&LateFeeRule{Amount: amount, Unit: unit}); err != nil {
+			JSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if raw, ok := updateData["subscription"]; ok && raw != nil {
+		settings, _ := raw.(map[string]interface{})
+		noticeDays, _ := settings["noticeDays"].(float64)
+		if err := validateSubscriptionSettings(&SubscriptionSettings{NoticeDays: int(noticeDays)}); err != nil {
+			JSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// Check the pricing fields as they will be after the update
+	updated := item
+	if v, ok := updateData["priceUnit"]; ok {
+		updated.PriceUnit, _ = v.(string)
+	}
+	if v, ok := updateData["minDuration"].(float64); ok {
+		updated.MinDuration = int(v)
+	}
+	if v, ok := updateData["maxDuration"].(float64); ok {
+		updated.MaxDuration = int(v)
+	}
+	if err := validatePricing(&updated); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Lowering the quantity doesn't touch bookings already made
+	if v, ok := updateData["quantity"]; ok {
+		quantity, isNumber := v.(float64)
+		if !isNumber || quantity != float64(int(quantity)) {
+			JSONError(w, http.StatusBadRequest, "Quantity must be a whole number")
+			return
+		}
+		if err := validateQuantity(int(quantity)); err != nil {
+			JSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		updateData["quantity"] = int(quantity)
+	}
+	// Check the category fields as they will be after the update. Items
+	// listed before the taxonomy are only checked once one of them changes.
+	taxonomyFields := []string{"category", "subCategory", "brand", "model", "attributes"}
+	changed := false
+	for _, field := range taxonomyFields {
+		if _, ok := updateData[field]; ok {
+			changed = true
+		}
+	}
+	if changed {
+		if v, ok := updateData["category"]; ok {
+			updated.Category, _ = v.(string)
+		}
+		if v, ok := updateData["subCategory"]; ok {
+			updated.SubCategory, _ = v.(string)
+		}
+		if v, ok := updateData["brand"]; ok {
+			updated.Brand, _ = v.(string)
+		}
+		if v, ok := updateData["model"]; ok {
+			updated.Model, _ = v.(string)
+		}
+		if v, ok := updateData["attributes"]; ok {
+			attributes, err := attributeValues(v)
+			if err != nil {
+				JSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			updated.Attributes = attributes
+		}
+		if err := validateItemTaxonomy(ctx, &updated); err != nil {
+			if errors.Is(err, errCategoryLookup) {
+				JSONError(w, http.StatusInternalServerError, "Failed to check category")
+			} else {
+				JSONError(w, http.StatusBadRequest, err.Error())
+			}
+			return
+		}
+		updateData["category"] = updated.Category
+		updateData["subCategory"] = updated.SubCategory
+		updateData["brand"] = updated.Brand
+		updateData["model"] = updated.Model
+		updateData["attributes"] = updated.Attributes
+	}
+	// Coordinates are stored as a GeoJSON point; null removes them
+	if raw, ok := updateData["coordinates"]; ok {
+		if raw == nil {
+			updateData["geo"] = nil
+		} else {
+			c, _ := raw.(map[string]interface{})
+			lat, okLat := c["lat"].(float64)
+			lng, okLng := c["lng"].(float64)
+			if !okLat || !okLng {
+				JSONError(w, http.StatusBadRequest, "Coordinates need a lat and lng")
+				return
+			}
+			geo, err := newGeoPoint(&Coordinates{Lat: lat, Lng: lng})
+			if err != nil {
+				JSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			updateData["geo"] = geo
+		}
+	} else {
+		delete(updateData, "geo")
+	}
+	delete(updateData, "coordinates")
+	delete(updateData, "distance")
+	delete(updateData, "search")
+	delete(updateData, "score")
+	delete(updateData, "highlights")
+
 	updateData["updatedAt"] = time.Now()
 	delete(updateData, "_id")
 	delete(updateData, "ownerId")
+	delete(updateData, "calendar")
 
 	collection.UpdateOne(ctx, bson.M{"_id": itemID}, bson.M{"$set": updateData})
+	if err := refreshItemSearch(ctx, itemID); err != nil {
+		log.Printf("Error refreshing search fields of item %s: %v", itemID.Hex(), err)
+	}
 
 	JSON(w, http.StatusOK, map[string]string{"message": "Item updated successfully"})
 }
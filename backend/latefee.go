@@ -0,0 +1,184 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Late fee units
+const (
+	LateFeePerHour = "hour"
+	LateFeePerDay  = "day"
+)
+
+// overdueReminderSchedule is how long after the end date each reminder goes
+// out. After the last one, reminders repeat every day.
+var overdueReminderSchedule = []time.Duration{0, 2 * time.Hour, 6 * time.Hour, 24 * time.Hour}
+
+// lateFeeGrace is how late a return may be before fees start
+func lateFeeGrace() time.Duration {
+	return envDuration("LATE_FEE_GRACE", 30*time.Minute)
+}
+
+// validateLateFee checks an item's late fee rule
+func validateLateFee(rule *LateFeeRule) error {
+	if rule == nil {
+		return nil
+	}
+	if rule.Unit != LateFeePerHour && rule.Unit != LateFeePerDay {
+		return errors.New("Late fee unit must be 'hour' or 'day'")
+	}
+	if rule.Amount < 0 {
+		return errors.New("Late fee can't be negative")
+	}
+	return nil
+}
+
+// lateFee is the fee for returning quantity units of an item overdue past
+// their end date: every started hour or day after the grace period, for
+// each unit
+func lateFee(rule *LateFeeRule, overdue time.Duration, quantity int) (int, float64) {
+	charged := overdue - lateFeeGrace()
+	if rule == nil || rule.Amount <= 0 || charged <= 0 {
+		return 0, 0
+	}
+	unit := time.Hour
+	if rule.Unit == LateFeePerDay {
+		unit = 24 * time.Hour
+	}
+	units := int(math.Ceil(float64(charged) / float64(unit)))
+	return units, roundMoney(float64(units*quantity) * rule.Amount)
+}
+
+// nextReminderDue returns when the reminder after sent reminders is due
+func nextReminderDue(endDate time.Time, sent int) time.Time {
+	if sent < len(overdueReminderSchedule) {
+		return endDate.Add(overdueReminderSchedule[sent])
+	}
+	last := overdueReminderSchedule[len(overdueReminderSchedule)-1]
+	return endDate.Add(last + time.Duration(sent-len(overdueReminderSchedule)+1)*24*time.Hour)
+}
+
+// overdueAction is the notification action for the nth reminder, so the
+// wording escalates the longer the item is kept
+func overdueAction(n int) string {
+	switch {
+	case n == 0:
+		return "overdue"
+	case n < len(overdueReminderSchedule)-1:
+		return "overdue_reminder"
+	default:
+		return "overdue_escalated"
+	}
+}
+
+// checkOverdueRentals flags handed-over bookings past their end date, keeps
+// their accrued late fee up to date and sends escalating reminders
+func checkOverdueRentals(ctx context.Context) error {
+	now := time.Now()
+	cursor, err := GetCollection("bookings").Find(ctx, bson.M{
+		"status":  StatusHandedOver,
+		"endDate": bson.M{"$lt": now},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var booking Booking
+		if err := cursor.Decode(&booking); err != nil {
+			continue
+		}
+
+		var item Item
+		GetCollection("items").FindOne(ctx, bson.M{"_id": booking.ItemID}).Decode(&item)
+
+		late := booking.Late
+		if late == nil {
+			late = &LateReturn{DetectedAt: now}
+		}
+		late.Units, late.Fee = lateFee(item.LateFee, now.Sub(booking.EndDate), booking.units())
+
+		remind := !now.Before(nextReminderDue(booking.EndDate, late.Reminders))
+		sent := late.Reminders
+		if remind {
+			late.Reminders++
+			late.LastReminderAt = &now
+		}
+
+		// Only update while still handed over, in case the return was
+		// recorded in the meantime
+		result, err := GetCollection("bookings").UpdateOne(ctx,
+			bson.M{"_id": booking.ID, "status": StatusHandedOver},
+			bson.M{"$set": bson.M{"late": late, "updatedAt": now}},
+		)
+		if err != nil || result.MatchedCount == 0 {
+			continue
+		}
+
+		if remind {
+			booking.Late = late
+			action := overdueAction(sent)
+			notifyBookingEvent(ctx, &booking, booking.RenterID, action)
+			notifyBookingEvent(ctx, &booking, booking.OwnerID, action)
+		}
+		count++
+	}
+
+	if count > 0 {
+		log.Printf("Checked %d overdue rentals", count)
+	}
+	return cursor.Err()
+}
+
+// lateFeeSettlementFields returns the updates that settle a late return when
+// it is recorded: the final fee is added to the booking's line items and
+// total, and a paid booking goes back to pending until the renter pays it.
+func lateFeeSettlementFields(booking *Booking, item *Item, now time.Time) bson.M {
+	if !now.After(booking.EndDate) {
+		return nil
+	}
+
+	late := booking.Late
+	if late == nil {
+		late = &LateReturn{DetectedAt: now}
+	}
+	late.Units, late.Fee = lateFee(item.LateFee, now.Sub(booking.EndDate), booking.units())
+	late.SettledAt = &now
+
+	set := bson.M{"late": late}
+	if late.Fee <= 0 {
+		return set
+	}
+
+	unit := item.LateFee.Unit
+	if late.Units != 1 {
+		unit += "s"
+	}
+	lines := append([]PriceLineItem{}, booking.LineItems...)
+	label := fmt.Sprintf("Late return (%d %s)", late.Units, unit)
+	if booking.units() > 1 {
+		label = fmt.Sprintf("Late return (%d %s, %d units)", late.Units, unit, booking.units())
+	}
+	lines = append(lines, PriceLineItem{
+		Code:      "late_fee",
+		Label:     label,
+		Quantity:  float64(late.Units * booking.units()),
+		UnitPrice: item.LateFee.Amount,
+		Amount:    late.Fee,
+	})
+	set["lineItems"] = lines
+	set["totalPrice"] = roundMoney(booking.TotalPrice + late.Fee)
+	if booking.PaymentStatus == PaymentPaid {
+		set["paymentStatus"] = PaymentPending
+	}
+	return set
+}
@@ -0,0 +1,43 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLateFee(t *testing.T) {
+	t.Setenv("LATE_FEE_GRACE", "30m")
+	hourly := &LateFeeRule{Amount: 100, Unit: LateFeePerHour}
+	daily := &LateFeeRule{Amount: 500, Unit: LateFeePerDay}
+
+	tests := []struct {
+		name      string
+		rule      *LateFeeRule
+		overdue   time.Duration
+		quantity  int
+		wantUnits int
+		wantFee   float64
+	}{
+		{"no rule", nil, 5 * time.Hour, 1, 0, 0},
+		{"free rule", &LateFeeRule{Amount: 0, Unit: LateFeePerHour}, 5 * time.Hour, 1, 0, 0},
+		{"on time", hourly, 0, 1, 0, 0},
+		{"within the grace period", hourly, 30 * time.Minute, 1, 0, 0},
+		{"just past the grace period", hourly, 31 * time.Minute, 1, 1, 100},
+		{"the grace period isn't charged", hourly, 90 * time.Minute, 1, 1, 100},
+		{"started hours are charged", hourly, 91 * time.Minute, 1, 2, 200},
+		{"exact hours", hourly, 3*time.Hour + 30*time.Minute, 1, 3, 300},
+		{"per unit", hourly, 3*time.Hour + 30*time.Minute, 2, 3, 600},
+		{"daily", daily, 2 * time.Hour, 1, 1, 500},
+		{"started days are charged", daily, 25 * time.Hour, 1, 2, 1000},
+		{"daily per unit", daily, 25 * time.Hour, 3, 2, 3000},
+		{"a day and the grace period is one day", daily, 24*time.Hour + 30*time.Minute, 1, 1, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			units, fee := lateFee(tt.rule, tt.overdue, tt.quantity)
+			if units != tt.wantUnits || fee != tt.wantFee {
+				t.Errorf("lateFee() = %d, %v, want %d, %v", units, fee, tt.wantUnits, tt.wantFee)
+			}
+		})
+	}
+}
@@ -57,17 +57,8 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		secret := os.Getenv("JWT_SECRET")
-		if secret == "" {
-			secret = "your-secret-key-change-this-in-production"
-		}
-
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(parts[1], claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := parseToken(parts[1])
+		if err != nil {
 			JSONError(w, http.StatusUnauthorized, "Invalid or expired token")
 			return
 		}
@@ -77,6 +68,40 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// parseToken validates a JWT and returns its claims
+func parseToken(tokenString string) (*Claims, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		secret = "your-secret-key-change-this-in-production"
+	}
+
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
+// OptionalUserID returns the ID of the user signed in on a public route, if
+// the request carries a valid token
+func OptionalUserID(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+	claims, err := parseToken(token)
+	if err != nil {
+		return "", false
+	}
+	return claims.UserID, true
+}
+
 // GetUserID gets user ID from context
 func GetUserID(r *http.Request) (primitive.ObjectID, error) {
 	userIDStr, ok := r.Context().Value(UserIDKey).(string)
@@ -20,56 +20,436 @@ type User struct {
 	TotalListings int                `json:"totalListings" bson:"totalListings"`
 	TotalBookings int                `json:"totalBookings" bson:"totalBookings"`
 	FCMToken      string             `json:"fcmToken,omitempty" bson:"fcmToken,omitempty"`
+	IDVerified    bool               `json:"idVerified" bson:"idVerified"`           // set by support after checking ID documents
+	Role          string             `json:"role,omitempty" bson:"role,omitempty"`   // "support" for staff, empty for everyone else
+	GSTIN         string             `json:"gstin,omitempty" bson:"gstin,omitempty"` // shown on invoices, for business users
+	CustomerID    string             `json:"-" bson:"customerId,omitempty"`          // the payment provider's customer, once a payment method was saved
 	CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
 	UpdatedAt     time.Time          `json:"updatedAt" bson:"updatedAt"`
 }
 
 // Item model
 type Item struct {
-	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Title       string             `json:"title" bson:"title"`
-	Description string             `json:"description" bson:"description"`
-	Category    string             `json:"category" bson:"category"`
-	SubCategory string             `json:"subCategory" bson:"subCategory"`
-	Brand       string             `json:"brand,omitempty" bson:"brand,omitempty"`
-	Model       string             `json:"model,omitempty" bson:"model,omitempty"`
-	Attributes  map[string]string  `json:"attributes,omitempty" bson:"attributes,omitempty"`
-	Price       float64            `json:"price" bson:"price"`
-	Location    string             `json:"location" bson:"location"`
-	Images      []string           `json:"images" bson:"images"`
-	OwnerID     primitive.ObjectID `json:"ownerId" bson:"ownerId"`
-	Owner       *User              `json:"owner,omitempty" bson:"-"`
-	Status      string             `json:"status" bson:"status"`
-	Views       int                `json:"views" bson:"views"`
-	Favorites   int                `json:"favorites" bson:"favorites"`
-	Rating      float64            `json:"rating" bson:"rating"`
-	Reviews     int                `json:"reviews" bson:"reviews"`
-	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
-	UpdatedAt   time.Time          `json:"updatedAt" bson:"updatedAt"`
+	ID                 primitive.ObjectID    `json:"id" bson:"_id,omitempty"`
+	Title              string                `json:"title" bson:"title"`
+	Description        string                `json:"description" bson:"description"`
+	Category           string                `json:"category" bson:"category"`
+	SubCategory        string                `json:"subCategory" bson:"subCategory"`
+	Brand              string                `json:"brand,omitempty" bson:"brand,omitempty"`
+	Model              string                `json:"model,omitempty" bson:"model,omitempty"`
+	Attributes         map[string]string     `json:"attributes,omitempty" bson:"attributes,omitempty"`
+	Price              float64               `json:"price" bson:"price"`                                 // per PriceUnit
+	PriceUnit          string                `json:"priceUnit,omitempty" bson:"priceUnit,omitempty"`     // "hour", "day" (default), "week" or "month"
+	MinDuration        int                   `json:"minDuration,omitempty" bson:"minDuration,omitempty"` // in PriceUnit, 0 for no limit
+	MaxDuration        int                   `json:"maxDuration,omitempty" bson:"maxDuration,omitempty"` // in PriceUnit, 0 for no limit
+	WeeklyPrice        float64               `json:"weeklyPrice,omitempty" bson:"weeklyPrice,omitempty"`
+	MonthlyPrice       float64               `json:"monthlyPrice,omitempty" bson:"monthlyPrice,omitempty"`
+	DepositAmount      float64               `json:"depositAmount,omitempty" bson:"depositAmount,omitempty"` // refundable security deposit, per unit
+	Quantity           int                   `json:"quantity,omitempty" bson:"quantity,omitempty"`           // identical units for rent, 0 means 1
+	CancellationPolicy string                `json:"cancellationPolicy" bson:"cancellationPolicy"`           // "flexible", "moderate" or "strict"
+	InstantBook        *InstantBookSettings  `json:"instantBook,omitempty" bson:"instantBook,omitempty"`
+	Subscription       *SubscriptionSettings `json:"subscription,omitempty" bson:"subscription,omitempty"`
+	Calendar           *AvailabilityCalendar `json:"calendar,omitempty" bson:"calendar,omitempty"` // managed via /api/items/{id}/calendar
+	LateFee            *LateFeeRule          `json:"lateFee,omitempty" bson:"lateFee,omitempty"`
+	Location           string                `json:"location" bson:"location"`
+	Coordinates        *Coordinates          `json:"coordinates,omitempty" bson:"-"` // set by the owner; returned rounded, see publicLocation
+	Geo                *GeoPoint             `json:"-" bson:"geo,omitempty"`         // exact point, never returned
+	Distance           *float64              `json:"distance,omitempty" bson:"-"`    // km from the searched point
+	Search             *ItemSearch           `json:"-" bson:"search,omitempty"`
+	Score              *float64              `json:"score,omitempty" bson:"-"`      // relevance to the search
+	Highlights         map[string]string     `json:"highlights,omitempty" bson:"-"` // matched fields with <mark> around the matches
+	Images             []string              `json:"images" bson:"images"`
+	OwnerID            primitive.ObjectID    `json:"ownerId" bson:"ownerId"`
+	Owner              *User                 `json:"owner,omitempty" bson:"-"`
+	Status             string                `json:"status" bson:"status"`
+	Views              int                   `json:"views" bson:"views"`
+	Favorites          int                   `json:"favorites" bson:"favorites"`
+	Rating             float64               `json:"rating" bson:"rating"`
+	Reviews            int                   `json:"reviews" bson:"reviews"`
+	CreatedAt          time.Time             `json:"createdAt" bson:"createdAt"`
+	UpdatedAt          time.Time             `json:"updatedAt" bson:"updatedAt"`
+}
+
+// InstantBookSettings let qualifying renters book an item without waiting
+// for the owner's approval
+type InstantBookSettings struct {
+	Enabled           bool    `json:"enabled" bson:"enabled"`
+	MinRenterRating   float64 `json:"minRenterRating,omitempty" bson:"minRenterRating,omitempty"` // 0 for any renter
+	RequireVerifiedID bool    `json:"requireVerifiedId,omitempty" bson:"requireVerifiedId,omitempty"`
+}
+
+// Coordinates is a latitude/longitude pair as the API takes and returns it
+type Coordinates struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// GeoPoint is a GeoJSON point, stored for the 2dsphere index. Coordinates
+// are longitude first.
+type GeoPoint struct {
+	Type        string    `bson:"type"`
+	Coordinates []float64 `bson:"coordinates"`
+}
+
+// SubscriptionSettings let renters rent an item month by month until either
+// side gives notice
+type SubscriptionSettings struct {
+	Enabled    bool `json:"enabled" bson:"enabled"`
+	NoticeDays int  `json:"noticeDays,omitempty" bson:"noticeDays,omitempty"` // 0 for the platform default
+}
+
+// AvailabilityCalendar holds the times an owner keeps an item off the market
+type AvailabilityCalendar struct {
+	Blackouts           []Blackout `json:"blackouts" bson:"blackouts"`
+	UnavailableWeekdays []int      `json:"unavailableWeekdays" bson:"unavailableWeekdays"` // 0 = Sunday
+	BufferHours         int        `json:"bufferHours" bson:"bufferHours"`                 // kept free before and after each rental
+}
+
+// Blackout is a range the owner has blocked, e.g. because they need the item
+type Blackout struct {
+	ID    primitive.ObjectID `json:"id" bson:"_id"`
+	Start time.Time          `json:"start" bson:"start"`
+	End   time.Time          `json:"end" bson:"end"`
+	Note  string             `json:"note,omitempty" bson:"note,omitempty"`
+}
+
+// LateFeeRule is what an owner charges for each started hour or day an item
+// is returned late
+type LateFeeRule struct {
+	Amount float64 `json:"amount" bson:"amount"`
+	Unit   string  `json:"unit" bson:"unit"` // "hour" or "day"
+}
+
+// Category is a node of the listing taxonomy the app builds its category
+// pickers from. IDs are the ones the app has always used, "1" to "13".
+type Category struct {
+	ID            string            `json:"id" bson:"_id"`
+	Name          string            `json:"name" bson:"name"`
+	IconName      string            `json:"iconName" bson:"iconName"`
+	Order         int               `json:"order" bson:"order"`
+	Attributes    []AttributeSchema `json:"attributes,omitempty" bson:"attributes,omitempty"` // apply to every sub-category
+	SubCategories []SubCategory     `json:"subCategories" bson:"subCategories"`
+	UpdatedAt     time.Time         `json:"updatedAt" bson:"updatedAt"`
+}
+
+// SubCategory lists the options an item of it picks one of. The option is
+// stored as the item's brand whatever Label calls it, e.g. "Brand" or "Type".
+type SubCategory struct {
+	Name       string            `json:"name" bson:"name"`
+	Label      string            `json:"label" bson:"label"`
+	Options    []CategoryOption  `json:"options" bson:"options"`
+	Attributes []AttributeSchema `json:"attributes,omitempty" bson:"attributes,omitempty"`
+}
+
+// CategoryOption is a brand or type, with the models to pick from if any
+type CategoryOption struct {
+	Name    string   `json:"name" bson:"name"`
+	Label   string   `json:"label,omitempty" bson:"label,omitempty"` // what the models are called, e.g. "Model"
+	Options []string `json:"options,omitempty" bson:"options,omitempty"`
+}
+
+// AttributeSchema describes an attribute items of a category can have.
+// Values are stored as strings in Item.Attributes under Key.
+type AttributeSchema struct {
+	Key      string   `json:"key" bson:"key"`
+	Label    string   `json:"label" bson:"label"`
+	Type     string   `json:"type" bson:"type"` // "text", "number", "integer", "enum" or "boolean"
+	Required bool     `json:"required,omitempty" bson:"required,omitempty"`
+	Options  []string `json:"options,omitempty" bson:"options,omitempty"` // enum values
+	Min      *float64 `json:"min,omitempty" bson:"min,omitempty"`         // number and integer bounds, inclusive
+	Max      *float64 `json:"max,omitempty" bson:"max,omitempty"`
 }
 
 // Booking model
 type Booking struct {
-	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	TrackingID    string             `json:"trackingId" bson:"trackingId"`
+	ID                 primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	TrackingID         string              `json:"trackingId" bson:"trackingId"`
+	OrderID            *primitive.ObjectID `json:"orderId,omitempty" bson:"orderId,omitempty"` // set when booked through a cart checkout
+	OfferID            *primitive.ObjectID `json:"offerId,omitempty" bson:"offerId,omitempty"` // the chat offer message it was booked from
+	SubscriptionID     *primitive.ObjectID `json:"subscriptionId,omitempty" bson:"subscriptionId,omitempty"`
+	Cycle              int                 `json:"cycle,omitempty" bson:"cycle,omitempty"` // subscription cycle; 1 is the contract booking the item is handed over on
+	ItemID             primitive.ObjectID  `json:"itemId" bson:"itemId"`
+	Item               *Item               `json:"item,omitempty" bson:"-"`
+	RenterID           primitive.ObjectID  `json:"renterId" bson:"renterId"`
+	Renter             *User               `json:"renter,omitempty" bson:"-"`
+	OwnerID            primitive.ObjectID  `json:"ownerId" bson:"ownerId"`
+	Owner              *User               `json:"owner,omitempty" bson:"-"`
+	StartDate          time.Time           `json:"startDate" bson:"startDate"`
+	EndDate            time.Time           `json:"endDate" bson:"endDate"`
+	Quantity           int                 `json:"quantity,omitempty" bson:"quantity,omitempty"` // units of the item rented, 0 means 1
+	TotalPrice         float64             `json:"totalPrice" bson:"totalPrice"`
+	LineItems          []PriceLineItem     `json:"lineItems,omitempty" bson:"lineItems,omitempty"`
+	AutoConfirm        bool                `json:"autoConfirm,omitempty" bson:"autoConfirm,omitempty"` // instant book: confirmed by the system once paid
+	Status             string              `json:"status" bson:"status"`
+	PaymentStatus      string              `json:"paymentStatus" bson:"paymentStatus"`
+	RespondBy          *time.Time          `json:"respondBy,omitempty" bson:"respondBy,omitempty"` // when an unanswered request is rejected
+	OwnerResponse      *OwnerResponse      `json:"ownerResponse,omitempty" bson:"ownerResponse,omitempty"`
+	Payment            *PaymentInfo        `json:"payment,omitempty" bson:"payment,omitempty"`
+	Deposit            *Deposit            `json:"deposit,omitempty" bson:"deposit,omitempty"`
+	CancellationPolicy string              `json:"cancellationPolicy" bson:"cancellationPolicy"` // the item's policy when booked
+	Refund             *Refund             `json:"refund,omitempty" bson:"refund,omitempty"`
+	Invoice            *Invoice            `json:"invoice,omitempty" bson:"invoice,omitempty"`
+	Modifications      []Modification      `json:"modifications,omitempty" bson:"modifications,omitempty"`
+	Pickup             *HandoverStep       `json:"pickup,omitempty" bson:"pickup,omitempty"`
+	Late               *LateReturn         `json:"late,omitempty" bson:"late,omitempty"`
+	Return             *HandoverStep       `json:"return,omitempty" bson:"return,omitempty"`
+	PickupAddress      string              `json:"pickupAddress" bson:"pickupAddress"`
+	DropAddress        string              `json:"dropAddress" bson:"dropAddress"`
+	Notes              string              `json:"notes" bson:"notes"`
+	CancelledBy        primitive.ObjectID  `json:"cancelledBy,omitempty" bson:"cancelledBy,omitempty"`
+	CancellationReason string              `json:"cancellationReason,omitempty" bson:"cancellationReason,omitempty"`
+	StatusHistory      []StatusChange      `json:"statusHistory,omitempty" bson:"statusHistory,omitempty"`
+	CreatedAt          time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt          time.Time           `json:"updatedAt" bson:"updatedAt"`
+}
+
+// OwnerResponse is how the owner answered a booking request
+type OwnerResponse struct {
+	Outcome string    `json:"outcome" bson:"outcome"`                     // "accepted", "declined", "timed_out"
+	Seconds int64     `json:"seconds,omitempty" bson:"seconds,omitempty"` // from request to answer
+	At      time.Time `json:"at" bson:"at"`
+}
+
+// Subscription is a monthly rental that renews until the renter or owner
+// gives notice. Every cycle is billed as a booking of its own. The first
+// one is the contract booking: the item is handed over and returned, and
+// the deposit held, on it, and its end date moves with each renewal.
+type Subscription struct {
+	ID            primitive.ObjectID  `json:"id" bson:"_id"`
+	ItemID        primitive.ObjectID  `json:"itemId" bson:"itemId"`
+	Item          *Item               `json:"item,omitempty" bson:"-"`
+	RenterID      primitive.ObjectID  `json:"renterId" bson:"renterId"`
+	Renter        *User               `json:"renter,omitempty" bson:"-"`
+	OwnerID       primitive.ObjectID  `json:"ownerId" bson:"ownerId"`
+	Quantity      int                 `json:"quantity" bson:"quantity"`
+	StartDate     time.Time           `json:"startDate" bson:"startDate"`
+	EndDate       *time.Time          `json:"endDate,omitempty" bson:"endDate,omitempty"` // set once notice is given
+	CycleRental   float64             `json:"cycleRental" bson:"cycleRental"`             // per cycle, before platform fee and tax
+	NoticeDays    int                 `json:"noticeDays" bson:"noticeDays"`
+	Cycles        int                 `json:"cycles" bson:"cycles"`           // cycles billed so far
+	PeriodEnd     time.Time           `json:"periodEnd" bson:"periodEnd"`     // end of the last cycle billed
+	PaidThrough   time.Time           `json:"paidThrough" bson:"paidThrough"` // end of the last cycle paid for, where the contract booking ends
+	Status        string              `json:"status" bson:"status"`           // pending, active, ending, ended or cancelled
+	Mandate       string              `json:"-" bson:"mandate,omitempty"`     // saved payment method renewals are charged to
+	PickupAddress string              `json:"pickupAddress,omitempty" bson:"pickupAddress,omitempty"`
+	DropAddress   string              `json:"dropAddress,omitempty" bson:"dropAddress,omitempty"`
+	Notes         string              `json:"notes,omitempty" bson:"notes,omitempty"`
+	Notice        *SubscriptionNotice `json:"notice,omitempty" bson:"notice,omitempty"`
+	Bookings      []Booking           `json:"bookings,omitempty" bson:"-"`
+	CreatedAt     time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time           `json:"updatedAt" bson:"updatedAt"`
+}
+
+// SubscriptionNotice records who ended a subscription and when
+type SubscriptionNotice struct {
+	By      primitive.ObjectID `json:"by" bson:"by"`
+	Role    string             `json:"role" bson:"role"`
+	GivenAt time.Time          `json:"givenAt" bson:"givenAt"`
+}
+
+// Cart collects the items a renter wants to book together. Each user has one,
+// stored under their ID.
+type Cart struct {
+	UserID    primitive.ObjectID `json:"userId" bson:"_id"`
+	Items     []CartItem         `json:"items" bson:"items"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// CartItem is an item and the dates it is wanted for
+type CartItem struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id"`
 	ItemID        primitive.ObjectID `json:"itemId" bson:"itemId"`
 	Item          *Item              `json:"item,omitempty" bson:"-"`
-	RenterID      primitive.ObjectID `json:"renterId" bson:"renterId"`
-	Renter        *User              `json:"renter,omitempty" bson:"-"`
-	OwnerID       primitive.ObjectID `json:"ownerId" bson:"ownerId"`
-	Owner         *User              `json:"owner,omitempty" bson:"-"`
 	StartDate     time.Time          `json:"startDate" bson:"startDate"`
 	EndDate       time.Time          `json:"endDate" bson:"endDate"`
-	TotalPrice    float64            `json:"totalPrice" bson:"totalPrice"`
-	Status        string             `json:"status" bson:"status"`
-	PaymentStatus      string             `json:"paymentStatus" bson:"paymentStatus"`
-	PickupAddress      string             `json:"pickupAddress" bson:"pickupAddress"`
-	DropAddress        string             `json:"dropAddress" bson:"dropAddress"`
-	Notes              string             `json:"notes" bson:"notes"`
-	CancelledBy        primitive.ObjectID `json:"cancelledBy,omitempty" bson:"cancelledBy,omitempty"`
-	CancellationReason string             `json:"cancellationReason,omitempty" bson:"cancellationReason,omitempty"`
-	CreatedAt          time.Time          `json:"createdAt" bson:"createdAt"`
-	UpdatedAt          time.Time          `json:"updatedAt" bson:"updatedAt"`
+	Quantity      int                `json:"quantity" bson:"quantity"`
+	PickupAddress string             `json:"pickupAddress,omitempty" bson:"pickupAddress,omitempty"`
+	DropAddress   string             `json:"dropAddress,omitempty" bson:"dropAddress,omitempty"`
+	Notes         string             `json:"notes,omitempty" bson:"notes,omitempty"`
+	Quote         *PriceQuote        `json:"quote,omitempty" bson:"-"`
+	Error         string             `json:"error,omitempty" bson:"-"` // why it can't be booked as it is
+}
+
+// Order groups the bookings created by one cart checkout, possibly with
+// several owners, so they can be paid for in one payment. Each booking is
+// still confirmed or rejected by its own owner.
+type Order struct {
+	ID            primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	RenterID      primitive.ObjectID   `json:"renterId" bson:"renterId"`
+	BookingIDs    []primitive.ObjectID `json:"bookingIds" bson:"bookingIds"`
+	Bookings      []Booking            `json:"bookings,omitempty" bson:"-"`
+	TotalPrice    float64              `json:"totalPrice" bson:"totalPrice"` // of all bookings when checked out
+	Deposit       float64              `json:"deposit" bson:"deposit"`
+	PaymentStatus string               `json:"paymentStatus" bson:"paymentStatus"`
+	Payment       *PaymentInfo         `json:"payment,omitempty" bson:"payment,omitempty"`
+	Shares        []OrderShare         `json:"shares,omitempty" bson:"shares,omitempty"` // how each payment order is split
+	CreatedAt     time.Time            `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time            `json:"updatedAt" bson:"updatedAt"`
+}
+
+// OrderShare is the part of a payment order that goes to one booking
+type OrderShare struct {
+	PaymentOrderID string             `json:"paymentOrderId" bson:"paymentOrderId"`
+	BookingID      primitive.ObjectID `json:"bookingId" bson:"bookingId"`
+	Amount         float64            `json:"amount" bson:"amount"`
+}
+
+// PaymentInfo is the gateway payment made for a booking
+type PaymentInfo struct {
+	Provider   string     `json:"provider" bson:"provider"`
+	OrderID    string     `json:"orderId" bson:"orderId"`                         // latest order
+	OrderIDs   []string   `json:"-" bson:"orderIds,omitempty"`                    // every order created, so late webhooks still match
+	PaymentID  string     `json:"paymentId,omitempty" bson:"paymentId,omitempty"` // latest captured payment
+	Amount     float64    `json:"amount" bson:"amount"`
+	AmountPaid float64    `json:"amountPaid,omitempty" bson:"amountPaid,omitempty"`
+	PaidAt     *time.Time `json:"paidAt,omitempty" bson:"paidAt,omitempty"`
+	Captures   []Capture  `json:"captures,omitempty" bson:"captures,omitempty"` // every captured payment, refunds are split across them
+}
+
+// Capture is a payment captured for a booking, e.g. the first payment and
+// the difference of an extension, and how much of it has been refunded
+type Capture struct {
+	PaymentID string    `json:"paymentId" bson:"paymentId"`
+	Amount    float64   `json:"amount" bson:"amount"`                       // the booking's share for a cart order
+	Deposit   float64   `json:"deposit,omitempty" bson:"deposit,omitempty"` // the part of it that collected the deposit
+	Refunded  float64   `json:"refunded" bson:"refunded"`
+	PaidAt    time.Time `json:"paidAt" bson:"paidAt"`
+}
+
+// RefundPart is the part of a refund sent back against one captured payment
+type RefundPart struct {
+	PaymentID string  `json:"paymentId" bson:"paymentId"`
+	Amount    float64 `json:"amount" bson:"amount"`
+	RefundID  string  `json:"refundId" bson:"refundId"`
+}
+
+// Invoice is the tax invoice issued for a paid booking. It keeps the amounts
+// as it was when issued, so later changes to the booking or the owner's
+// profile don't alter it
+type Invoice struct {
+	Number        string          `json:"number" bson:"number"` // sequential per owner
+	IssuedAt      time.Time       `json:"issuedAt" bson:"issuedAt"`
+	SupplierGSTIN string          `json:"supplierGstin,omitempty" bson:"supplierGstin,omitempty"` // the owner's, if registered for GST
+	Lines         []PriceLineItem `json:"lines" bson:"lines"`                                     // supplied by the owner
+	PlatformLines []PriceLineItem `json:"platformLines,omitempty" bson:"platformLines,omitempty"` // platform fee and GST, charged by RentKar when the owner has no GSTIN
+	Taxable       float64         `json:"taxable" bson:"taxable"`                                 // everything but GST
+	Tax           float64         `json:"tax" bson:"tax"`
+	Total         float64         `json:"total" bson:"total"`
+}
+
+// Modification is a renter's proposal to change a booking's dates
+type Modification struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id"`
+	StartDate       time.Time          `json:"startDate" bson:"startDate"`
+	EndDate         time.Time          `json:"endDate" bson:"endDate"`
+	TotalPrice      float64            `json:"totalPrice" bson:"totalPrice"`
+	LineItems       []PriceLineItem    `json:"lineItems" bson:"lineItems"`
+	PriceDifference float64            `json:"priceDifference" bson:"priceDifference"` // new total minus old
+	Note            string             `json:"note,omitempty" bson:"note,omitempty"`
+	Status          string             `json:"status" bson:"status"`                                 // "pending", "accepted", "rejected"
+	RefundStatus    string             `json:"refundStatus,omitempty" bson:"refundStatus,omitempty"` // set when a cheaper change is refunded
+	RefundID        string             `json:"refundId,omitempty" bson:"refundId,omitempty"`         // the last part's
+	RefundParts     []RefundPart       `json:"refundParts,omitempty" bson:"refundParts,omitempty"`
+	CreatedAt       time.Time          `json:"createdAt" bson:"createdAt"`
+	RespondedAt     *time.Time         `json:"respondedAt,omitempty" bson:"respondedAt,omitempty"`
+}
+
+// LateReturn tracks a booking kept past its end date
+type LateReturn struct {
+	DetectedAt     time.Time  `json:"detectedAt" bson:"detectedAt"`
+	Units          int        `json:"units" bson:"units"` // hours or days charged
+	Fee            float64    `json:"fee" bson:"fee"`
+	Reminders      int        `json:"reminders" bson:"reminders"`
+	LastReminderAt *time.Time `json:"lastReminderAt,omitempty" bson:"lastReminderAt,omitempty"`
+	SettledAt      *time.Time `json:"settledAt,omitempty" bson:"settledAt,omitempty"` // when the return was recorded
+}
+
+// HandoverStep is the pickup or return of a booked item. The renter shares
+// the code with the owner, who enters it along with the item's condition.
+type HandoverStep struct {
+	OTP        string              `json:"-" bson:"otp"`
+	Attempts   int                 `json:"-" bson:"attempts"`
+	Checklist  *ConditionChecklist `json:"checklist,omitempty" bson:"checklist,omitempty"`
+	VerifiedBy *primitive.ObjectID `json:"verifiedBy,omitempty" bson:"verifiedBy,omitempty"`
+	VerifiedAt *time.Time          `json:"verifiedAt,omitempty" bson:"verifiedAt,omitempty"`
+}
+
+// ConditionChecklist records an item's condition at pickup or return
+type ConditionChecklist struct {
+	Items    []ChecklistEntry   `json:"items,omitempty" bson:"items,omitempty"`
+	Photos   []string           `json:"photos" bson:"photos"`
+	Readings map[string]float64 `json:"readings,omitempty" bson:"readings,omitempty"` // e.g. "odometer", "fuel"
+	Notes    string             `json:"notes,omitempty" bson:"notes,omitempty"`
+}
+
+// ChecklistEntry is one checked aspect of an item, e.g. "Screen" or "Tyres"
+type ChecklistEntry struct {
+	Label string `json:"label" bson:"label"`
+	OK    bool   `json:"ok" bson:"ok"`
+	Note  string `json:"note,omitempty" bson:"note,omitempty"`
+}
+
+// Refund is the money returned to the renter when a paid booking ends early
+type Refund struct {
+	Amount        float64      `json:"amount" bson:"amount"`
+	RentalAmount  float64      `json:"rentalAmount" bson:"rentalAmount"`
+	DepositAmount float64      `json:"depositAmount" bson:"depositAmount"`
+	Percent       float64      `json:"percent" bson:"percent"` // of the rental
+	Policy        string       `json:"policy" bson:"policy"`
+	Status        string       `json:"status" bson:"status"`                         // "pending", "processed"
+	RefundID      string       `json:"refundId,omitempty" bson:"refundId,omitempty"` // the last part's
+	Parts         []RefundPart `json:"parts,omitempty" bson:"parts,omitempty"`       // one per captured payment refunded
+	CreatedAt     time.Time    `json:"createdAt" bson:"createdAt"`
+	ProcessedAt   *time.Time   `json:"processedAt,omitempty" bson:"processedAt,omitempty"`
+}
+
+// Deposit is the refundable security deposit held against a booking
+type Deposit struct {
+	Amount         float64      `json:"amount" bson:"amount"`
+	Status         string       `json:"status" bson:"status"` // "pending", "held", "released", "partially_claimed", "fully_claimed"
+	ClaimedAmount  float64      `json:"claimedAmount,omitempty" bson:"claimedAmount,omitempty"`
+	RefundedAmount float64      `json:"refundedAmount,omitempty" bson:"refundedAmount,omitempty"`
+	RefundStatus   string       `json:"refundStatus,omitempty" bson:"refundStatus,omitempty"` // set when released after handover; before it, the booking's refund returns it
+	RefundID       string       `json:"refundId,omitempty" bson:"refundId,omitempty"`         // the last part's
+	RefundParts    []RefundPart `json:"refundParts,omitempty" bson:"refundParts,omitempty"`
+	Claim          *DamageClaim `json:"claim,omitempty" bson:"claim,omitempty"`
+	HeldAt         *time.Time   `json:"heldAt,omitempty" bson:"heldAt,omitempty"`
+	ReleasedAt     *time.Time   `json:"releasedAt,omitempty" bson:"releasedAt,omitempty"`
+}
+
+// DamageClaim is an owner's claim against a booking's deposit
+type DamageClaim struct {
+	Amount      float64    `json:"amount" bson:"amount"`
+	Description string     `json:"description" bson:"description"`
+	Photos      []string   `json:"photos" bson:"photos"`
+	Status      string     `json:"status" bson:"status"` // "open", "accepted", "disputed", "resolved"
+	RenterNote  string     `json:"renterNote,omitempty" bson:"renterNote,omitempty"`
+	FiledAt     time.Time  `json:"filedAt" bson:"filedAt"`
+	RespondBy   time.Time  `json:"respondBy" bson:"respondBy"` // accepted for the renter if still open then
+	RespondedAt *time.Time `json:"respondedAt,omitempty" bson:"respondedAt,omitempty"`
+	// Set when support settles the claim
+	ResolvedBy     *primitive.ObjectID `json:"resolvedBy,omitempty" bson:"resolvedBy,omitempty"`
+	ResolvedAt     *time.Time          `json:"resolvedAt,omitempty" bson:"resolvedAt,omitempty"`
+	ResolutionNote string              `json:"resolutionNote,omitempty" bson:"resolutionNote,omitempty"`
+}
+
+// StatusChange records one booking status transition
+type StatusChange struct {
+	From   string              `json:"from,omitempty" bson:"from,omitempty"`
+	To     string              `json:"to" bson:"to"`
+	By     *primitive.ObjectID `json:"by,omitempty" bson:"by,omitempty"` // nil for system changes
+	Role   string              `json:"role" bson:"role"`                 // "owner", "renter" or "system"
+	Reason string              `json:"reason,omitempty" bson:"reason,omitempty"`
+	At     time.Time           `json:"at" bson:"at"`
+}
+
+// PriceLineItem is one row of a booking's price breakdown
+type PriceLineItem struct {
+	Code      string  `json:"code" bson:"code"` // e.g. "rental_daily", "platform_fee", "tax"
+	Label     string  `json:"label" bson:"label"`
+	Quantity  float64 `json:"quantity" bson:"quantity"`
+	UnitPrice float64 `json:"unitPrice" bson:"unitPrice"`
+	Amount    float64 `json:"amount" bson:"amount"`
 }
 
 // Chat model
@@ -90,11 +470,30 @@ type Message struct {
 	ChatID    primitive.ObjectID `json:"chatId" bson:"chatId"`
 	SenderID  primitive.ObjectID `json:"senderId" bson:"senderId"`
 	Sender    *User              `json:"sender,omitempty" bson:"-"`
-	Content   string             `json:"content" bson:"content"`
+	Type      string             `json:"type,omitempty" bson:"type,omitempty"` // "offer", or empty for text
+	Content   string             `json:"content" bson:"content"`               // for offers, a summary for older clients
+	Offer     *Offer             `json:"offer,omitempty" bson:"offer,omitempty"`
 	IsRead    bool               `json:"isRead" bson:"isRead"`
 	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
 }
 
+// Offer is a price proposed in chat for renting the chat's item. The other
+// side can accept it, which books the item at that price, decline it or
+// answer with a counter-offer.
+type Offer struct {
+	ItemID      primitive.ObjectID  `json:"itemId" bson:"itemId"`
+	StartDate   time.Time           `json:"startDate" bson:"startDate"`
+	EndDate     time.Time           `json:"endDate" bson:"endDate"`
+	Quantity    int                 `json:"quantity" bson:"quantity"`
+	Price       float64             `json:"price" bson:"price"`                             // rental amount, before platform fee and tax
+	ListPrice   float64             `json:"listPrice" bson:"listPrice"`                     // rental amount at the item's own rates
+	Total       float64             `json:"total" bson:"total"`                             // what the renter pays, deposit aside
+	Status      string              `json:"status" bson:"status"`                           // pending, accepted, declined, countered or superseded
+	InReplyTo   *primitive.ObjectID `json:"inReplyTo,omitempty" bson:"inReplyTo,omitempty"` // the offer this counters
+	BookingID   *primitive.ObjectID `json:"bookingId,omitempty" bson:"bookingId,omitempty"` // set once accepted
+	RespondedAt *time.Time          `json:"respondedAt,omitempty" bson:"respondedAt,omitempty"`
+}
+
 // Favorite model
 type Favorite struct {
 	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
@@ -126,13 +525,14 @@ type Report struct {
 
 // Review model - for item and user reviews
 type Review struct {
-	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	BookingID  primitive.ObjectID `json:"bookingId" bson:"bookingId"`
-	ReviewerID primitive.ObjectID `json:"reviewerId" bson:"reviewerId"`
-	Reviewer   *User              `json:"reviewer,omitempty" bson:"-"`
-	TargetType string             `json:"targetType" bson:"targetType"` // "item" or "user"
-	TargetID   primitive.ObjectID `json:"targetId" bson:"targetId"`
-	Rating     int                `json:"rating" bson:"rating"`   // 1-5 stars
-	Comment    string             `json:"comment" bson:"comment"` // max 100 chars
-	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	BookingID      primitive.ObjectID `json:"bookingId" bson:"bookingId"`
+	ReviewerID     primitive.ObjectID `json:"reviewerId" bson:"reviewerId"`
+	Reviewer       *User              `json:"reviewer,omitempty" bson:"-"`
+	TargetType     string             `json:"targetType" bson:"targetType"` // "item" or "user"
+	TargetID       primitive.ObjectID `json:"targetId" bson:"targetId"`
+	Rating         int                `json:"rating" bson:"rating"`                 // 1-5 stars
+	Comment        string             `json:"comment" bson:"comment"`               // max 100 chars
+	VerifiedRental bool               `json:"verifiedRental" bson:"verifiedRental"` // the item was handed over with a recorded checklist
+	CreatedAt      time.Time          `json:"createdAt" bson:"createdAt"`
 }
@@ -0,0 +1,314 @@
+package backend
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Modification statuses
+const (
+	ModificationPending  = "pending"
+	ModificationAccepted = "accepted"
+	ModificationRejected = "rejected"
+)
+
+// modifiableStatuses are the booking statuses in which dates can still change
+var modifiableStatuses = []string{StatusPending, StatusConfirmed, StatusHandedOver}
+
+func isModifiable(status string) bool {
+	for _, s := range modifiableStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// requestModification lets the renter propose new dates for a booking. The
+// new dates are checked against availability and re-priced; the owner then
+// accepts or rejects the proposal.
+func requestModification(w http.ResponseWriter, r *http.Request, id string) {
+	userID, _ := GetUserID(r)
+
+	var req struct {
+		StartDate string `json:"startDate"`
+		EndDate   string `json:"endDate"`
+		Note      string `json:"note"`
+	}
+	if err := DecodeJSON(r, &req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	startDate, endDate, err := parseBookingDates(req.StartDate, req.EndDate)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	booking, role, ok := findBookingForUser(ctx, w, id, userID)
+	if !ok {
+		return
+	}
+	if role != RoleRenter {
+		JSONError(w, http.StatusForbidden, "Only the renter can request a modification")
+		return
+	}
+	if !isModifiable(booking.Status) {
+		JSONError(w, http.StatusConflict, "A "+booking.Status+" booking can't be modified")
+		return
+	}
+	// Re-pricing would drop the agreed price
+	if booking.OfferID != nil {
+		JSONError(w, http.StatusConflict, "A booking made from an offer can't be modified, make a new offer in chat instead")
+		return
+	}
+	if booking.SubscriptionID != nil {
+		JSONError(w, http.StatusConflict, "Subscription bookings can't be modified, give notice on the subscription instead")
+		return
+	}
+	if booking.Status == StatusHandedOver && !startDate.Equal(booking.StartDate) {
+		JSONError(w, http.StatusBadRequest, "The start date can't change once the item is handed over")
+		return
+	}
+	if startDate.Equal(booking.StartDate) && endDate.Equal(booking.EndDate) {
+		JSONError(w, http.StatusBadRequest, "The new dates are the same as the current ones")
+		return
+	}
+
+	var item Item
+	if err := GetCollection("items").FindOne(ctx, bson.M{"_id": booking.ItemID}).Decode(&item); err != nil {
+		JSONError(w, http.StatusNotFound, "Item not found")
+		return
+	}
+
+	quote, err := calculateQuote(&item, startDate, endDate, booking.units())
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	conflicts, err := checkAvailability(ctx, &item, startDate, endDate, booking.ID, booking.units())
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to check availability")
+		return
+	}
+	if len(conflicts) > 0 {
+		JSON(w, http.StatusConflict, map[string]interface{}{
+			"error":     "Item is not available for the selected dates",
+			"conflicts": conflicts,
+		})
+		return
+	}
+
+	mod := Modification{
+		ID:              primitive.NewObjectID(),
+		StartDate:       startDate,
+		EndDate:         endDate,
+		TotalPrice:      quote.Total,
+		LineItems:       quote.LineItems,
+		PriceDifference: roundMoney(quote.Total - booking.TotalPrice),
+		Note:            req.Note,
+		Status:          ModificationPending,
+		CreatedAt:       time.Now(),
+	}
+
+	// Only one open proposal at a time
+	result, err := GetCollection("bookings").UpdateOne(ctx,
+		bson.M{
+			"_id":           booking.ID,
+			"modifications": bson.M{"$not": bson.M{"$elemMatch": bson.M{"status": ModificationPending}}},
+		},
+		bson.M{"$push": bson.M{"modifications": mod}, "$set": bson.M{"updatedAt": time.Now()}},
+	)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to request modification")
+		return
+	}
+	if result.MatchedCount == 0 {
+		JSONError(w, http.StatusConflict, "There is already a pending modification for this booking")
+		return
+	}
+
+	notifyBookingEvent(ctx, booking, booking.OwnerID, "modification_requested")
+
+	JSON(w, http.StatusCreated, map[string]interface{}{"message": "Modification requested", "modification": mod})
+}
+
+// respondToModification lets the owner accept or reject a proposed change.
+// Accepting re-checks availability under the item lock and applies the new
+// dates and price in a single update.
+func respondToModification(w http.ResponseWriter, r *http.Request, id, modID string) {
+	userID, _ := GetUserID(r)
+
+	modificationID, err := primitive.ObjectIDFromHex(modID)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid modification ID")
+		return
+	}
+
+	var req struct {
+		Action string `json:"action"` // "accept" or "reject"
+	}
+	if err := DecodeJSON(r, &req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if req.Action != "accept" && req.Action != "reject" {
+		JSONError(w, http.StatusBadRequest, "Action must be 'accept' or 'reject'")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	booking, role, ok := findBookingForUser(ctx, w, id, userID)
+	if !ok {
+		return
+	}
+	if role != RoleOwner {
+		JSONError(w, http.StatusForbidden, "Only the owner can respond to a modification")
+		return
+	}
+
+	mod := booking.modification(modificationID)
+	if mod == nil {
+		JSONError(w, http.StatusNotFound, "Modification not found")
+		return
+	}
+	if mod.Status != ModificationPending {
+		JSONError(w, http.StatusConflict, "Modification has already been "+mod.Status)
+		return
+	}
+
+	now := time.Now()
+	filter := bson.M{
+		"_id":           booking.ID,
+		"status":        booking.Status,
+		"modifications": bson.M{"$elemMatch": bson.M{"_id": modificationID, "status": ModificationPending}},
+	}
+	set := bson.M{"modifications.$.respondedAt": now, "updatedAt": now}
+	update := bson.M{"$set": set}
+	action := "modification_rejected"
+
+	if req.Action == "reject" {
+		set["modifications.$.status"] = ModificationRejected
+	} else {
+		action = "modification_accepted"
+		if !isModifiable(booking.Status) {
+			JSONError(w, http.StatusConflict, "A "+booking.Status+" booking can't be modified")
+			return
+		}
+
+		release, err := lockItem(ctx, booking.ItemID)
+		if err != nil {
+			JSONError(w, http.StatusConflict, "Item is being booked by someone else, please retry")
+			return
+		}
+		defer release()
+
+		var item Item
+		GetCollection("items").FindOne(ctx, bson.M{"_id": booking.ItemID}).Decode(&item)
+		conflicts, err := checkAvailability(ctx, &item, mod.StartDate, mod.EndDate, booking.ID, booking.units())
+		if err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to check availability")
+			return
+		}
+		if len(conflicts) > 0 {
+			JSON(w, http.StatusConflict, map[string]interface{}{
+				"error":     "Item is no longer available for the requested dates",
+				"conflicts": conflicts,
+			})
+			return
+		}
+
+		set["modifications.$.status"] = ModificationAccepted
+		set["startDate"] = mod.StartDate
+		set["endDate"] = mod.EndDate
+		set["totalPrice"] = mod.TotalPrice
+		set["lineItems"] = mod.LineItems
+
+		// A paid booking that got more expensive needs the difference paid
+		// before it can progress; a cheaper one is refunded the difference
+		if booking.PaymentStatus == PaymentPaid {
+			switch {
+			case mod.PriceDifference > 0:
+				set["paymentStatus"] = PaymentPending
+			case mod.PriceDifference < 0:
+				set["modifications.$.refundStatus"] = RefundPending
+				update["$inc"] = bson.M{"payment.amountPaid": mod.PriceDifference}
+			}
+		}
+	}
+
+	result, err := GetCollection("bookings").UpdateOne(ctx, filter, update)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to update modification")
+		return
+	}
+	if result.MatchedCount == 0 {
+		JSONError(w, http.StatusConflict, "Booking has changed, please refresh")
+		return
+	}
+
+	GetCollection("bookings").FindOne(ctx, bson.M{"_id": booking.ID}).Decode(booking)
+	if req.Action == "accept" {
+		// A failed refund is retried by the scheduler
+		issueModificationRefunds(ctx, booking)
+	}
+	notifyBookingEvent(ctx, booking, booking.RenterID, action)
+
+	JSON(w, http.StatusOK, map[string]interface{}{"message": "Modification " + booking.modification(modificationID).Status, "booking": booking})
+}
+
+// modification returns the booking's modification with the given ID, or nil
+func (b *Booking) modification(id primitive.ObjectID) *Modification {
+	for i := range b.Modifications {
+		if b.Modifications[i].ID == id {
+			return &b.Modifications[i]
+		}
+	}
+	return nil
+}
+
+// issueModificationRefunds refunds the price difference of accepted
+// modifications that shortened a paid booking
+func issueModificationRefunds(ctx context.Context, booking *Booking) {
+	for i := range booking.Modifications {
+		mod := &booking.Modifications[i]
+		if mod.RefundStatus != RefundPending {
+			continue
+		}
+
+		parts, err := refundCaptures(ctx, booking, -mod.PriceDifference, false, mod.RefundParts,
+			"modifications.$[m].refundParts", bson.M{"m._id": mod.ID})
+		mod.RefundParts = parts
+		if err != nil {
+			log.Printf("Error refunding modification %s of booking %s: %v", mod.ID.Hex(), booking.ID.Hex(), err)
+			continue
+		}
+		refundID := lastRefundID(parts)
+
+		_, err = GetCollection("bookings").UpdateOne(ctx,
+			bson.M{"_id": booking.ID, "modifications": bson.M{"$elemMatch": bson.M{"_id": mod.ID, "refundStatus": RefundPending}}},
+			bson.M{"$set": bson.M{
+				"modifications.$.refundStatus": RefundProcessed,
+				"modifications.$.refundId":     refundID,
+			}},
+		)
+		if err != nil {
+			log.Printf("Error recording refund %s: %v", refundID, err)
+			continue
+		}
+		mod.RefundStatus = RefundProcessed
+		mod.RefundID = refundID
+		notifyBookingEvent(ctx, booking, booking.RenterID, "refund_processed")
+	}
+}
@@ -0,0 +1,398 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MessageOffer is the type of chat messages that carry an Offer
+const MessageOffer = "offer"
+
+// Offer statuses
+const (
+	OfferPending    = "pending"
+	OfferAccepted   = "accepted"
+	OfferDeclined   = "declined"
+	OfferCountered  = "countered"
+	OfferSuperseded = "superseded" // a newer offer was made in the chat
+)
+
+// offerRequest is an offer or counter-offer as sent by a client
+type offerRequest struct {
+	StartDate string  `json:"startDate"`
+	EndDate   string  `json:"endDate"`
+	Quantity  int     `json:"quantity"`
+	Price     float64 `json:"price"`
+}
+
+// offerError is returned when an offer can't be made or answered
+type offerError struct {
+	Code    int
+	Message string
+}
+
+func (e *offerError) Error() string {
+	return e.Message
+}
+
+// offerRenter returns the participant of a chat who would rent its item
+func offerRenter(chat *Chat, item *Item) (primitive.ObjectID, bool) {
+	if len(chat.Participants) != 2 {
+		return primitive.NilObjectID, false
+	}
+	switch item.OwnerID {
+	case chat.Participants[0]:
+		return chat.Participants[1], true
+	case chat.Participants[1]:
+		return chat.Participants[0], true
+	}
+	return primitive.NilObjectID, false
+}
+
+// findOfferChat loads a chat userID takes part in, and the item it is about
+func findOfferChat(ctx context.Context, chatID string, userID primitive.ObjectID) (*Chat, *Item, error) {
+	id, err := primitive.ObjectIDFromHex(chatID)
+	if err != nil {
+		return nil, nil, &offerError{http.StatusBadRequest, "Invalid chat ID"}
+	}
+
+	var chat Chat
+	if err := GetCollection("chats").FindOne(ctx, bson.M{"_id": id, "participants": userID}).Decode(&chat); err != nil {
+		return nil, nil, &offerError{http.StatusNotFound, "Chat not found"}
+	}
+	if chat.ItemID.IsZero() {
+		return nil, nil, &offerError{http.StatusBadRequest, "Offers can only be made in a chat about an item"}
+	}
+
+	var item Item
+	if err := GetCollection("items").FindOne(ctx, bson.M{"_id": chat.ItemID}).Decode(&item); err != nil {
+		return nil, nil, &offerError{http.StatusNotFound, "Item not found"}
+	}
+	if _, ok := offerRenter(&chat, &item); !ok {
+		return nil, nil, &offerError{http.StatusBadRequest, "Offers can only be made between the owner and a renter"}
+	}
+	return &chat, &item, nil
+}
+
+// findOffer loads an offer message of a chat
+func findOffer(ctx context.Context, chat *Chat, messageID string) (*Message, error) {
+	id, err := primitive.ObjectIDFromHex(messageID)
+	if err != nil {
+		return nil, &offerError{http.StatusBadRequest, "Invalid offer ID"}
+	}
+	var message Message
+	err = GetCollection("messages").FindOne(ctx, bson.M{"_id": id, "chatId": chat.ID, "type": MessageOffer}).Decode(&message)
+	if err != nil || message.Offer == nil {
+		return nil, &offerError{http.StatusNotFound, "Offer not found"}
+	}
+	return &message, nil
+}
+
+// newOffer checks an offer by senderID on the chat's item and prices it.
+// replyTo is the offer it counters, if any: only the renter can open the
+// negotiation, after which each side answers the other.
+func newOffer(ctx context.Context, chat *Chat, item *Item, senderID primitive.ObjectID, req offerRequest, replyTo *Message) (*Offer, error) {
+	if replyTo == nil && senderID == item.OwnerID {
+		return nil, &offerError{http.StatusForbidden, "Only the renter can make an offer, counter theirs instead"}
+	}
+	if replyTo != nil {
+		if replyTo.SenderID == senderID {
+			return nil, &offerError{http.StatusForbidden, "You can't counter your own offer"}
+		}
+		if replyTo.Offer.Status != OfferPending {
+			return nil, &offerError{http.StatusConflict, "This offer has already been answered"}
+		}
+	}
+	if item.Status != "active" {
+		return nil, &offerError{http.StatusConflict, "Item is not available for rent"}
+	}
+
+	start, end, err := parseBookingDates(req.StartDate, req.EndDate)
+	if err != nil {
+		return nil, &offerError{http.StatusBadRequest, err.Error()}
+	}
+	if !start.After(time.Now()) {
+		return nil, &offerError{http.StatusBadRequest, "Offers must start in the future"}
+	}
+
+	list, err := calculateQuote(item, start, end, req.Quantity)
+	if err != nil {
+		return nil, &offerError{http.StatusBadRequest, err.Error()}
+	}
+	quote, err := negotiatedQuote(item, start, end, req.Quantity, req.Price)
+	if err != nil {
+		return nil, &offerError{http.StatusBadRequest, err.Error()}
+	}
+
+	conflicts, err := checkAvailability(ctx, item, start, end, primitive.NilObjectID, quote.Quantity)
+	if err != nil {
+		return nil, &offerError{http.StatusInternalServerError, "Failed to check availability"}
+	}
+	if len(conflicts) > 0 {
+		return nil, &offerError{http.StatusConflict, "Item is not available for the selected dates"}
+	}
+
+	offer := &Offer{
+		ItemID:    item.ID,
+		StartDate: start,
+		EndDate:   end,
+		Quantity:  quote.Quantity,
+		Price:     rentalAmount(quote),
+		ListPrice: rentalAmount(list),
+		Total:     quote.Total,
+		Status:    OfferPending,
+	}
+	if replyTo != nil {
+		offer.InReplyTo = &replyTo.ID
+	}
+	return offer, nil
+}
+
+// offerSummary describes an offer in words, shown by clients that don't
+// render offers and in push notifications
+func offerSummary(offer *Offer, counter bool) string {
+	kind := "Offer"
+	if counter {
+		kind = "Counter-offer"
+	}
+	units := ""
+	if offer.Quantity > 1 {
+		units = fmt.Sprintf(", %d units", offer.Quantity)
+	}
+	return fmt.Sprintf("%s: %s for %s to %s%s", kind, formatMoney(offer.Price),
+		offer.StartDate.Format(documentTimeLayout), offer.EndDate.Format(documentTimeLayout), units)
+}
+
+// sendOffer posts an offer from senderID in a chat, countering replyTo if
+// set. Older offers still pending in the chat are superseded by it.
+func sendOffer(senderID primitive.ObjectID, chatID string, req offerRequest, replyTo *Message) (*Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	chat, item, err := findOfferChat(ctx, chatID, senderID)
+	if err != nil {
+		return nil, err
+	}
+	offer, err := newOffer(ctx, chat, item, senderID, req, replyTo)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if replyTo != nil {
+		result, err := GetCollection("messages").UpdateOne(ctx,
+			bson.M{"_id": replyTo.ID, "offer.status": OfferPending},
+			bson.M{"$set": bson.M{"offer.status": OfferCountered, "offer.respondedAt": now}},
+		)
+		if err != nil {
+			return nil, &offerError{http.StatusInternalServerError, "Failed to update offer"}
+		}
+		if result.MatchedCount == 0 {
+			return nil, &offerError{http.StatusConflict, "This offer has already been answered"}
+		}
+		replyTo.Offer.Status = OfferCountered
+		replyTo.Offer.RespondedAt = &now
+		broadcastOfferUpdate(chat, replyTo)
+	}
+	GetCollection("messages").UpdateMany(ctx,
+		bson.M{"chatId": chat.ID, "type": MessageOffer, "offer.status": OfferPending},
+		bson.M{"$set": bson.M{"offer.status": OfferSuperseded, "offer.respondedAt": now}},
+	)
+
+	message, err := saveAndBroadcastMessage(senderID, chatID, offerSummary(offer, replyTo != nil), offer)
+	if err != nil {
+		return nil, &offerError{http.StatusInternalServerError, "Failed to send offer"}
+	}
+	return message, nil
+}
+
+// broadcastOfferUpdate tells a chat's participants that an offer's status changed
+func broadcastOfferUpdate(chat *Chat, message *Message) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":    "offer_updated",
+		"chatId":  chat.ID.Hex(),
+		"message": message,
+	})
+	hub.BroadcastToRoom(chat.ID.Hex(), data)
+	hub.NotifyUser(message.SenderID.Hex(), data)
+}
+
+// offerResponseError writes err as a JSON error response
+func offerResponseError(w http.ResponseWriter, err error) {
+	if oe, ok := err.(*offerError); ok {
+		JSONError(w, oe.Code, oe.Message)
+		return
+	}
+	JSONError(w, http.StatusInternalServerError, "Failed to process offer")
+}
+
+// handleChatOffer serves POST /api/chats/{chatId}/offers/{messageId}/{action},
+// where action is accept, decline or counter
+func handleChatOffer(w http.ResponseWriter, r *http.Request, chatID, rest string) {
+	if r.Method != http.MethodPost {
+		JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	messageID, action, _ := strings.Cut(rest, "/")
+	switch action {
+	case "accept", "decline", "counter":
+	default:
+		JSONError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	chat, item, err := findOfferChat(ctx, chatID, userID)
+	if err != nil {
+		offerResponseError(w, err)
+		return
+	}
+	message, err := findOffer(ctx, chat, messageID)
+	if err != nil {
+		offerResponseError(w, err)
+		return
+	}
+	if message.SenderID == userID {
+		JSONError(w, http.StatusForbidden, "Only the other side can answer an offer")
+		return
+	}
+
+	switch action {
+	case "accept":
+		acceptOffer(ctx, w, chat, item, message, userID)
+	case "decline":
+		declineOffer(ctx, w, chat, message)
+	case "counter":
+		var req offerRequest
+		if err := DecodeJSON(r, &req); err != nil {
+			JSONError(w, http.StatusBadRequest, "Invalid request")
+			return
+		}
+		counter, err := sendOffer(userID, chatID, req, message)
+		if err != nil {
+			offerResponseError(w, err)
+			return
+		}
+		JSON(w, http.StatusCreated, map[string]interface{}{"message": counter})
+	}
+}
+
+func declineOffer(ctx context.Context, w http.ResponseWriter, chat *Chat, message *Message) {
+	now := time.Now()
+	result, err := GetCollection("messages").UpdateOne(ctx,
+		bson.M{"_id": message.ID, "offer.status": OfferPending},
+		bson.M{"$set": bson.M{"offer.status": OfferDeclined, "offer.respondedAt": now}},
+	)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to update offer")
+		return
+	}
+	if result.MatchedCount == 0 {
+		JSONError(w, http.StatusConflict, "This offer has already been answered")
+		return
+	}
+	message.Offer.Status = OfferDeclined
+	message.Offer.RespondedAt = &now
+	broadcastOfferUpdate(chat, message)
+
+	JSON(w, http.StatusOK, map[string]interface{}{"message": message})
+}
+
+// acceptOffer books the item for the renter at the offered price. Both sides
+// have agreed to it, so the booking is confirmed as soon as it's paid for,
+// the same as an instant booking.
+func acceptOffer(ctx context.Context, w http.ResponseWriter, chat *Chat, item *Item, message *Message, userID primitive.ObjectID) {
+	offer := message.Offer
+	if offer.Status != OfferPending {
+		JSONError(w, http.StatusConflict, "This offer has already been answered")
+		return
+	}
+	if !offer.StartDate.After(time.Now()) {
+		JSONError(w, http.StatusConflict, "This offer's dates have passed")
+		return
+	}
+	renterID, _ := offerRenter(chat, item)
+
+	// The item's rates and rules may have changed since the offer was made
+	quote, err := negotiatedQuote(item, offer.StartDate, offer.EndDate, offer.Quantity, offer.Price)
+	if err != nil {
+		JSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	release, err := lockItem(ctx, item.ID)
+	if err != nil {
+		JSONError(w, http.StatusConflict, "Item is being booked by someone else, please retry")
+		return
+	}
+	defer release()
+
+	conflicts, err := checkAvailability(ctx, item, offer.StartDate, offer.EndDate, primitive.NilObjectID, quote.Quantity)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to check availability")
+		return
+	}
+	if len(conflicts) > 0 {
+		JSON(w, http.StatusConflict, map[string]interface{}{
+			"error":     "Item is no longer available for the offered dates",
+			"conflicts": conflicts,
+		})
+		return
+	}
+
+	booking := newBooking(ctx, item, renterID, quote)
+	booking.OfferID = &message.ID
+	booking.AutoConfirm = true
+	booking.RespondBy = nil
+
+	now := time.Now()
+	result, err := GetCollection("messages").UpdateOne(ctx,
+		bson.M{"_id": message.ID, "offer.status": OfferPending},
+		bson.M{"$set": bson.M{"offer.status": OfferAccepted, "offer.bookingId": booking.ID, "offer.respondedAt": now}},
+	)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to update offer")
+		return
+	}
+	if result.MatchedCount == 0 {
+		JSONError(w, http.StatusConflict, "This offer has already been answered")
+		return
+	}
+
+	if err := insertBooking(ctx, &booking); err != nil {
+		GetCollection("messages").UpdateOne(ctx, bson.M{"_id": message.ID}, bson.M{
+			"$set":   bson.M{"offer.status": OfferPending},
+			"$unset": bson.M{"offer.bookingId": "", "offer.respondedAt": ""},
+		})
+		JSONError(w, http.StatusInternalServerError, "Failed to create booking")
+		return
+	}
+
+	offer.Status = OfferAccepted
+	offer.BookingID = &booking.ID
+	offer.RespondedAt = &now
+	broadcastOfferUpdate(chat, message)
+
+	// The renter pays next, whichever side accepted
+	if userID == item.OwnerID {
+		notifyBookingEvent(ctx, &booking, renterID, "offer_accepted")
+	} else {
+		notifyBookingEvent(ctx, &booking, item.OwnerID, "counter_accepted")
+	}
+
+	JSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "Offer accepted, the renter pays to confirm the booking",
+		"offer":   message,
+		"booking": booking,
+	})
+}
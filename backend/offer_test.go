@@ -0,0 +1,113 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestOfferRenter(t *testing.T) {
+	owner, renter, other := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	item := &Item{OwnerID: owner}
+
+	tests := []struct {
+		name         string
+		participants []primitive.ObjectID
+		want         primitive.ObjectID
+		wantOK       bool
+	}{
+		{"owner first", []primitive.ObjectID{owner, renter}, renter, true},
+		{"owner second", []primitive.ObjectID{renter, owner}, renter, true},
+		{"owner not in the chat", []primitive.ObjectID{renter, other}, primitive.NilObjectID, false},
+		{"group chat", []primitive.ObjectID{owner, renter, other}, primitive.NilObjectID, false},
+		{"owner alone", []primitive.ObjectID{owner}, primitive.NilObjectID, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := offerRenter(&Chat{Participants: tt.participants}, item)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("offerRenter() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestOfferSummary(t *testing.T) {
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	offer := &Offer{StartDate: start, EndDate: start.AddDate(0, 0, 2), Quantity: 1, Price: 1500}
+	several := &Offer{StartDate: start, EndDate: start.AddDate(0, 0, 2), Quantity: 3, Price: 4000}
+
+	tests := []struct {
+		name    string
+		offer   *Offer
+		counter bool
+		want    string
+	}{
+		{"offer", offer, false, "Offer: ₹1500.00 for 01 Mar 2025 10:00 to 03 Mar 2025 10:00"},
+		{"counter-offer", offer, true, "Counter-offer: ₹1500.00 for 01 Mar 2025 10:00 to 03 Mar 2025 10:00"},
+		{"several units", several, false, "Offer: ₹4000.00 for 01 Mar 2025 10:00 to 03 Mar 2025 10:00, 3 units"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := offerSummary(tt.offer, tt.counter); got != tt.want {
+				t.Errorf("offerSummary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewOfferRejects(t *testing.T) {
+	// Offers turned away before availability is checked
+	owner, renter := primitive.NewObjectID(), primitive.NewObjectID()
+	chat := &Chat{Participants: []primitive.ObjectID{owner, renter}}
+	item := &Item{OwnerID: owner, Status: "active", Price: 500}
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Hour)
+	valid := offerRequest{
+		StartDate: start.Format(time.RFC3339),
+		EndDate:   start.AddDate(0, 0, 2).Format(time.RFC3339),
+		Price:     800,
+	}
+	with := func(change func(r *offerRequest)) offerRequest {
+		r := valid
+		change(&r)
+		return r
+	}
+	fromRenter := &Message{SenderID: renter, Offer: &Offer{Status: OfferPending}}
+	answered := &Message{SenderID: renter, Offer: &Offer{Status: OfferDeclined}}
+
+	tests := []struct {
+		name     string
+		item     *Item
+		sender   primitive.ObjectID
+		req      offerRequest
+		replyTo  *Message
+		wantCode int
+	}{
+		{"owner opens", item, owner, valid, nil, http.StatusForbidden},
+		{"counters own offer", item, renter, valid, fromRenter, http.StatusForbidden},
+		{"counters an answered offer", item, owner, valid, answered, http.StatusConflict},
+		{"item not active", &Item{OwnerID: owner, Status: "inactive", Price: 500}, renter, valid, nil, http.StatusConflict},
+		{"bad dates", item, renter, with(func(r *offerRequest) { r.StartDate = "tomorrow" }), nil, http.StatusBadRequest},
+		{"in the past", item, renter, with(func(r *offerRequest) {
+			r.StartDate = start.AddDate(0, 0, -4).Format(time.RFC3339)
+			r.EndDate = start.AddDate(0, 0, -3).Format(time.RFC3339)
+		}), nil, http.StatusBadRequest},
+		{"no price", item, renter, with(func(r *offerRequest) { r.Price = 0 }), nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newOffer(context.Background(), chat, tt.item, tt.sender, tt.req, tt.replyTo)
+			var offerErr *offerError
+			if !errors.As(err, &offerErr) {
+				t.Fatalf("newOffer() error = %v, want an offerError", err)
+			}
+			if offerErr.Code != tt.wantCode {
+				t.Errorf("newOffer() code = %d (%s), want %d", offerErr.Code, offerErr.Message, tt.wantCode)
+			}
+		})
+	}
+}
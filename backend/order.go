@@ -0,0 +1,325 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// HandleOrders serves GET /api/orders, the renter's cart checkouts
+func HandleOrders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := GetCollection("orders").Find(ctx, bson.M{"renterId": userID}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to fetch orders")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	orders := []Order{}
+	for cursor.Next(ctx) {
+		var order Order
+		if err := cursor.Decode(&order); err != nil {
+			continue
+		}
+		order.Bookings = orderBookings(ctx, &order)
+		orders = append(orders, order)
+	}
+
+	JSON(w, http.StatusOK, map[string]interface{}{"orders": orders})
+}
+
+// HandleOrderByID serves GET /api/orders/{id} and POST /api/orders/{id}/pay
+func HandleOrderByID(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/orders/"), "/")
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		getOrder(w, r, id)
+	case action == "pay" && r.Method == http.MethodPost:
+		payOrder(w, r, id)
+	case action == "" || action == "pay":
+		JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		JSONError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// findOrderForRenter loads an order and checks userID placed it. It writes
+// the error response itself and returns nil if not.
+func findOrderForRenter(ctx context.Context, w http.ResponseWriter, id string, userID primitive.ObjectID) *Order {
+	orderID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid order ID")
+		return nil
+	}
+
+	var order Order
+	if err := GetCollection("orders").FindOne(ctx, bson.M{"_id": orderID}).Decode(&order); err != nil {
+		JSONError(w, http.StatusNotFound, "Order not found")
+		return nil
+	}
+	if order.RenterID != userID {
+		JSONError(w, http.StatusForbidden, "Access denied")
+		return nil
+	}
+	return &order
+}
+
+// orderBookings loads the bookings of an order with their items and owners
+func orderBookings(ctx context.Context, order *Order) []Booking {
+	bookings := []Booking{}
+	cursor, err := GetCollection("bookings").Find(ctx, bson.M{"_id": bson.M{"$in": order.BookingIDs}})
+	if err != nil {
+		return bookings
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var booking Booking
+		if err := cursor.Decode(&booking); err != nil {
+			continue
+		}
+		populateBooking(ctx, &booking)
+		bookings = append(bookings, booking)
+	}
+	return bookings
+}
+
+func getOrder(w http.ResponseWriter, r *http.Request, id string) {
+	userID, _ := GetUserID(r)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	order := findOrderForRenter(ctx, w, id, userID)
+	if order == nil {
+		return
+	}
+	order.Bookings = orderBookings(ctx, order)
+
+	JSON(w, http.StatusOK, map[string]interface{}{"order": order})
+}
+
+// orderPayable reports whether a booking of an order is still waiting on the
+// order's payment
+func orderPayable(booking *Booking) bool {
+	return !booking.paid() && (booking.Status == StatusPending || booking.Status == StatusConfirmed)
+}
+
+// payOrder creates one payment order for every booking of an order that
+// hasn't been paid for yet. Bookings already rejected or cancelled are left
+// out.
+func payOrder(w http.ResponseWriter, r *http.Request, id string) {
+	userID, _ := GetUserID(r)
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	order := findOrderForRenter(ctx, w, id, userID)
+	if order == nil {
+		return
+	}
+	if order.PaymentStatus == PaymentPaid {
+		JSONError(w, http.StatusConflict, "Order is already paid")
+		return
+	}
+
+	var shares []OrderShare
+	total := 0.0
+	for _, booking := range orderBookings(ctx, order) {
+		if !orderPayable(&booking) {
+			continue
+		}
+		due := amountDue(&booking)
+		shares = append(shares, OrderShare{BookingID: booking.ID, Amount: due})
+		total += due
+	}
+	total = roundMoney(total)
+	if total <= 0 {
+		JSONError(w, http.StatusConflict, "Nothing in this order is left to pay for")
+		return
+	}
+
+	paymentOrder, err := paymentProvider().CreateOrder(ctx, OrderRequest{
+		Amount:   total,
+		Currency: "INR",
+		Receipt:  order.ID.Hex(),
+		Notes:    map[string]string{"orderId": order.ID.Hex()},
+	})
+	if err != nil {
+		log.Printf("Error creating payment order: %v", err)
+		JSONError(w, http.StatusBadGateway, "Failed to create payment order")
+		return
+	}
+
+	for i := range shares {
+		shares[i].PaymentOrderID = paymentOrder.ID
+	}
+	// Earlier shares are kept so a late payment of an older order is split
+	// the way that order was
+	_, err = GetCollection("orders").UpdateOne(ctx, bson.M{"_id": order.ID}, bson.M{
+		"$set": bson.M{
+			"payment.provider": paymentOrder.Provider,
+			"payment.orderId":  paymentOrder.ID,
+			"payment.amount":   paymentOrder.Amount,
+			"updatedAt":        time.Now(),
+		},
+		"$addToSet": bson.M{"payment.orderIds": paymentOrder.ID},
+		"$push":     bson.M{"shares": bson.M{"$each": shares}},
+	})
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to save payment order")
+		return
+	}
+
+	JSON(w, http.StatusCreated, map[string]interface{}{"order": paymentOrder})
+}
+
+// handleOrderPaymentEvent applies a payment event to an order
+func handleOrderPaymentEvent(ctx context.Context, order *Order, event *PaymentEvent) error {
+	switch event.Type {
+	case PaymentEventAuthorized:
+		return paymentProvider().Capture(ctx, event.PaymentID, event.Amount)
+	case PaymentEventCaptured:
+		return markOrderPaid(ctx, order, event)
+	case PaymentEventFailed:
+		_, err := GetCollection("orders").UpdateOne(ctx,
+			bson.M{"_id": order.ID, "paymentStatus": bson.M{"$ne": PaymentPaid}},
+			bson.M{"$set": bson.M{"paymentStatus": PaymentFailed, "updatedAt": time.Now()}},
+		)
+		return err
+	}
+	return nil
+}
+
+// paymentOrderShares returns the shares of the payment order paymentOrderID
+func paymentOrderShares(order *Order, paymentOrderID string) []OrderShare {
+	var shares []OrderShare
+	for _, share := range order.Shares {
+		if share.PaymentOrderID == paymentOrderID {
+			shares = append(shares, share)
+		}
+	}
+	return shares
+}
+
+// markOrderPaid splits a captured order payment between its bookings the way
+// the paid payment order was split. Each booking is marked paid with its
+// share, as if paid on its own. A booking that was rejected or cancelled
+// while the renter was paying is refunded its share straight away.
+func markOrderPaid(ctx context.Context, order *Order, event *PaymentEvent) error {
+	shares := paymentOrderShares(order, event.OrderID)
+	if len(shares) == 0 {
+		return fmt.Errorf("order %s has no shares for payment order %s", order.ID.Hex(), event.OrderID)
+	}
+
+	now := time.Now()
+	_, err := GetCollection("orders").UpdateOne(ctx, bson.M{"_id": order.ID}, bson.M{"$set": bson.M{
+		"paymentStatus":      PaymentPaid,
+		"payment.paymentId":  event.PaymentID,
+		"payment.amountPaid": event.Amount,
+		"payment.paidAt":     now,
+		"updatedAt":          now,
+	}})
+	if err != nil {
+		return err
+	}
+
+	for _, share := range shares {
+		var booking Booking
+		if err := GetCollection("bookings").FindOne(ctx, bson.M{"_id": share.BookingID}).Decode(&booking); err != nil {
+			return err
+		}
+		// Already settled by an earlier delivery of this event
+		if booking.paid() {
+			continue
+		}
+
+		payment := PaymentInfo{
+			Provider:  order.Payment.Provider,
+			OrderID:   event.OrderID,
+			PaymentID: event.PaymentID,
+			Amount:    share.Amount,
+		}
+		if orderPayable(&booking) {
+			_, err := GetCollection("bookings").UpdateOne(ctx, bson.M{"_id": booking.ID}, bson.M{"$set": bson.M{
+				"payment.provider": payment.Provider,
+				"payment.orderId":  payment.OrderID,
+				"payment.amount":   payment.Amount,
+			}})
+			if err != nil {
+				return err
+			}
+			booking.Payment = &payment
+			if err := markBookingPaid(ctx, &booking, &PaymentEvent{
+				Type:      event.Type,
+				OrderID:   event.OrderID,
+				PaymentID: event.PaymentID,
+				Amount:    share.Amount,
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := refundOrderShare(ctx, &booking, payment, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refundOrderShare records the share of an order payment a booking received
+// after it had already ended, and refunds it in full
+func refundOrderShare(ctx context.Context, booking *Booking, payment PaymentInfo, now time.Time) error {
+	payment.AmountPaid = payment.Amount
+	payment.PaidAt = &now
+	payment.Captures = []Capture{{PaymentID: payment.PaymentID, Amount: payment.Amount, PaidAt: now}}
+
+	deposit := 0.0
+	if booking.Deposit != nil {
+		deposit = booking.Deposit.Amount
+	}
+	refund := &Refund{
+		Amount:        payment.Amount,
+		RentalAmount:  roundMoney(payment.Amount - deposit),
+		DepositAmount: deposit,
+		Percent:       100,
+		Policy:        booking.CancellationPolicy,
+		Status:        RefundPending,
+		CreatedAt:     now,
+	}
+
+	result, err := GetCollection("bookings").UpdateOne(ctx,
+		bson.M{"_id": booking.ID, "payment.paidAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{
+			"payment":       payment,
+			"paymentStatus": PaymentRefunded,
+			"refund":        refund,
+			"updatedAt":     now,
+		}},
+	)
+	if err != nil || result.MatchedCount == 0 {
+		return err
+	}
+
+	booking.Payment = &payment
+	booking.PaymentStatus = PaymentRefunded
+	booking.Refund = refund
+	// A failed refund is retried by the scheduler
+	issueRefund(ctx, booking)
+	return nil
+}
@@ -0,0 +1,64 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPaymentOrderShares(t *testing.T) {
+	camera, tripod := primitive.NewObjectID(), primitive.NewObjectID()
+	// Paid for both, then tripod was extended and a second checkout opened
+	first := []OrderShare{
+		{PaymentOrderID: "order_1", BookingID: camera, Amount: 1180},
+		{PaymentOrderID: "order_1", BookingID: tripod, Amount: 236},
+	}
+	second := []OrderShare{
+		{PaymentOrderID: "order_2", BookingID: camera, Amount: 1180},
+		{PaymentOrderID: "order_2", BookingID: tripod, Amount: 354},
+	}
+	order := &Order{Shares: append(append([]OrderShare{}, first...), second...)}
+
+	tests := []struct {
+		name           string
+		paymentOrderID string
+		want           []OrderShare
+	}{
+		{"latest order", "order_2", second},
+		{"older order", "order_1", first},
+		{"unknown order", "order_3", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := paymentOrderShares(order, tt.paymentOrderID); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("paymentOrderShares() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderPayable(t *testing.T) {
+	paidAt := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		booking Booking
+		want    bool
+	}{
+		{"pending", Booking{Status: StatusPending}, true},
+		{"confirmed", Booking{Status: StatusConfirmed}, true},
+		{"already paid", Booking{Status: StatusConfirmed, Payment: &PaymentInfo{PaidAt: &paidAt}}, false},
+		{"order created but not paid", Booking{Status: StatusPending, Payment: &PaymentInfo{OrderID: "order_1"}}, true},
+		{"rejected", Booking{Status: StatusRejected}, false},
+		{"cancelled", Booking{Status: StatusCancelled}, false},
+		{"expired", Booking{Status: StatusExpired}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := orderPayable(&tt.booking); got != tt.want {
+				t.Errorf("orderPayable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
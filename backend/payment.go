@@ -0,0 +1,557 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Booking payment statuses
+const (
+	PaymentPending  = "pending"
+	PaymentPaid     = "paid"
+	PaymentFailed   = "failed"
+	PaymentRefunded = "refunded"
+
+	PaymentPartiallyPaid     = "partially_paid" // an older order paid less than is now due
+	PaymentPartiallyRefunded = "partially_refunded"
+)
+
+// Normalised payment event types, named after Razorpay's webhook events
+const (
+	PaymentEventAuthorized = "payment.authorized"
+	PaymentEventCaptured   = "payment.captured"
+	PaymentEventFailed     = "payment.failed"
+)
+
+var errInvalidSignature = errors.New("invalid webhook signature")
+
+// PaymentProvider is a payment gateway
+type PaymentProvider interface {
+	// Name identifies the provider, e.g. "razorpay"
+	Name() string
+	// CreateOrder creates an order the client completes in the gateway's checkout
+	CreateOrder(ctx context.Context, req OrderRequest) (*PaymentOrder, error)
+	// Capture captures an authorized payment
+	Capture(ctx context.Context, paymentID string, amount float64) error
+	// Refund refunds amount of a captured payment
+	Refund(ctx context.Context, paymentID string, amount float64) (*PaymentRefund, error)
+	// ChargeRecurring charges a payment method saved by an earlier recurring
+	// order, without the customer present. The outcome arrives as webhook
+	// events for the returned order.
+	ChargeRecurring(ctx context.Context, mandate string, req OrderRequest) (*PaymentOrder, error)
+	// SignatureHeader is the request header carrying the webhook signature
+	SignatureHeader() string
+	// VerifyWebhookSignature checks a webhook payload against its signature
+	VerifyWebhookSignature(payload []byte, signature string) error
+	// ParseWebhookEvent decodes a verified webhook payload
+	ParseWebhookEvent(payload []byte) (*PaymentEvent, error)
+}
+
+// OrderRequest describes an order to create
+type OrderRequest struct {
+	Amount   float64
+	Currency string
+	Receipt  string // our reference, e.g. the booking tracking ID
+	Notes    map[string]string
+	// Recurring saves the payment method for ChargeRecurring; it is reported
+	// as the Mandate of the captured payment
+	Recurring bool
+	// Customer is who a Recurring order saves the payment method for
+	Customer *PaymentCustomer
+	// MaxAmount caps what a single ChargeRecurring may take from the saved
+	// payment method
+	MaxAmount float64
+}
+
+// PaymentCustomer identifies the customer paying a recurring order. ID is the
+// provider's customer ID, when one was created before.
+type PaymentCustomer struct {
+	ID      string
+	Name    string
+	Email   string
+	Contact string
+}
+
+// PaymentOrder is an order created with a provider
+type PaymentOrder struct {
+	ID       string  `json:"id"`
+	Provider string  `json:"provider"`
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+	KeyID    string  `json:"keyId,omitempty"` // public key for the client checkout
+	// Recurring tells the client to open the checkout with recurring
+	// payments enabled, so the payment method is saved
+	Recurring bool `json:"recurring,omitempty"`
+	// CustomerID is the provider's customer a recurring checkout saves the
+	// payment method for
+	CustomerID string `json:"customerId,omitempty"`
+}
+
+// PaymentRefund is a refund issued by a provider
+type PaymentRefund struct {
+	ID     string  `json:"id"`
+	Amount float64 `json:"amount"`
+	Status string  `json:"status"`
+}
+
+// PaymentEvent is a webhook event normalised across providers
+type PaymentEvent struct {
+	Type      string
+	OrderID   string
+	PaymentID string
+	Amount    float64
+	Mandate   string // set when a recurring order saved the payment method
+}
+
+// key identifies an event for idempotency; each payment goes through each
+// event type at most once
+func (e *PaymentEvent) key() string {
+	return e.Type + ":" + e.PaymentID
+}
+
+var activeProvider PaymentProvider
+
+// SetupPaymentProvider selects the provider named by PAYMENT_PROVIDER. It
+// fails rather than fall back to anything: "razorpay" needs its keys and
+// webhook secret, and "mock", which lets renters mark orders paid, is only
+// allowed with ALLOW_MOCK_PAYMENTS=true and a MOCK_WEBHOOK_SECRET.
+func SetupPaymentProvider() error {
+	switch provider := os.Getenv("PAYMENT_PROVIDER"); provider {
+	case "razorpay":
+		keyID, keySecret, webhookSecret := os.Getenv("RAZORPAY_KEY_ID"), os.Getenv("RAZORPAY_KEY_SECRET"), os.Getenv("RAZORPAY_WEBHOOK_SECRET")
+		if keyID == "" || keySecret == "" || webhookSecret == "" {
+			return errors.New("razorpay needs RAZORPAY_KEY_ID, RAZORPAY_KEY_SECRET and RAZORPAY_WEBHOOK_SECRET")
+		}
+		activeProvider = newRazorpayProvider(keyID, keySecret, webhookSecret)
+	case "mock":
+		if os.Getenv("ALLOW_MOCK_PAYMENTS") != "true" {
+			return errors.New("the mock provider is for development only; set ALLOW_MOCK_PAYMENTS=true to use it")
+		}
+		secret := os.Getenv("MOCK_WEBHOOK_SECRET")
+		if secret == "" {
+			return errors.New("the mock provider needs MOCK_WEBHOOK_SECRET")
+		}
+		activeProvider = newMockProvider(secret)
+	case "":
+		return errors.New("PAYMENT_PROVIDER is not set")
+	default:
+		return fmt.Errorf("unknown PAYMENT_PROVIDER %q", provider)
+	}
+	log.Printf("Using %s payment provider", activeProvider.Name())
+	return nil
+}
+
+// paymentProvider returns the provider chosen by SetupPaymentProvider
+func paymentProvider() PaymentProvider {
+	return activeProvider
+}
+
+// toPaise converts rupees to the smallest currency unit
+func toPaise(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// amountDue is what the renter still owes for a booking: rental plus
+// deposit, less anything already paid (e.g. before an extension)
+func amountDue(booking *Booking) float64 {
+	amount := booking.TotalPrice
+	if booking.Deposit != nil {
+		amount += booking.Deposit.Amount
+	}
+	if booking.Payment != nil {
+		amount -= booking.Payment.AmountPaid
+	}
+	return roundMoney(amount)
+}
+
+// paid reports whether a payment for the booking was ever captured
+func (b *Booking) paid() bool {
+	return b.Payment != nil && b.Payment.PaidAt != nil
+}
+
+// payBooking creates a payment order for a booking
+func payBooking(w http.ResponseWriter, r *http.Request, id string) {
+	userID, _ := GetUserID(r)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	booking, role, ok := findBookingForUser(ctx, w, id, userID)
+	if !ok {
+		return
+	}
+	if role != RoleRenter {
+		JSONError(w, http.StatusForbidden, "Only the renter can pay for a booking")
+		return
+	}
+	if booking.PaymentStatus == PaymentPaid || amountDue(booking) <= 0 {
+		JSONError(w, http.StatusConflict, "Booking is already paid")
+		return
+	}
+	// Only what's owed after the order was paid, like a late fee, is paid per booking
+	if booking.OrderID != nil && !booking.paid() {
+		JSONError(w, http.StatusConflict, "Pay for this booking with its order")
+		return
+	}
+	// Returned bookings can still owe a late fee
+	if !isModifiable(booking.Status) && booking.Status != StatusReturned {
+		JSONError(w, http.StatusConflict, "Cannot pay for a "+booking.Status+" booking")
+		return
+	}
+
+	// A retried checkout gets a fresh order
+	req := OrderRequest{
+		Amount:   amountDue(booking),
+		Currency: "INR",
+		Receipt:  booking.TrackingID,
+		Notes:    map[string]string{"bookingId": booking.ID.Hex()},
+	}
+	// Paying for a subscription's contract booking saves the payment
+	// method its renewals are charged to
+	var renter User
+	if booking.SubscriptionID != nil && booking.Cycle == 1 {
+		var sub Subscription
+		if err := GetCollection("subscriptions").FindOne(ctx, bson.M{"_id": booking.SubscriptionID}).Decode(&sub); err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to fetch subscription")
+			return
+		}
+		if err := GetCollection("users").FindOne(ctx, bson.M{"_id": booking.RenterID}).Decode(&renter); err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to fetch renter")
+			return
+		}
+		req.Recurring = true
+		req.MaxAmount = renewalAmount(&sub)
+		req.Customer = &PaymentCustomer{ID: renter.CustomerID, Name: renter.Name, Email: renter.Email, Contact: renter.Phone}
+	}
+	order, err := paymentProvider().CreateOrder(ctx, req)
+	if err != nil {
+		log.Printf("Error creating payment order: %v", err)
+		JSONError(w, http.StatusBadGateway, "Failed to create payment order")
+		return
+	}
+	// Later subscriptions reuse the customer
+	if order.CustomerID != "" && order.CustomerID != renter.CustomerID {
+		GetCollection("users").UpdateOne(ctx, bson.M{"_id": booking.RenterID}, bson.M{"$set": bson.M{"customerId": order.CustomerID}})
+	}
+
+	// Earlier orders stay in orderIds so a late webhook for one still finds the booking
+	_, err = GetCollection("bookings").UpdateOne(ctx, bson.M{"_id": booking.ID}, bson.M{
+		"$set": bson.M{
+			"payment.provider": order.Provider,
+			"payment.orderId":  order.ID,
+			"payment.amount":   order.Amount,
+			"updatedAt":        time.Now(),
+		},
+		"$addToSet": bson.M{"payment.orderIds": order.ID},
+	})
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to save payment order")
+		return
+	}
+
+	JSON(w, http.StatusCreated, map[string]interface{}{"order": order})
+}
+
+// HandlePaymentWebhook receives payment events from the provider
+func HandlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	provider := paymentProvider()
+	if err := provider.VerifyWebhookSignature(payload, r.Header.Get(provider.SignatureHeader())); err != nil {
+		JSONError(w, http.StatusUnauthorized, "Invalid signature")
+		return
+	}
+
+	event, err := provider.ParseWebhookEvent(payload)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid event")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if err := handlePaymentEvent(ctx, event); err != nil {
+		log.Printf("Error handling payment event %s: %v", event.key(), err)
+		// A non-2xx response makes the provider retry the webhook
+		JSONError(w, http.StatusInternalServerError, "Failed to process event")
+		return
+	}
+
+	JSON(w, http.StatusOK, map[string]string{"message": "ok"})
+}
+
+// handlePaymentEvent applies a payment event to its booking, or to its order
+// when a cart checkout paid for several bookings at once
+func handlePaymentEvent(ctx context.Context, event *PaymentEvent) error {
+	// Events we don't act on are acknowledged without being recorded
+	switch event.Type {
+	case PaymentEventAuthorized, PaymentEventCaptured, PaymentEventFailed:
+	default:
+		return nil
+	}
+
+	var order Order
+	err := GetCollection("orders").FindOne(ctx, bson.M{"payment.orderIds": event.OrderID}).Decode(&order)
+	if err == nil {
+		return applyPaymentEvent(ctx, event, bson.M{"cartOrderId": order.ID}, func() error {
+			return handleOrderPaymentEvent(ctx, &order, event)
+		})
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	var booking Booking
+	if err := GetCollection("bookings").FindOne(ctx, bson.M{"payment.orderIds": event.OrderID}).Decode(&booking); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			log.Printf("Payment event %s for unknown order %s", event.key(), event.OrderID)
+			return nil
+		}
+		return err
+	}
+
+	return applyPaymentEvent(ctx, event, bson.M{"bookingId": booking.ID}, func() error {
+		switch event.Type {
+		case PaymentEventAuthorized:
+			// Captured payments arrive as their own event
+			return paymentProvider().Capture(ctx, event.PaymentID, event.Amount)
+		case PaymentEventCaptured:
+			return markBookingPaid(ctx, &booking, event)
+		case PaymentEventFailed:
+			_, err := GetCollection("bookings").UpdateOne(ctx,
+				bson.M{"_id": booking.ID, "paymentStatus": bson.M{"$ne": PaymentPaid}},
+				bson.M{"$set": bson.M{"paymentStatus": PaymentFailed, "updatedAt": time.Now()}},
+			)
+			return err
+		}
+		return nil
+	})
+}
+
+// applyPaymentEvent runs apply once per event. Events are recorded in
+// payment_events, along with ref, so a redelivered webhook is a no-op.
+func applyPaymentEvent(ctx context.Context, event *PaymentEvent, ref bson.M, apply func() error) error {
+	record := bson.M{
+		"_id":        event.key(),
+		"orderId":    event.OrderID,
+		"paymentId":  event.PaymentID,
+		"amount":     event.Amount,
+		"receivedAt": time.Now(),
+	}
+	for k, v := range ref {
+		record[k] = v
+	}
+	_, err := GetCollection("payment_events").InsertOne(ctx, record)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := apply(); err != nil {
+		// Forget the event so the provider's retry gets another go
+		GetCollection("payment_events").DeleteOne(ctx, bson.M{"_id": event.key()})
+		return err
+	}
+	return nil
+}
+
+// capturedPaymentFields returns the booking updates that record a captured
+// payment. Once it covers everything due, the booking is paid and the deposit
+// held; a payment for an older order, e.g. from before an extension, can fall
+// short and leaves it partially paid until the renter pays the rest.
+func capturedPaymentFields(booking *Booking, event *PaymentEvent, now time.Time) (bson.M, Capture) {
+	set := bson.M{
+		"payment.paymentId": event.PaymentID,
+		"updatedAt":         now,
+	}
+	// Extensions and late fees are paid for with payments of their own;
+	// each is kept so refunds can go back against the right one
+	capture := Capture{PaymentID: event.PaymentID, Amount: event.Amount, PaidAt: now}
+
+	if roundMoney(amountDue(booking)-event.Amount) > 0 {
+		set["paymentStatus"] = PaymentPartiallyPaid
+		return set, capture
+	}
+	set["paymentStatus"] = PaymentPaid
+	set["payment.paidAt"] = now
+	if booking.Deposit != nil && booking.Deposit.Status == DepositPending {
+		set["deposit.status"] = DepositHeld
+		set["deposit.heldAt"] = now
+		capture.Deposit = booking.Deposit.Amount
+	}
+	return set, capture
+}
+
+// markBookingPaid records a captured payment, see capturedPaymentFields
+func markBookingPaid(ctx context.Context, booking *Booking, event *PaymentEvent) error {
+	now := time.Now()
+	set, capture := capturedPaymentFields(booking, event, now)
+	inc := bson.M{"payment.amountPaid": event.Amount}
+
+	// A capture is only recorded once, even if the event is handled again
+	// after failing part way
+	result, err := GetCollection("bookings").UpdateOne(ctx,
+		bson.M{
+			"_id":                        booking.ID,
+			"paymentStatus":              bson.M{"$ne": PaymentPaid},
+			"payment.captures.paymentId": bson.M{"$ne": event.PaymentID},
+		},
+		bson.M{"$set": set, "$inc": inc, "$push": bson.M{"payment.captures": capture}},
+	)
+	if err != nil || result.MatchedCount == 0 {
+		return err
+	}
+	if set["paymentStatus"] == PaymentPartiallyPaid {
+		booking.PaymentStatus = PaymentPartiallyPaid
+		notifyBookingEvent(ctx, booking, booking.RenterID, "payment_partial")
+		return nil
+	}
+
+	booking.PaymentStatus = PaymentPaid
+	if booking.SubscriptionID != nil && event.Mandate != "" {
+		saveSubscriptionMandate(ctx, *booking.SubscriptionID, event.Mandate)
+	}
+	notifyBookingEvent(ctx, booking, booking.RenterID, "payment_received")
+	notifyBookingEvent(ctx, booking, booking.OwnerID, "payment_received")
+
+	if _, err := issueInvoice(ctx, booking); err != nil {
+		// Issued on first download instead
+		log.Printf("Error issuing invoice for booking %s: %v", booking.ID.Hex(), err)
+	} else {
+		notifyBookingEvent(ctx, booking, booking.RenterID, "invoice_ready")
+	}
+
+	if booking.AutoConfirm && booking.Status == StatusPending {
+		autoConfirmBooking(ctx, booking)
+	}
+	return nil
+}
+
+// refundOrder returns the indexes of captures in the order a refund goes
+// back against them: newest first, except that a deposit refund starts with
+// the payments that collected the deposit
+func refundOrder(captures []Capture, deposit bool) []int {
+	var first, rest []int
+	for i := len(captures) - 1; i >= 0; i-- {
+		if deposit && captures[i].Deposit > 0 {
+			first = append(first, i)
+		} else {
+			rest = append(rest, i)
+		}
+	}
+	return append(first, rest...)
+}
+
+// refundSplit divides amount between captures in refundOrder, never taking
+// more from one than is left of it. It fails if the captures don't cover
+// amount.
+func refundSplit(captures []Capture, amount float64, deposit bool) ([]RefundPart, error) {
+	var parts []RefundPart
+	remaining := roundMoney(amount)
+	for _, i := range refundOrder(captures, deposit) {
+		if remaining <= 0 {
+			break
+		}
+		c := captures[i]
+		part := math.Min(roundMoney(c.Amount-c.Refunded), remaining)
+		if part <= 0 {
+			continue
+		}
+		parts = append(parts, RefundPart{PaymentID: c.PaymentID, Amount: part})
+		remaining = roundMoney(remaining - part)
+	}
+	if remaining > 0 {
+		return nil, fmt.Errorf("%.2f more than was captured", remaining)
+	}
+	return parts, nil
+}
+
+// lastRefundID is the refund ID of the last of parts, or "" when nothing had
+// to be refunded
+func lastRefundID(parts []RefundPart) string {
+	if len(parts) == 0 {
+		return ""
+	}
+	return parts[len(parts)-1].RefundID
+}
+
+// refundCaptures sends amount back to the renter, split across the
+// booking's captured payments by refundSplit; deposit says whether amount is
+// a deposit being returned. The parts in sent went out in an earlier attempt
+// and count towards amount, so a refund that failed half way is resumed
+// rather than repeated. Each part is recorded under partsPath as soon as it
+// goes through, with arrayFilter picking the element partsPath refers to, if
+// any. Returns every part once amount is refunded in full.
+func refundCaptures(ctx context.Context, booking *Booking, amount float64, deposit bool, sent []RefundPart, partsPath string, arrayFilter bson.M) ([]RefundPart, error) {
+	remaining := amount
+	for _, part := range sent {
+		remaining -= part.Amount
+	}
+	remaining = roundMoney(remaining)
+	if remaining <= 0 {
+		return sent, nil
+	}
+	if booking.Payment == nil {
+		return sent, errors.New("booking has no captured payment")
+	}
+
+	split, err := refundSplit(booking.Payment.Captures, remaining, deposit)
+	if err != nil {
+		return sent, err
+	}
+	for _, part := range split {
+		result, err := paymentProvider().Refund(ctx, part.PaymentID, part.Amount)
+		if err != nil {
+			return sent, err
+		}
+		part.RefundID = result.ID
+
+		filters := []interface{}{bson.M{"c.paymentId": part.PaymentID}}
+		if arrayFilter != nil {
+			filters = append(filters, arrayFilter)
+		}
+		_, err = GetCollection("bookings").UpdateOne(ctx,
+			bson.M{"_id": booking.ID},
+			bson.M{
+				"$inc":  bson.M{"payment.captures.$[c].refunded": part.Amount},
+				"$push": bson.M{partsPath: part},
+			},
+			options.Update().SetArrayFilters(options.ArrayFilters{Filters: filters}),
+		)
+		if err != nil {
+			log.Printf("Error recording refund %s of booking %s: %v", result.ID, booking.ID.Hex(), err)
+			return sent, err
+		}
+
+		for i := range booking.Payment.Captures {
+			if c := &booking.Payment.Captures[i]; c.PaymentID == part.PaymentID {
+				c.Refunded = roundMoney(c.Refunded + part.Amount)
+			}
+		}
+		sent = append(sent, part)
+	}
+	return sent, nil
+}
@@ -0,0 +1,174 @@
+package backend
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// mockProvider is an in-memory provider for development and testing. Orders
+// are completed through POST /api/payments/mock/complete instead of a real
+// checkout, and webhooks use the same format and signing as Razorpay.
+type mockProvider struct {
+	mu            sync.Mutex
+	orders        map[string]float64 // order ID -> amount
+	recurring     map[string]bool    // orders that save the payment method
+	webhookSecret string
+}
+
+func newMockProvider(secret string) *mockProvider {
+	return &mockProvider{orders: make(map[string]float64), recurring: make(map[string]bool), webhookSecret: secret}
+}
+
+func (p *mockProvider) Name() string {
+	return "mock"
+}
+
+func mockID(prefix string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+func (p *mockProvider) CreateOrder(ctx context.Context, req OrderRequest) (*PaymentOrder, error) {
+	id := mockID("order_mock_")
+	p.mu.Lock()
+	p.orders[id] = req.Amount
+	p.recurring[id] = req.Recurring
+	p.mu.Unlock()
+
+	order := &PaymentOrder{ID: id, Provider: p.Name(), Amount: req.Amount, Currency: req.Currency, Recurring: req.Recurring}
+	if req.Recurring && req.Customer != nil {
+		order.CustomerID = req.Customer.ID
+		if order.CustomerID == "" {
+			order.CustomerID = mockID("cust_mock_")
+		}
+	}
+	return order, nil
+}
+
+func (p *mockProvider) Capture(ctx context.Context, paymentID string, amount float64) error {
+	return nil
+}
+
+func (p *mockProvider) Refund(ctx context.Context, paymentID string, amount float64) (*PaymentRefund, error) {
+	return &PaymentRefund{ID: mockID("rfnd_mock_"), Amount: roundMoney(amount), Status: "processed"}, nil
+}
+
+// ChargeRecurring always succeeds. The captured payment is delivered a moment
+// later, as a real webhook would be, so the caller can record the order first.
+func (p *mockProvider) ChargeRecurring(ctx context.Context, mandate string, req OrderRequest) (*PaymentOrder, error) {
+	if mandate == "" {
+		return nil, errors.New("no mandate")
+	}
+	order, err := p.CreateOrder(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	time.AfterFunc(2*time.Second, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		handlePaymentEvent(ctx, &PaymentEvent{
+			Type:      PaymentEventCaptured,
+			OrderID:   order.ID,
+			PaymentID: mockID("pay_mock_"),
+			Amount:    order.Amount,
+		})
+	})
+	return order, nil
+}
+
+func (p *mockProvider) SignatureHeader() string {
+	return "X-Razorpay-Signature"
+}
+
+func (p *mockProvider) VerifyWebhookSignature(payload []byte, signature string) error {
+	return verifyHMACSignature(p.webhookSecret, payload, signature)
+}
+
+func (p *mockProvider) ParseWebhookEvent(payload []byte) (*PaymentEvent, error) {
+	return parseRazorpayEvent(payload)
+}
+
+// orderAmount returns the amount of an order created by this process
+func (p *mockProvider) orderAmount(orderID string) (float64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	amount, ok := p.orders[orderID]
+	if !ok {
+		return 0, errors.New("unknown order")
+	}
+	return amount, nil
+}
+
+// isRecurring reports whether an order was created to save the payment method
+func (p *mockProvider) isRecurring(orderID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.recurring[orderID]
+}
+
+// HandleMockPaymentComplete simulates the renter completing checkout for a
+// mock order. Only routed when the mock provider is active.
+func HandleMockPaymentComplete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+
+	var req struct {
+		OrderID string `json:"orderId"`
+	}
+	if err := DecodeJSON(r, &req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	provider, ok := paymentProvider().(*mockProvider)
+	if !ok {
+		JSONError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	amount, err := provider.orderAmount(req.OrderID)
+	if err != nil {
+		JSONError(w, http.StatusNotFound, "Order not found")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"payment.orderIds": req.OrderID, "renterId": userID}
+	count, err := GetCollection("bookings").CountDocuments(ctx, filter)
+	if err == nil && count == 0 {
+		count, err = GetCollection("orders").CountDocuments(ctx, filter)
+	}
+	if err != nil || count == 0 {
+		JSONError(w, http.StatusNotFound, "Order not found")
+		return
+	}
+
+	event := &PaymentEvent{
+		Type:      PaymentEventCaptured,
+		OrderID:   req.OrderID,
+		PaymentID: mockID("pay_mock_"),
+		Amount:    amount,
+	}
+	if provider.isRecurring(req.OrderID) {
+		event.Mandate = mockID("mandate_mock_")
+	}
+	if err := handlePaymentEvent(ctx, event); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to complete payment")
+		return
+	}
+
+	JSON(w, http.StatusOK, map[string]interface{}{"message": "Payment completed", "paymentId": event.PaymentID})
+}
@@ -0,0 +1,275 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const razorpayBaseURL = "https://api.razorpay.com/v1"
+
+// razorpayTokenValidity is how long a card saved by a recurring order can be
+// charged; subscriptions run until notice is given, so it is Razorpay's
+// longest
+const razorpayTokenValidity = 10 * 365 * 24 * time.Hour
+
+// razorpayProvider talks to the Razorpay Orders and Payments APIs
+type razorpayProvider struct {
+	keyID         string
+	keySecret     string
+	webhookSecret string
+	client        *http.Client
+}
+
+func newRazorpayProvider(keyID, keySecret, webhookSecret string) *razorpayProvider {
+	return &razorpayProvider{
+		keyID:         keyID,
+		keySecret:     keySecret,
+		webhookSecret: webhookSecret,
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *razorpayProvider) Name() string {
+	return "razorpay"
+}
+
+// call sends an authenticated JSON request to the Razorpay API and decodes the response into out
+func (p *razorpayProvider) call(ctx context.Context, method, path string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, razorpayBaseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(p.keyID, p.keySecret)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Description string `json:"description"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("razorpay %s %s: %d %s", method, path, resp.StatusCode, apiErr.Error.Description)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (p *razorpayProvider) CreateOrder(ctx context.Context, req OrderRequest) (*PaymentOrder, error) {
+	var resp struct {
+		ID       string `json:"id"`
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+	}
+	body := map[string]interface{}{
+		"amount":   toPaise(req.Amount),
+		"currency": req.Currency,
+		"receipt":  req.Receipt,
+		"notes":    req.Notes,
+	}
+
+	// The card is saved as a token of the customer, which later charges
+	// go through, within max_amount each
+	customerID := ""
+	if req.Recurring {
+		var err error
+		if customerID, err = p.customer(ctx, req.Customer); err != nil {
+			return nil, err
+		}
+		body["customer_id"] = customerID
+		body["method"] = "card"
+		body["token"] = map[string]interface{}{
+			"max_amount": toPaise(req.MaxAmount),
+			"expire_at":  time.Now().Add(razorpayTokenValidity).Unix(),
+			"frequency":  "monthly",
+		}
+	}
+
+	if err := p.call(ctx, http.MethodPost, "/orders", body, &resp); err != nil {
+		return nil, err
+	}
+
+	return &PaymentOrder{
+		ID:         resp.ID,
+		Provider:   p.Name(),
+		Amount:     float64(resp.Amount) / 100,
+		Currency:   resp.Currency,
+		KeyID:      p.keyID,
+		Recurring:  req.Recurring,
+		CustomerID: customerID,
+	}, nil
+}
+
+// customer returns the Razorpay customer ID of c, creating the customer if
+// it has none yet. With fail_existing off, Razorpay returns the customer
+// already registered with the same details instead of failing.
+func (p *razorpayProvider) customer(ctx context.Context, c *PaymentCustomer) (string, error) {
+	if c == nil {
+		return "", fmt.Errorf("recurring order without a customer")
+	}
+	if c.ID != "" {
+		return c.ID, nil
+	}
+
+	var resp struct {
+		ID string `json:"id"`
+	}
+	err := p.call(ctx, http.MethodPost, "/customers", map[string]interface{}{
+		"name":          c.Name,
+		"email":         c.Email,
+		"contact":       c.Contact,
+		"fail_existing": "0",
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (p *razorpayProvider) Capture(ctx context.Context, paymentID string, amount float64) error {
+	return p.call(ctx, http.MethodPost, "/payments/"+paymentID+"/capture", map[string]interface{}{
+		"amount":   toPaise(amount),
+		"currency": "INR",
+	}, nil)
+}
+
+func (p *razorpayProvider) Refund(ctx context.Context, paymentID string, amount float64) (*PaymentRefund, error) {
+	var resp struct {
+		ID     string `json:"id"`
+		Amount int64  `json:"amount"`
+		Status string `json:"status"`
+	}
+	err := p.call(ctx, http.MethodPost, "/payments/"+paymentID+"/refund", map[string]interface{}{
+		"amount": toPaise(amount),
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentRefund{ID: resp.ID, Amount: float64(resp.Amount) / 100, Status: resp.Status}, nil
+}
+
+// razorpayMandate is what a saved token is charged with. Razorpay wants the
+// customer's contact details on every recurring payment, so they are kept
+// with the token.
+type razorpayMandate struct {
+	CustomerID string `json:"customerId"`
+	TokenID    string `json:"tokenId"`
+	Email      string `json:"email"`
+	Contact    string `json:"contact"`
+}
+
+func (p *razorpayProvider) ChargeRecurring(ctx context.Context, mandate string, req OrderRequest) (*PaymentOrder, error) {
+	var m razorpayMandate
+	if err := json.Unmarshal([]byte(mandate), &m); err != nil || m.TokenID == "" {
+		return nil, fmt.Errorf("invalid razorpay mandate")
+	}
+
+	order, err := p.CreateOrder(ctx, OrderRequest{Amount: req.Amount, Currency: req.Currency, Receipt: req.Receipt, Notes: req.Notes})
+	if err != nil {
+		return nil, err
+	}
+	err = p.call(ctx, http.MethodPost, "/payments/create/recurring", map[string]interface{}{
+		"email":       m.Email,
+		"contact":     m.Contact,
+		"amount":      toPaise(req.Amount),
+		"currency":    req.Currency,
+		"order_id":    order.ID,
+		"customer_id": m.CustomerID,
+		"token":       m.TokenID,
+		"recurring":   "1",
+		"notes":       req.Notes,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (p *razorpayProvider) SignatureHeader() string {
+	return "X-Razorpay-Signature"
+}
+
+func (p *razorpayProvider) VerifyWebhookSignature(payload []byte, signature string) error {
+	return verifyHMACSignature(p.webhookSecret, payload, signature)
+}
+
+func (p *razorpayProvider) ParseWebhookEvent(payload []byte) (*PaymentEvent, error) {
+	return parseRazorpayEvent(payload)
+}
+
+// verifyHMACSignature checks a hex HMAC-SHA256 signature of payload
+func verifyHMACSignature(secret string, payload []byte, signature string) error {
+	if secret == "" || signature == "" {
+		return errInvalidSignature
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// razorpayWebhook is the subset of Razorpay's webhook body we use
+type razorpayWebhook struct {
+	Event   string `json:"event"`
+	Payload struct {
+		Payment struct {
+			Entity struct {
+				ID         string `json:"id"`
+				OrderID    string `json:"order_id"`
+				Amount     int64  `json:"amount"`
+				CustomerID string `json:"customer_id"`
+				TokenID    string `json:"token_id"`
+				Email      string `json:"email"`
+				Contact    string `json:"contact"`
+			} `json:"entity"`
+		} `json:"payment"`
+	} `json:"payload"`
+}
+
+func parseRazorpayEvent(payload []byte) (*PaymentEvent, error) {
+	var body razorpayWebhook
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return nil, err
+	}
+	entity := body.Payload.Payment.Entity
+	event := &PaymentEvent{
+		Type:      body.Event,
+		OrderID:   entity.OrderID,
+		PaymentID: entity.ID,
+		Amount:    float64(entity.Amount) / 100,
+	}
+	if entity.TokenID != "" {
+		mandate, _ := json.Marshal(razorpayMandate{
+			CustomerID: entity.CustomerID,
+			TokenID:    entity.TokenID,
+			Email:      entity.Email,
+			Contact:    entity.Contact,
+		})
+		event.Mandate = string(mandate)
+	}
+	return event, nil
+}
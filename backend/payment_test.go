@@ -0,0 +1,167 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRefundSplit(t *testing.T) {
+	booking := Capture{PaymentID: "pay_booking", Amount: 1500, Deposit: 500}
+	extension := Capture{PaymentID: "pay_extension", Amount: 300}
+	lateFee := Capture{PaymentID: "pay_late", Amount: 200}
+	part := func(paymentID string, amount float64) RefundPart {
+		return RefundPart{PaymentID: paymentID, Amount: amount}
+	}
+
+	tests := []struct {
+		name     string
+		captures []Capture
+		amount   float64
+		deposit  bool
+		want     []RefundPart
+		wantErr  bool
+	}{
+		{
+			name:     "one payment",
+			captures: []Capture{booking},
+			amount:   700,
+			want:     []RefundPart{part("pay_booking", 700)},
+		},
+		{
+			name:     "newest first",
+			captures: []Capture{booking, extension},
+			amount:   200,
+			want:     []RefundPart{part("pay_extension", 200)},
+		},
+		{
+			name:     "split when the newest doesn't cover it",
+			captures: []Capture{booking, extension},
+			amount:   1000,
+			want:     []RefundPart{part("pay_extension", 300), part("pay_booking", 700)},
+		},
+		{
+			name:     "what was refunded before is left out",
+			captures: []Capture{booking, {PaymentID: "pay_extension", Amount: 300, Refunded: 250}},
+			amount:   100,
+			want:     []RefundPart{part("pay_extension", 50), part("pay_booking", 50)},
+		},
+		{
+			name:     "fully refunded payments are skipped",
+			captures: []Capture{booking, {PaymentID: "pay_extension", Amount: 300, Refunded: 300}},
+			amount:   100,
+			want:     []RefundPart{part("pay_booking", 100)},
+		},
+		{
+			name:     "deposits go back against the payment that collected them",
+			captures: []Capture{booking, extension, lateFee},
+			amount:   500,
+			deposit:  true,
+			want:     []RefundPart{part("pay_booking", 500)},
+		},
+		{
+			name:     "deposits overflow newest first",
+			captures: []Capture{{PaymentID: "pay_booking", Amount: 400, Deposit: 500}, extension, lateFee},
+			amount:   500,
+			deposit:  true,
+			want:     []RefundPart{part("pay_booking", 400), part("pay_late", 100)},
+		},
+		{
+			name:     "everything",
+			captures: []Capture{booking, extension, lateFee},
+			amount:   2000,
+			want:     []RefundPart{part("pay_late", 200), part("pay_extension", 300), part("pay_booking", 1500)},
+		},
+		{
+			name:     "rounded to the paisa",
+			captures: []Capture{{PaymentID: "pay_booking", Amount: 100.1}, {PaymentID: "pay_extension", Amount: 0.2}},
+			amount:   100.3,
+			want:     []RefundPart{part("pay_extension", 0.2), part("pay_booking", 100.1)},
+		},
+		{name: "nothing to refund", captures: []Capture{booking}, amount: 0},
+		{name: "more than was captured", captures: []Capture{booking, extension}, amount: 1801, wantErr: true},
+		{name: "no captures", amount: 100, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := refundSplit(tt.captures, tt.amount, tt.deposit)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("refundSplit() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("refundSplit() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("refundSplit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAmountDue(t *testing.T) {
+	tests := []struct {
+		name    string
+		booking Booking
+		want    float64
+	}{
+		{"unpaid", Booking{TotalPrice: 1180}, 1180},
+		{"with a deposit", Booking{TotalPrice: 1180, Deposit: &Deposit{Amount: 500}}, 1680},
+		{"paid", Booking{TotalPrice: 1180, Deposit: &Deposit{Amount: 500}, Payment: &PaymentInfo{AmountPaid: 1680}}, 0},
+		{"extended after paying", Booking{TotalPrice: 1770, Deposit: &Deposit{Amount: 500}, Payment: &PaymentInfo{AmountPaid: 1680}}, 590},
+		{"shortened after paying", Booking{TotalPrice: 590, Payment: &PaymentInfo{AmountPaid: 1180}}, -590},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := amountDue(&tt.booking); got != tt.want {
+				t.Errorf("amountDue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapturedPaymentFields(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	booking := func(total, paid float64, deposit *Deposit) *Booking {
+		return &Booking{TotalPrice: total, Deposit: deposit, Payment: &PaymentInfo{AmountPaid: paid}}
+	}
+
+	tests := []struct {
+		name        string
+		booking     *Booking
+		amount      float64
+		wantStatus  string
+		wantHeld    bool
+		wantDeposit float64
+	}{
+		{"pays in full", booking(1180, 0, nil), 1180, PaymentPaid, false, 0},
+		{"pays in full with the deposit", booking(1180, 0, &Deposit{Amount: 500, Status: DepositPending}), 1680, PaymentPaid, true, 500},
+		{"older order from before an extension", booking(1770, 0, &Deposit{Amount: 500, Status: DepositPending}), 1680, PaymentPartiallyPaid, false, 0},
+		{"pays the rest", booking(1770, 1680, &Deposit{Amount: 500, Status: DepositPending}), 590, PaymentPaid, true, 500},
+		{"pays an extension", booking(1770, 1680, &Deposit{Amount: 500, Status: DepositHeld}), 590, PaymentPaid, false, 0},
+		{"pays a late fee", booking(1300, 1180, nil), 120, PaymentPaid, false, 0},
+		{"overpays", booking(1180, 0, nil), 1200, PaymentPaid, false, 0},
+		{"a paisa short", booking(1180, 0, nil), 1179.99, PaymentPartiallyPaid, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &PaymentEvent{Type: PaymentEventCaptured, PaymentID: "pay_1", Amount: tt.amount}
+			set, capture := capturedPaymentFields(tt.booking, event, now)
+			if set["paymentStatus"] != tt.wantStatus {
+				t.Errorf("paymentStatus = %v, want %v", set["paymentStatus"], tt.wantStatus)
+			}
+			if _, paid := set["payment.paidAt"]; paid != (tt.wantStatus == PaymentPaid) {
+				t.Errorf("paidAt set = %v, want %v", paid, !paid)
+			}
+			if held := set["deposit.status"] == DepositHeld; held != tt.wantHeld {
+				t.Errorf("deposit held = %v, want %v", held, tt.wantHeld)
+			}
+			want := Capture{PaymentID: "pay_1", Amount: tt.amount, Deposit: tt.wantDeposit, PaidAt: now}
+			if capture != want {
+				t.Errorf("capture = %+v, want %+v", capture, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// pdfWriter lays out plain text on A4 pages and writes it as a PDF using the
+// standard Helvetica fonts, which every viewer has built in. It is just
+// enough for the documents we generate: headings, paragraphs and rows of
+// label/value pairs.
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+const (
+	pdfPageWidth  = 595.0
+	pdfPageHeight = 842.0
+	pdfMargin     = 50.0
+)
+
+func newPDF() *pdfWriter {
+	p := &pdfWriter{}
+	p.newPage()
+	return p
+}
+
+func (p *pdfWriter) newPage() {
+	p.pages = append(p.pages, &bytes.Buffer{})
+	p.y = pdfPageHeight - pdfMargin
+}
+
+// line moves down by height, starting a new page when the bottom margin is reached
+func (p *pdfWriter) line(height float64) {
+	if p.y-height < pdfMargin {
+		p.newPage()
+	}
+	p.y -= height
+}
+
+// space adds vertical space
+func (p *pdfWriter) space(height float64) {
+	p.line(height)
+}
+
+// text writes s at size, wrapping it to the page width
+func (p *pdfWriter) text(s string, size float64, bold bool) {
+	p.textAt(pdfMargin, s, size, bold)
+}
+
+// textAt writes s starting at x, wrapping it to the right margin
+func (p *pdfWriter) textAt(x float64, s string, size float64, bold bool) {
+	// Helvetica averages about half the font size per character
+	width := int((pdfPageWidth - pdfMargin - x) / (size * 0.5))
+	for _, l := range wrapText(pdfString(s), width) {
+		p.line(size * 1.4)
+		p.write(x, l, size, bold)
+	}
+}
+
+// row writes a label on the left and a value aligned to the right margin
+func (p *pdfWriter) row(label, value string, size float64, bold bool) {
+	p.line(size * 1.4)
+	p.write(pdfMargin, pdfString(label), size, bold)
+	value = pdfString(value)
+	p.write(pdfPageWidth-pdfMargin-float64(len(value))*size*0.55, value, size, bold)
+}
+
+// rule draws a horizontal line across the page
+func (p *pdfWriter) rule() {
+	p.line(6)
+	fmt.Fprintf(p.pages[len(p.pages)-1], "%.1f %.1f m %.1f %.1f l 0.5 w S\n", pdfMargin, p.y, pdfPageWidth-pdfMargin, p.y)
+}
+
+func (p *pdfWriter) write(x float64, s string, size float64, bold bool) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(p.pages[len(p.pages)-1], "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", font, size, x, p.y, escapePDF(s))
+}
+
+// Bytes returns the finished PDF
+func (p *pdfWriter) Bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	// Objects 1-4 are the catalog, page tree and fonts; each page is then a
+	// page object followed by its content stream
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, content := range p.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// pdfString replaces characters the standard fonts can't show
+func pdfString(s string) string {
+	s = strings.ReplaceAll(s, "₹", "Rs. ")
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\n' || r == '\t':
+			b.WriteByte(' ')
+		case r < 32:
+		case r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func escapePDF(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s)
+}
+
+// wrapText splits s into lines of at most width characters, breaking at spaces
+func wrapText(s string, width int) []string {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return []string{""}
+	}
+	var lines []string
+	current := words[0]
+	for _, w := range words[1:] {
+		if len(current)+1+len(w) > width {
+			lines = append(lines, current)
+			current = w
+			continue
+		}
+		current += " " + w
+	}
+	return append(lines, current)
+}
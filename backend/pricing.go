@@ -0,0 +1,367 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	daysPerWeek  = 7
+	daysPerMonth = 30
+)
+
+// Units an item can be priced in
+const (
+	PriceUnitHour  = "hour"
+	PriceUnitDay   = "day"
+	PriceUnitWeek  = "week"
+	PriceUnitMonth = "month"
+)
+
+// unitDuration is the length of one pricing unit
+func unitDuration(unit string) time.Duration {
+	switch unit {
+	case PriceUnitHour:
+		return time.Hour
+	case PriceUnitWeek:
+		return daysPerWeek * 24 * time.Hour
+	case PriceUnitMonth:
+		return daysPerMonth * 24 * time.Hour
+	default:
+		return 24 * time.Hour
+	}
+}
+
+func isPriceUnit(unit string) bool {
+	switch unit {
+	case PriceUnitHour, PriceUnitDay, PriceUnitWeek, PriceUnitMonth:
+		return true
+	}
+	return false
+}
+
+// priceUnit is the unit item.Price is charged per; items listed before units
+// existed are priced per day
+func priceUnit(item *Item) string {
+	if isPriceUnit(item.PriceUnit) {
+		return item.PriceUnit
+	}
+	return PriceUnitDay
+}
+
+// rentalUnits counts the started units in [start, end), so 25 hours is
+// billed as 2 days
+func rentalUnits(unit string, start, end time.Time) int {
+	units := int(math.Ceil(float64(end.Sub(start)) / float64(unitDuration(unit))))
+	if units < 1 {
+		units = 1
+	}
+	return units
+}
+
+// unitLabel is "3 days", "1 hour" and so on
+func unitLabel(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// onTheHour reports whether t is on the hour in rentalLocation. Truncating
+// would round against UTC, which is off by half an hour in India.
+func onTheHour(t time.Time) bool {
+	t = t.In(rentalLocation())
+	return t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0
+}
+
+// validateRentalPeriod checks a rental of item for [start, end) against its
+// duration limits. Hourly rentals must start and end on the hour.
+func validateRentalPeriod(item *Item, start, end time.Time) error {
+	unit := priceUnit(item)
+	if unit == PriceUnitHour && (!onTheHour(start) || !onTheHour(end)) {
+		return errors.New("Hourly rentals must start and end on the hour")
+	}
+
+	units := rentalUnits(unit, start, end)
+	min, max := item.MinDuration, item.MaxDuration
+	if min > 0 && units < min {
+		return fmt.Errorf("Minimum rental period for this item is %s", unitLabel(min, unit))
+	}
+	if max > 0 && units > max {
+		return fmt.Errorf("Maximum rental period for this item is %s", unitLabel(max, unit))
+	}
+	return nil
+}
+
+// validatePricing checks the pricing fields of an item being listed
+func validatePricing(item *Item) error {
+	if item.PriceUnit != "" && !isPriceUnit(item.PriceUnit) {
+		return errors.New("Price unit must be 'hour', 'day', 'week' or 'month'")
+	}
+	if item.MinDuration < 0 || item.MaxDuration < 0 {
+		return errors.New("Rental durations can't be negative")
+	}
+	if item.MaxDuration > 0 && item.MinDuration > item.MaxDuration {
+		return errors.New("Minimum rental duration can't exceed the maximum")
+	}
+	return nil
+}
+
+// PriceQuote is the itemized price of renting an item for a period
+type PriceQuote struct {
+	ItemID    primitive.ObjectID `json:"itemId"`
+	StartDate time.Time          `json:"startDate"`
+	EndDate   time.Time          `json:"endDate"`
+	Days      int                `json:"days"`
+	Unit      string             `json:"unit"`     // the item's price unit
+	Units     int                `json:"units"`    // started units billed
+	Quantity  int                `json:"quantity"` // units of the item rented
+	LineItems []PriceLineItem    `json:"lineItems"`
+	Total     float64            `json:"total"`
+	Deposit   float64            `json:"deposit,omitempty"` // refundable, not part of total
+	Currency  string             `json:"currency"`
+}
+
+// pricingConfig holds the platform-wide pricing rules
+type pricingConfig struct {
+	PlatformFeePercent float64
+	TaxPercent         float64
+}
+
+func loadPricingConfig() pricingConfig {
+	return pricingConfig{
+		PlatformFeePercent: envFloat("PLATFORM_FEE_PERCENT", 5),
+		TaxPercent:         envFloat("GST_PERCENT", 18),
+	}
+}
+
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// rentalDays counts started days, so 25 hours is billed as 2 days
+func rentalDays(start, end time.Time) int {
+	days := int(math.Ceil(end.Sub(start).Hours() / 24))
+	if days < 1 {
+		days = 1
+	}
+	return days
+}
+
+// calculateQuote prices a rental of item between start and end. Every started
+// unit is charged at the item's price. For daily items, monthly and weekly
+// rates are applied first when the owner has set them and the remaining days
+// are charged at the daily price. Renting several units of an item multiplies
+// the rental and the deposit. Platform fee and tax are added on top.
+func calculateQuote(item *Item, start, end time.Time, quantity int) (*PriceQuote, error) {
+	if item.Price <= 0 {
+		return nil, errors.New("Item has no price set")
+	}
+	if err := validateRentalPeriod(item, start, end); err != nil {
+		return nil, err
+	}
+	quantity, err := rentalQuantity(item, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	unit := priceUnit(item)
+	units := rentalUnits(unit, start, end)
+	days := rentalDays(start, end)
+	var lines []PriceLineItem
+
+	if unit != PriceUnitDay {
+		rate := map[string]string{PriceUnitHour: "hourly", PriceUnitWeek: "weekly", PriceUnitMonth: "monthly"}[unit]
+		lines = append(lines, PriceLineItem{
+			Code: "rental_" + rate, Label: strings.ToUpper(rate[:1]) + rate[1:] + " rate",
+			Quantity: float64(units), UnitPrice: item.Price,
+			Amount: roundMoney(float64(units) * item.Price),
+		})
+	}
+
+	remaining := 0
+	if unit == PriceUnitDay {
+		remaining = days
+	}
+
+	if item.MonthlyPrice > 0 && remaining >= daysPerMonth {
+		months := remaining / daysPerMonth
+		lines = append(lines, PriceLineItem{
+			Code: "rental_monthly", Label: "Monthly rate",
+			Quantity: float64(months), UnitPrice: item.MonthlyPrice,
+			Amount: roundMoney(float64(months) * item.MonthlyPrice),
+		})
+		remaining -= months * daysPerMonth
+	}
+	if item.WeeklyPrice > 0 && remaining >= daysPerWeek {
+		weeks := remaining / daysPerWeek
+		lines = append(lines, PriceLineItem{
+			Code: "rental_weekly", Label: "Weekly rate",
+			Quantity: float64(weeks), UnitPrice: item.WeeklyPrice,
+			Amount: roundMoney(float64(weeks) * item.WeeklyPrice),
+		})
+		remaining -= weeks * daysPerWeek
+	}
+	if remaining > 0 {
+		lines = append(lines, PriceLineItem{
+			Code: "rental_daily", Label: "Daily rate",
+			Quantity: float64(remaining), UnitPrice: item.Price,
+			Amount: roundMoney(float64(remaining) * item.Price),
+		})
+	}
+
+	rental := 0.0
+	for i := range lines {
+		if quantity > 1 {
+			lines[i].Label = fmt.Sprintf("%s, %d units", lines[i].Label, quantity)
+			lines[i].Quantity *= float64(quantity)
+			lines[i].Amount = roundMoney(lines[i].Quantity * lines[i].UnitPrice)
+		}
+		rental += lines[i].Amount
+	}
+
+	lines, total := addFeesAndTax(lines, rental)
+
+	return &PriceQuote{
+		ItemID:    item.ID,
+		StartDate: start,
+		EndDate:   end,
+		Days:      days,
+		Unit:      unit,
+		Units:     units,
+		Quantity:  quantity,
+		LineItems: lines,
+		Total:     total,
+		Deposit:   roundMoney(item.DepositAmount * float64(quantity)),
+		Currency:  "INR",
+	}, nil
+}
+
+// addFeesAndTax adds the platform fee and tax on a rental amount to its
+// lines, and returns them with the total
+func addFeesAndTax(lines []PriceLineItem, rental float64) ([]PriceLineItem, float64) {
+	cfg := loadPricingConfig()
+
+	fee := roundMoney(rental * cfg.PlatformFeePercent / 100)
+	if fee > 0 {
+		lines = append(lines, PriceLineItem{
+			Code: "platform_fee", Label: "Platform fee",
+			Quantity: 1, UnitPrice: fee, Amount: fee,
+		})
+	}
+
+	tax := roundMoney((rental + fee) * cfg.TaxPercent / 100)
+	if tax > 0 {
+		lines = append(lines, PriceLineItem{
+			Code: "tax", Label: fmt.Sprintf("GST (%g%%)", cfg.TaxPercent),
+			Quantity: 1, UnitPrice: tax, Amount: tax,
+		})
+	}
+	return lines, roundMoney(rental + fee + tax)
+}
+
+// rentalAmount sums the rental lines of a quote, leaving out fees and tax
+func rentalAmount(quote *PriceQuote) float64 {
+	rental := 0.0
+	for _, l := range quote.LineItems {
+		if strings.HasPrefix(l.Code, "rental_") {
+			rental += l.Amount
+		}
+	}
+	return roundMoney(rental)
+}
+
+// negotiatedQuote prices a rental at a rental amount agreed in chat instead
+// of the item's rates. The period and quantity must still suit the item, and
+// platform fee and tax are added as usual.
+func negotiatedQuote(item *Item, start, end time.Time, quantity int, rental float64) (*PriceQuote, error) {
+	quote, err := calculateQuote(item, start, end, quantity)
+	if err != nil {
+		return nil, err
+	}
+	rental = roundMoney(rental)
+	if rental <= 0 {
+		return nil, errors.New("Offer a price above zero")
+	}
+
+	label := "Negotiated rental, " + unitLabel(quote.Units, quote.Unit)
+	if quote.Quantity > 1 {
+		label += fmt.Sprintf(", %d units", quote.Quantity)
+	}
+	quote.LineItems, quote.Total = addFeesAndTax([]PriceLineItem{{
+		Code: "rental_negotiated", Label: label,
+		Quantity: 1, UnitPrice: rental, Amount: rental,
+	}}, rental)
+	return quote, nil
+}
+
+// parseBookingDates parses and validates the RFC3339 dates of a booking request
+func parseBookingDates(startStr, endStr string) (time.Time, time.Time, error) {
+	startDate, err := time.Parse(time.RFC3339, startStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("Invalid start date format")
+	}
+	endDate, err := time.Parse(time.RFC3339, endStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("Invalid end date format")
+	}
+	if !endDate.After(startDate) {
+		return time.Time{}, time.Time{}, errors.New("End date must be after start date")
+	}
+	return startDate, endDate, nil
+}
+
+// HandleBookingQuote returns the server-computed price of a prospective booking
+func HandleBookingQuote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		ItemID    string `json:"itemId"`
+		StartDate string `json:"startDate"`
+		EndDate   string `json:"endDate"`
+		Quantity  int    `json:"quantity"`
+	}
+	if err := DecodeJSON(r, &req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	itemID, err := primitive.ObjectIDFromHex(req.ItemID)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid item ID")
+		return
+	}
+	startDate, endDate, err := parseBookingDates(req.StartDate, req.EndDate)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var item Item
+	if err := GetCollection("items").FindOne(ctx, bson.M{"_id": itemID}).Decode(&item); err != nil {
+		JSONError(w, http.StatusNotFound, "Item not found")
+		return
+	}
+
+	quote, err := calculateQuote(&item, startDate, endDate, req.Quantity)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	JSON(w, http.StatusOK, map[string]interface{}{"quote": quote})
+}
@@ -0,0 +1,222 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCalculateQuote(t *testing.T) {
+	t.Setenv("PLATFORM_FEE_PERCENT", "5")
+	t.Setenv("GST_PERCENT", "18")
+	t.Setenv("TIME_ZONE", "Asia/Kolkata")
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.FixedZone("IST", 5*60*60+30*60))
+
+	tests := []struct {
+		name        string
+		item        Item
+		duration    time.Duration
+		quantity    int
+		wantCodes   []string
+		wantUnits   int
+		wantTotal   float64
+		wantDeposit float64
+		wantErr     bool
+	}{
+		{
+			name:      "daily",
+			item:      Item{Price: 100},
+			duration:  3 * 24 * time.Hour,
+			wantCodes: []string{"rental_daily", "platform_fee", "tax"},
+			wantUnits: 3, wantTotal: 371.7, // 300 + 15 fee + 56.70 GST
+		},
+		{
+			name:      "started day is charged",
+			item:      Item{Price: 100},
+			duration:  25 * time.Hour,
+			wantCodes: []string{"rental_daily", "platform_fee", "tax"},
+			wantUnits: 2, wantTotal: 247.8,
+		},
+		{
+			name:      "monthly and weekly rates first",
+			item:      Item{Price: 100, WeeklyPrice: 500, MonthlyPrice: 2000},
+			duration:  40 * 24 * time.Hour, // 30 + 7 + 3 days
+			wantCodes: []string{"rental_monthly", "rental_weekly", "rental_daily", "platform_fee", "tax"},
+			wantUnits: 40, wantTotal: 3469.2,
+		},
+		{
+			name:      "hourly",
+			item:      Item{Price: 50, PriceUnit: PriceUnitHour},
+			duration:  3 * time.Hour,
+			wantCodes: []string{"rental_hourly", "platform_fee", "tax"},
+			wantUnits: 3, wantTotal: 185.85,
+		},
+		{
+			name:      "several units",
+			item:      Item{Price: 100, Quantity: 3, DepositAmount: 500},
+			duration:  2 * 24 * time.Hour,
+			quantity:  2,
+			wantCodes: []string{"rental_daily", "platform_fee", "tax"},
+			wantUnits: 2, wantTotal: 495.6, wantDeposit: 1000,
+		},
+		{
+			name:      "shortest rental is a day",
+			item:      Item{Price: 100},
+			duration:  time.Hour,
+			wantCodes: []string{"rental_daily", "platform_fee", "tax"},
+			wantUnits: 1, wantTotal: 123.9,
+		},
+		{name: "no price", item: Item{}, duration: 24 * time.Hour, wantErr: true},
+		{name: "more units than listed", item: Item{Price: 100, Quantity: 2}, duration: 24 * time.Hour, quantity: 3, wantErr: true},
+		{name: "too short", item: Item{Price: 100, MinDuration: 2}, duration: 24 * time.Hour, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote, err := calculateQuote(&tt.item, start, start.Add(tt.duration), tt.quantity)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("calculateQuote() = %+v, want an error", quote)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("calculateQuote() error = %v", err)
+			}
+
+			var codes []string
+			for _, l := range quote.LineItems {
+				codes = append(codes, l.Code)
+			}
+			if !reflect.DeepEqual(codes, tt.wantCodes) {
+				t.Errorf("line items = %v, want %v", codes, tt.wantCodes)
+			}
+			if quote.Units != tt.wantUnits {
+				t.Errorf("units = %d, want %d", quote.Units, tt.wantUnits)
+			}
+			if quote.Total != tt.wantTotal {
+				t.Errorf("total = %v, want %v", quote.Total, tt.wantTotal)
+			}
+			if quote.Deposit != tt.wantDeposit {
+				t.Errorf("deposit = %v, want %v", quote.Deposit, tt.wantDeposit)
+			}
+		})
+	}
+}
+
+func TestValidateRentalPeriod(t *testing.T) {
+	t.Setenv("TIME_ZONE", "Asia/Kolkata")
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, kolkata)
+	ist := time.Date(2025, 3, 1, 10, 0, 0, 0, time.FixedZone("IST", 5*60*60+30*60))
+
+	tests := []struct {
+		name     string
+		item     Item
+		start    time.Time
+		duration time.Duration
+		wantErr  string
+	}{
+		{name: "no limits", item: Item{}, start: start, duration: time.Hour},
+		{name: "hourly on the hour", item: Item{PriceUnit: PriceUnitHour}, start: start, duration: 2 * time.Hour},
+		{
+			name: "hourly starting off the hour", item: Item{PriceUnit: PriceUnitHour},
+			start: start.Add(30 * time.Minute), duration: 2 * time.Hour,
+			wantErr: "Hourly rentals must start and end on the hour",
+		},
+		{
+			name: "hourly ending off the hour", item: Item{PriceUnit: PriceUnitHour},
+			start: start, duration: 90 * time.Minute,
+			wantErr: "Hourly rentals must start and end on the hour",
+		},
+		{name: "daily off the hour", item: Item{}, start: start.Add(30 * time.Minute), duration: 24 * time.Hour},
+		{name: "at the minimum", item: Item{MinDuration: 3}, start: start, duration: 3 * 24 * time.Hour},
+		{
+			name: "below the minimum", item: Item{MinDuration: 3},
+			start: start, duration: 2 * 24 * time.Hour,
+			wantErr: "Minimum rental period for this item is 3 days",
+		},
+		{name: "started days count towards the minimum", item: Item{MinDuration: 3}, start: start, duration: 49 * time.Hour},
+		{name: "hourly on the hour in India", item: Item{PriceUnit: PriceUnitHour}, start: ist, duration: 2 * time.Hour},
+		{name: "hourly on the hour in India, sent as UTC", item: Item{PriceUnit: PriceUnitHour}, start: ist.UTC(), duration: 2 * time.Hour},
+		{
+			name: "hourly on the UTC hour is off the hour in India", item: Item{PriceUnit: PriceUnitHour},
+			start: ist.Add(30 * time.Minute), duration: 2 * time.Hour,
+			wantErr: "Hourly rentals must start and end on the hour",
+		},
+		{
+			name: "hourly off by a second", item: Item{PriceUnit: PriceUnitHour},
+			start: ist.Add(time.Second), duration: 2 * time.Hour,
+			wantErr: "Hourly rentals must start and end on the hour",
+		},
+		{name: "at the maximum", item: Item{PriceUnit: PriceUnitHour, MaxDuration: 4}, start: start, duration: 4 * time.Hour},
+		{
+			name: "above the maximum", item: Item{PriceUnit: PriceUnitHour, MaxDuration: 4},
+			start: start, duration: 5 * time.Hour,
+			wantErr: "Maximum rental period for this item is 4 hours",
+		},
+		{
+			name: "started weeks count towards the maximum", item: Item{PriceUnit: PriceUnitWeek, MaxDuration: 1},
+			start: start, duration: 8 * 24 * time.Hour,
+			wantErr: "Maximum rental period for this item is 1 week",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRentalPeriod(&tt.item, tt.start, tt.start.Add(tt.duration))
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.wantErr {
+				t.Errorf("validateRentalPeriod() error = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNegotiatedQuote(t *testing.T) {
+	t.Setenv("PLATFORM_FEE_PERCENT", "5")
+	t.Setenv("GST_PERCENT", "18")
+	t.Setenv("TIME_ZONE", "Asia/Kolkata")
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.FixedZone("IST", 5*60*60+30*60))
+	item := &Item{Price: 100, Quantity: 5}
+
+	tests := []struct {
+		name      string
+		quantity  int
+		rental    float64
+		wantLabel string
+		wantTotal float64
+		wantErr   bool
+	}{
+		{"one unit", 1, 250, "Negotiated rental, 3 days", 309.75, false}, // 250 + 12.50 fee + 47.25 GST
+		{"several units", 2, 500, "Negotiated rental, 3 days, 2 units", 619.5, false},
+		{"rounded to the paisa", 1, 250.004, "Negotiated rental, 3 days", 309.75, false},
+		{name: "zero", quantity: 1, rental: 0, wantErr: true},
+		{name: "negative", quantity: 1, rental: -100, wantErr: true},
+		{name: "more units than listed", quantity: 6, rental: 500, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote, err := negotiatedQuote(item, start, start.AddDate(0, 0, 3), tt.quantity, tt.rental)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("negotiatedQuote() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := quote.LineItems[0]; got.Code != "rental_negotiated" || got.Label != tt.wantLabel {
+				t.Errorf("rental line = %+v, want %q", got, tt.wantLabel)
+			}
+			if quote.Total != tt.wantTotal {
+				t.Errorf("total = %v, want %v", quote.Total, tt.wantTotal)
+			}
+			if got := rentalAmount(quote); got != roundMoney(tt.rental) {
+				t.Errorf("rentalAmount() = %v, want %v", got, roundMoney(tt.rental))
+			}
+		})
+	}
+}
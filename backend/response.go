@@ -0,0 +1,160 @@
+package backend
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Outcomes of a booking request, from the owner's side
+const (
+	ResponseAccepted = "accepted"
+	ResponseDeclined = "declined"
+	ResponseTimedOut = "timed_out"
+)
+
+// responseStatsSample is how many of an owner's latest requests their
+// response metrics are based on
+const responseStatsSample = 100
+
+// bookingResponseWindow is how long an owner has to answer a booking request
+// before it is rejected on their behalf
+func bookingResponseWindow() time.Duration {
+	return envDuration("BOOKING_RESPONSE_WINDOW", 24*time.Hour)
+}
+
+// responseTransitionFields returns the owner's response to record when a
+// status change answers a booking request. Instant bookings and requests the
+// renter withdrew aren't counted.
+func responseTransitionFields(booking *Booking, to, role string, now time.Time) bson.M {
+	if booking.Status != StatusPending || booking.AutoConfirm || booking.OwnerResponse != nil {
+		return nil
+	}
+
+	response := OwnerResponse{At: now}
+	switch {
+	case to == StatusConfirmed && role == RoleOwner:
+		response.Outcome = ResponseAccepted
+	case (to == StatusRejected || to == StatusCancelled) && role == RoleOwner:
+		response.Outcome = ResponseDeclined
+	case to == StatusRejected && role == RoleSystem:
+		// Only held against the owner if the request was paid, as owners
+		// can't confirm unpaid ones
+		if booking.PaymentStatus != PaymentPaid {
+			return nil
+		}
+		response.Outcome = ResponseTimedOut
+	default:
+		return nil
+	}
+	if response.Outcome != ResponseTimedOut {
+		response.Seconds = int64(now.Sub(booking.CreatedAt).Seconds())
+	}
+	return bson.M{"ownerResponse": response}
+}
+
+// rejectUnansweredRequests rejects booking requests the owner hasn't answered
+// within the response window, so renters can look elsewhere
+func rejectUnansweredRequests(ctx context.Context) error {
+	cursor, err := GetCollection("bookings").Find(ctx, bson.M{
+		"status":      StatusPending,
+		"autoConfirm": bson.M{"$ne": true},
+		"createdAt":   bson.M{"$lt": time.Now().Add(-bookingResponseWindow())},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var booking Booking
+		if err := cursor.Decode(&booking); err != nil {
+			log.Printf("Error decoding booking: %v", err)
+			continue
+		}
+
+		if err := transitionBooking(ctx, &booking, StatusRejected, RoleSystem, primitive.NilObjectID, "Owner did not respond in time", nil); err != nil {
+			log.Printf("Could not reject booking %s: %v", booking.ID.Hex(), err)
+			continue
+		}
+
+		notifyBookingEvent(ctx, &booking, booking.RenterID, "response_timeout")
+		notifyBookingEvent(ctx, &booking, booking.OwnerID, "response_missed")
+		count++
+	}
+
+	if count > 0 {
+		log.Printf("Rejected %d unanswered booking requests", count)
+	}
+	return cursor.Err()
+}
+
+// ownerResponseStats returns the median time in minutes an owner takes to
+// answer a booking request and the percentage of requests they accept, over
+// their latest requests. Either is nil when there is nothing to go on.
+func ownerResponseStats(ctx context.Context, ownerID primitive.ObjectID) (*float64, *float64) {
+	opts := options.Find().
+		SetSort(bson.M{"ownerResponse.at": -1}).
+		SetLimit(responseStatsSample).
+		SetProjection(bson.M{"ownerResponse": 1})
+	cursor, err := GetCollection("bookings").Find(ctx, bson.M{
+		"ownerId":       ownerID,
+		"ownerResponse": bson.M{"$exists": true},
+	}, opts)
+	if err != nil {
+		return nil, nil
+	}
+	defer cursor.Close(ctx)
+
+	var responses []OwnerResponse
+	for cursor.Next(ctx) {
+		var booking Booking
+		if err := cursor.Decode(&booking); err != nil || booking.OwnerResponse == nil {
+			continue
+		}
+		responses = append(responses, *booking.OwnerResponse)
+	}
+	return responseStats(responses)
+}
+
+// responseStats returns the median response time in minutes and the
+// acceptance rate of responses. Timeouts count against the rate but have no
+// response time.
+func responseStats(responses []OwnerResponse) (*float64, *float64) {
+	if len(responses) == 0 {
+		return nil, nil
+	}
+
+	var seconds []int64
+	accepted := 0
+	for _, response := range responses {
+		switch response.Outcome {
+		case ResponseAccepted:
+			accepted++
+			seconds = append(seconds, response.Seconds)
+		case ResponseDeclined:
+			seconds = append(seconds, response.Seconds)
+		}
+	}
+
+	rate := math.Round(float64(accepted)/float64(len(responses))*1000) / 10
+	if len(seconds) == 0 {
+		return nil, &rate
+	}
+
+	sort.Slice(seconds, func(i, j int) bool { return seconds[i] < seconds[j] })
+	mid := len(seconds) / 2
+	median := float64(seconds[mid])
+	if len(seconds)%2 == 0 {
+		median = float64(seconds[mid-1]+seconds[mid]) / 2
+	}
+	minutes := math.Round(median / 60)
+	return &minutes, &rate
+}
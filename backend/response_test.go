@@ -0,0 +1,83 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestResponseTransitionFields(t *testing.T) {
+	created := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	now := created.Add(90 * time.Minute)
+	pending := &Booking{Status: StatusPending, PaymentStatus: PaymentPaid, CreatedAt: created}
+	unpaid := &Booking{Status: StatusPending, PaymentStatus: PaymentPending, CreatedAt: created}
+	answered := func(outcome string, seconds int64) bson.M {
+		return bson.M{"ownerResponse": OwnerResponse{Outcome: outcome, Seconds: seconds, At: now}}
+	}
+
+	tests := []struct {
+		name     string
+		booking  *Booking
+		to, role string
+		want     bson.M
+	}{
+		{"owner confirms", pending, StatusConfirmed, RoleOwner, answered(ResponseAccepted, 5400)},
+		{"owner rejects", pending, StatusRejected, RoleOwner, answered(ResponseDeclined, 5400)},
+		{"owner cancels a request", pending, StatusCancelled, RoleOwner, answered(ResponseDeclined, 5400)},
+		{"no answer to a paid request", pending, StatusRejected, RoleSystem, answered(ResponseTimedOut, 0)},
+		{"no answer to an unpaid request", unpaid, StatusRejected, RoleSystem, nil},
+		{"renter withdraws", pending, StatusCancelled, RoleRenter, nil},
+		{"expired", pending, StatusExpired, RoleSystem, nil},
+		{"instant book", &Booking{Status: StatusPending, AutoConfirm: true, CreatedAt: created}, StatusConfirmed, RoleSystem, nil},
+		{"already answered", &Booking{Status: StatusPending, OwnerResponse: &OwnerResponse{Outcome: ResponseAccepted}}, StatusCancelled, RoleOwner, nil},
+		{"after confirmation", &Booking{Status: StatusConfirmed, CreatedAt: created}, StatusCancelled, RoleOwner, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := responseTransitionFields(tt.booking, tt.to, tt.role, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("responseTransitionFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponseStats(t *testing.T) {
+	accepted := func(minutes int64) OwnerResponse {
+		return OwnerResponse{Outcome: ResponseAccepted, Seconds: minutes * 60}
+	}
+	declined := func(minutes int64) OwnerResponse {
+		return OwnerResponse{Outcome: ResponseDeclined, Seconds: minutes * 60}
+	}
+	timedOut := OwnerResponse{Outcome: ResponseTimedOut}
+	value := func(v float64) *float64 { return &v }
+	show := func(v *float64) interface{} {
+		if v == nil {
+			return nil
+		}
+		return *v
+	}
+
+	tests := []struct {
+		name        string
+		responses   []OwnerResponse
+		wantMinutes *float64
+		wantRate    *float64
+	}{
+		{"none", nil, nil, nil},
+		{"one", []OwnerResponse{accepted(30)}, value(30), value(100)},
+		{"odd count", []OwnerResponse{accepted(10), declined(90), accepted(20)}, value(20), value(66.7)},
+		{"even count", []OwnerResponse{accepted(10), accepted(20), declined(30), accepted(60)}, value(25), value(75)},
+		{"timeouts count against the rate only", []OwnerResponse{accepted(10), timedOut}, value(10), value(50)},
+		{"only timeouts", []OwnerResponse{timedOut, timedOut}, nil, value(0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			minutes, rate := responseStats(tt.responses)
+			if !reflect.DeepEqual(minutes, tt.wantMinutes) || !reflect.DeepEqual(rate, tt.wantRate) {
+				t.Errorf("responseStats() = %v, %v, want %v, %v", show(minutes), show(rate), show(tt.wantMinutes), show(tt.wantRate))
+			}
+		})
+	}
+}
@@ -138,7 +138,9 @@ func createReview(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if booking.Status != "confirmed" && booking.Status != "completed" {
+	switch booking.Status {
+	case StatusConfirmed, StatusHandedOver, StatusReturned, StatusCompleted:
+	default:
 		JSONError(w, http.StatusForbidden, "Can only review confirmed or completed bookings")
 		return
 	}
@@ -162,14 +164,15 @@ func createReview(w http.ResponseWriter, r *http.Request) {
 	}
 
 	review := Review{
-		ID:         primitive.NewObjectID(),
-		BookingID:  bookingID,
-		ReviewerID: userID,
-		TargetType: req.TargetType,
-		TargetID:   targetID,
-		Rating:     req.Rating,
-		Comment:    req.Comment,
-		CreatedAt:  time.Now(),
+		ID:             primitive.NewObjectID(),
+		BookingID:      bookingID,
+		ReviewerID:     userID,
+		TargetType:     req.TargetType,
+		TargetID:       targetID,
+		Rating:         req.Rating,
+		Comment:        req.Comment,
+		VerifiedRental: booking.Pickup != nil && booking.Pickup.VerifiedAt != nil,
+		CreatedAt:      time.Now(),
 	}
 
 	GetCollection("reviews").InsertOne(ctx, review)
@@ -215,8 +218,9 @@ func getReviewsByTarget(w http.ResponseWriter, r *http.Request, targetType strin
 	JSON(w, http.StatusOK, map[string]interface{}{"reviews": reviews})
 }
 
-func updateTargetRating(ctx context.Context, targetType string, targetID primitive.ObjectID) {
-	// Calculate average rating
+// averageRating computes the average rating and number of reviews of a
+// target from its reviews
+func averageRating(ctx context.Context, targetType string, targetID primitive.ObjectID) (float64, int, error) {
 	pipeline := []bson.M{
 		{"$match": bson.M{"targetType": targetType, "targetId": targetID}},
 		{"$group": bson.M{
@@ -228,7 +232,7 @@ func updateTargetRating(ctx context.Context, targetType string, targetID primiti
 
 	cursor, err := GetCollection("reviews").Aggregate(ctx, pipeline)
 	if err != nil {
-		return
+		return 0, 0, err
 	}
 	defer cursor.Close(ctx)
 
@@ -236,14 +240,20 @@ func updateTargetRating(ctx context.Context, targetType string, targetID primiti
 		AvgRating float64 `bson:"avgRating"`
 		Count     int     `bson:"count"`
 	}
-	cursor.All(ctx, &results)
-
+	if err := cursor.All(ctx, &results); err != nil {
+		return 0, 0, err
+	}
 	if len(results) == 0 {
-		return
+		return 0, 0, nil
 	}
+	return results[0].AvgRating, results[0].Count, nil
+}
 
-	avgRating := results[0].AvgRating
-	reviewCount := results[0].Count
+func updateTargetRating(ctx context.Context, targetType string, targetID primitive.ObjectID) {
+	avgRating, reviewCount, err := averageRating(ctx, targetType, targetID)
+	if err != nil || reviewCount == 0 {
+		return
+	}
 
 	// Update the target's rating field
 	if targetType == "item" {
@@ -54,12 +54,35 @@ func SetupRouter() http.Handler {
 	mux.HandleFunc("/api/items/", HandleItemByID)
 	mux.HandleFunc("/api/items/my/listings", AuthMiddleware(HandleMyListings))
 
+	// Category routes
+	mux.HandleFunc("/api/categories", HandleCategories)
+	mux.HandleFunc("/api/categories/", HandleCategoryByID)
+	mux.HandleFunc("/api/search/suggest", HandleSearchSuggest)
+
 	// Booking routes - IMPORTANT: specific routes must come before wildcard /api/bookings/
 	mux.HandleFunc("/api/bookings", AuthMiddleware(HandleBookings))
 	mux.HandleFunc("/api/bookings/owner", AuthMiddleware(HandleOwnerBookings))
 	mux.HandleFunc("/api/bookings/pending-count", AuthMiddleware(HandlePendingRequestsCount))
+	mux.HandleFunc("/api/bookings/quote", AuthMiddleware(HandleBookingQuote))
+	mux.HandleFunc("/api/bookings/track/", AuthMiddleware(HandleBookingTrack))
 	mux.HandleFunc("/api/bookings/", AuthMiddleware(HandleBookingByID))
 
+	// Cart and order routes
+	mux.HandleFunc("/api/cart", AuthMiddleware(HandleCart))
+	mux.HandleFunc("/api/cart/", AuthMiddleware(HandleCart))
+	mux.HandleFunc("/api/orders", AuthMiddleware(HandleOrders))
+	mux.HandleFunc("/api/orders/", AuthMiddleware(HandleOrderByID))
+
+	// Subscription routes
+	mux.HandleFunc("/api/subscriptions", AuthMiddleware(HandleSubscriptions))
+	mux.HandleFunc("/api/subscriptions/", AuthMiddleware(HandleSubscriptionByID))
+
+	// Payment routes
+	mux.HandleFunc("/api/payments/webhook", HandlePaymentWebhook)
+	if paymentProvider().Name() == "mock" {
+		mux.HandleFunc("/api/payments/mock/complete", AuthMiddleware(HandleMockPaymentComplete))
+	}
+
 	//Chat routes
 	mux.HandleFunc("/api/chats", AuthMiddleware(HandleChats))
 	mux.HandleFunc("/api/chats/unread-count", AuthMiddleware(HandleUnreadCount))
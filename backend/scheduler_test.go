@@ -0,0 +1,66 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(ctx context.Context) error
+	}{
+		{"succeeds", func(ctx context.Context) error { return nil }},
+		{"fails", func(ctx context.Context) error { return errors.New("boom") }},
+		{"panics", func(ctx context.Context) error { panic("boom") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var runs atomic.Int32
+			s := NewScheduler()
+			s.Register(tt.name, 10*time.Millisecond, func(ctx context.Context) error {
+				runs.Add(1)
+				return tt.run(ctx)
+			})
+			s.Start()
+			time.Sleep(55 * time.Millisecond)
+			s.Stop()
+
+			// Runs once at start, then keeps going after failures and panics
+			if got := runs.Load(); got < 2 {
+				t.Errorf("job ran %d times, want at least 2", got)
+			}
+			after := runs.Load()
+			time.Sleep(30 * time.Millisecond)
+			if got := runs.Load(); got != after {
+				t.Errorf("job ran %d times after Stop", got-after)
+			}
+		})
+	}
+}
+
+func TestSchedulerStopWaitsForRun(t *testing.T) {
+	started := make(chan struct{})
+	var finished atomic.Bool
+	s := NewScheduler()
+	s.Register("slow", time.Hour, func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		finished.Store(true)
+		return ctx.Err()
+	})
+	s.Start()
+	<-started
+	s.Stop()
+	if !finished.Load() {
+		t.Error("Stop returned before the running job finished")
+	}
+}
+
+func TestSchedulerStopBeforeStart(t *testing.T) {
+	NewScheduler().Stop()
+}
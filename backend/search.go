@@ -0,0 +1,419 @@
+package backend
+
+import (
+	"context"
+	"html"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// maxSearchLength caps the search string; the rest is ignored
+	maxSearchLength = 100
+
+	// minGramSimilarity is the share of a query's trigrams an item has to
+	// contain to match when the text index finds nothing
+	minGramSimilarity = 0.5
+
+	// maxTextMatches caps the matches collected when a text search is
+	// combined with a distance search
+	maxTextMatches = 1000
+
+	// descriptionSnippetLength is how much of the description is returned
+	// around its first match
+	descriptionSnippetLength = 160
+)
+
+// itemTextIndex is the weighted text index searches run against. A
+// collection has only one, so changing it means dropping the old one.
+var itemTextIndex = mongo.IndexModel{
+	Keys: bson.D{
+		{Key: "title", Value: "text"},
+		{Key: "brand", Value: "text"},
+		{Key: "model", Value: "text"},
+		{Key: "search.attributes", Value: "text"},
+		{Key: "description", Value: "text"},
+	},
+	Options: options.Index().SetName("item_text").SetWeights(bson.M{
+		"title":             10,
+		"brand":             6,
+		"model":             6,
+		"search.attributes": 3,
+		"description":       1,
+	}),
+}
+
+// ItemSearch holds the fields derived from an item for searching it
+type ItemSearch struct {
+	Attributes string   `bson:"attributes,omitempty"` // attribute values, for the text index
+	Grams      []string `bson:"grams,omitempty"`      // trigrams of the short fields, for misspelled searches
+}
+
+// searchWords splits s into lower-case words
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// trigrams returns the trigrams of a word padded the way pg_trgm does, so
+// the start and end of a word weigh in and short words still have some
+func trigrams(word string) []string {
+	runes := []rune("  " + word + " ")
+	grams := make([]string, 0, len(runes)-2)
+	for i := 0; i+3 <= len(runes); i++ {
+		grams = append(grams, string(runes[i:i+3]))
+	}
+	return grams
+}
+
+// gramSet returns the distinct trigrams of all words, sorted
+func gramSet(words []string) []string {
+	seen := map[string]bool{}
+	for _, w := range words {
+		for _, g := range trigrams(w) {
+			seen[g] = true
+		}
+	}
+	grams := make([]string, 0, len(seen))
+	for g := range seen {
+		grams = append(grams, g)
+	}
+	sort.Strings(grams)
+	return grams
+}
+
+// itemSearchFields derives the search fields of an item
+func itemSearchFields(item *Item) *ItemSearch {
+	values := make([]string, 0, len(item.Attributes))
+	for _, v := range item.Attributes {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	attributes := strings.Join(values, " ")
+
+	var words []string
+	for _, field := range []string{item.Title, item.Brand, item.Model, item.Category, item.SubCategory, attributes} {
+		words = append(words, searchWords(field)...)
+	}
+	return &ItemSearch{Attributes: attributes, Grams: gramSet(words)}
+}
+
+// refreshItemSearch recomputes the search fields of an item after an update
+func refreshItemSearch(ctx context.Context, itemID primitive.ObjectID) error {
+	var item Item
+	if err := GetCollection("items").FindOne(ctx, bson.M{"_id": itemID}).Decode(&item); err != nil {
+		return err
+	}
+	_, err := GetCollection("items").UpdateOne(ctx, bson.M{"_id": itemID}, bson.M{"$set": bson.M{"search": itemSearchFields(&item)}})
+	return err
+}
+
+const (
+	// searchIndexBatch is how many items indexItemsForSearch updates per write
+	searchIndexBatch = 500
+	// searchIndexTimeout bounds the indexing run started by ConnectDB
+	searchIndexTimeout = 30 * time.Minute
+)
+
+// indexItemsForSearch fills in the search fields of items listed before
+// they existed. It can take a while on a large catalogue, so it is run in
+// the background at startup rather than within the connect timeout.
+func indexItemsForSearch(ctx context.Context) error {
+	items := GetCollection("items")
+	cursor, err := items.Find(ctx, bson.M{"search": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	var batch []mongo.WriteModel
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if _, err := items.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+		count += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for cursor.Next(ctx) {
+		var item Item
+		if err := cursor.Decode(&item); err != nil {
+			return err
+		}
+		batch = append(batch, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": item.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"search": itemSearchFields(&item)}}))
+		if len(batch) == searchIndexBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if count > 0 {
+		log.Printf("Indexed %d items for search", count)
+	}
+	return nil
+}
+
+// textQuery is a parsed search string. Only its words are used, so
+// operators and special characters in it have no effect.
+type textQuery struct {
+	Words []string
+}
+
+// parseTextQuery returns nil for a search with no words in it
+func parseTextQuery(search string) *textQuery {
+	if runes := []rune(search); len(runes) > maxSearchLength {
+		search = string(runes[:maxSearchLength])
+	}
+	words := searchWords(search)
+	if len(words) == 0 {
+		return nil
+	}
+	return &textQuery{Words: words}
+}
+
+// scoredItem is an item with its relevance to a search
+type scoredItem struct {
+	Item  `bson:",inline"`
+	Score float64 `bson:"score"`
+}
+
+// findItemsMatching returns a page of the items matching filter and q, best
+// match first, and how many match in all. It uses the text index, and
+// falls back to trigram similarity when that finds nothing, which catches
+// misspellings. fuzzy reports whether the fallback was used.
+func findItemsMatching(ctx context.Context, q *textQuery, filter bson.M, skip, limit int64) (items []Item, total int64, fuzzy bool, err error) {
+	collection := GetCollection("items")
+
+	textFilter := bson.M{"$text": bson.M{"$search": strings.Join(q.Words, " ")}}
+	for k, v := range filter {
+		textFilter[k] = v
+	}
+	total, err = collection.CountDocuments(ctx, textFilter)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if total > 0 {
+		score := bson.M{"$meta": "textScore"}
+		cursor, err := collection.Find(ctx, textFilter, options.Find().
+			SetProjection(bson.M{"score": score}).
+			SetSort(bson.D{{Key: "score", Value: score}, {Key: "createdAt", Value: -1}}).
+			SetSkip(skip).SetLimit(limit))
+		if err != nil {
+			return nil, 0, false, err
+		}
+		items, err := decodeScored(ctx, cursor)
+		return items, total, false, err
+	}
+
+	items, total, err = findItemsByGrams(ctx, q, filter, skip, limit)
+	return items, total, true, err
+}
+
+// findItemsByGrams matches items sharing enough trigrams with the query,
+// most similar first
+func findItemsByGrams(ctx context.Context, q *textQuery, filter bson.M, skip, limit int64) ([]Item, int64, error) {
+	grams := gramSet(q.Words)
+	match := bson.M{"search.grams": bson.M{"$in": grams}}
+	for k, v := range filter {
+		match[k] = v
+	}
+
+	cursor, err := GetCollection("items").Aggregate(ctx, bson.A{
+		bson.M{"$match": match},
+		bson.M{"$addFields": bson.M{"score": bson.M{"$divide": bson.A{
+			bson.M{"$size": bson.M{"$setIntersection": bson.A{"$search.grams", grams}}},
+			len(grams),
+		}}}},
+		bson.M{"$match": bson.M{"score": bson.M{"$gte": minGramSimilarity}}},
+		bson.M{"$facet": bson.M{
+			"items": bson.A{
+				bson.M{"$sort": bson.D{{Key: "score", Value: -1}, {Key: "createdAt", Value: -1}}},
+				bson.M{"$skip": skip},
+				bson.M{"$limit": limit},
+			},
+			"total": bson.A{bson.M{"$count": "count"}},
+		}},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Items []scoredItem `bson:"items"`
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, 0, err
+	}
+	if len(result) == 0 || len(result[0].Total) == 0 {
+		return []Item{}, 0, nil
+	}
+	return withScores(result[0].Items), result[0].Total[0].Count, nil
+}
+
+// decodeScored reads items with a score field from cursor
+func decodeScored(ctx context.Context, cursor *mongo.Cursor) ([]Item, error) {
+	defer cursor.Close(ctx)
+	var scored []scoredItem
+	if err := cursor.All(ctx, &scored); err != nil {
+		return nil, err
+	}
+	return withScores(scored), nil
+}
+
+func withScores(scored []scoredItem) []Item {
+	items := make([]Item, 0, len(scored))
+	for _, s := range scored {
+		score := math.Round(s.Score*100) / 100
+		s.Item.Score = &score
+		items = append(items, s.Item)
+	}
+	return items
+}
+
+// textMatchIDs returns the IDs of the best matches for q among the items
+// matching filter, for searches ordered by something other than relevance.
+// Only maxTextMatches are returned, so filter should already hold every
+// restriction, including the search radius.
+func textMatchIDs(ctx context.Context, q *textQuery, filter bson.M) ([]primitive.ObjectID, error) {
+	items, _, _, err := findItemsMatching(ctx, q, filter, 0, maxTextMatches)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(items))
+	for i := range items {
+		ids[i] = items[i].ID
+	}
+	return ids, nil
+}
+
+// wordMatches reports whether a word of an item matches a query word: one
+// is a prefix of the other, which covers plurals and the stemming the text
+// index does, or they share most of their trigrams
+func wordMatches(word, query string) bool {
+	if len(word) < 3 || len(query) < 3 {
+		return word == query
+	}
+	if strings.HasPrefix(word, query) || strings.HasPrefix(query, word) {
+		return true
+	}
+	have := map[string]bool{}
+	for _, g := range trigrams(word) {
+		have[g] = true
+	}
+	grams := trigrams(query)
+	shared := 0
+	for _, g := range grams {
+		if have[g] {
+			shared++
+		}
+	}
+	return float64(shared) >= minGramSimilarity*float64(len(grams))
+}
+
+// highlight returns s with the words matching q wrapped in <mark> tags and
+// the rest HTML-escaped, or "" if nothing matches. With window > 0, only
+// about that many characters around the first match are returned.
+func highlight(s string, q *textQuery, window int) string {
+	runes := []rune(s)
+	type span struct{ start, end int }
+	var spans []span
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsNumber(runes[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsNumber(runes[j])) {
+			j++
+		}
+		word := strings.ToLower(string(runes[i:j]))
+		for _, w := range q.Words {
+			if wordMatches(word, w) {
+				spans = append(spans, span{i, j})
+				break
+			}
+		}
+		i = j
+	}
+	if len(spans) == 0 {
+		return ""
+	}
+
+	from, to := 0, len(runes)
+	if window > 0 && len(runes) > window {
+		from = spans[0].start - window/4
+		if from < 0 {
+			from = 0
+		}
+		to = from + window
+		if to > len(runes) {
+			to = len(runes)
+		}
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, sp := range spans {
+		if sp.start < from || sp.end > to {
+			continue
+		}
+		b.WriteString(html.EscapeString(string(runes[pos:sp.start])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(runes[sp.start:sp.end])))
+		b.WriteString("</mark>")
+		pos = sp.end
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:to])))
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// highlightItem sets the highlighted fields of an item that match q
+func highlightItem(item *Item, q *textQuery) {
+	fields := map[string]string{
+		"title":       highlight(item.Title, q, 0),
+		"brand":       highlight(item.Brand, q, 0),
+		"model":       highlight(item.Model, q, 0),
+		"description": highlight(item.Description, q, descriptionSnippetLength),
+	}
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if item.Highlights == nil {
+			item.Highlights = map[string]string{}
+		}
+		item.Highlights[name] = value
+	}
+}
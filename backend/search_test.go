@@ -0,0 +1,77 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTrigrams(t *testing.T) {
+	tests := []struct {
+		word string
+		want []string
+	}{
+		{"cat", []string{"  c", " ca", "cat", "at "}},
+		{"a", []string{"  a", " a "}},
+		{"", []string{"   "}},
+		{"née", []string{"  n", " né", "née", "ée "}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			if got := trigrams(tt.word); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("trigrams(%q) = %q, want %q", tt.word, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWordMatches(t *testing.T) {
+	tests := []struct {
+		word, query string
+		want        bool
+	}{
+		{"camera", "camera", true},
+		{"cameras", "camera", true},
+		{"camera", "cameras", true},
+		{"camera", "cam", true},
+		{"canon", "cannon", true},
+		{"camera", "camrea", false},
+		{"drill", "camera", false},
+		{"tv", "tv", true},
+		{"tv", "tvs", false},
+		{"tvs", "tv", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.word+"/"+tt.query, func(t *testing.T) {
+			if got := wordMatches(tt.word, tt.query); got != tt.want {
+				t.Errorf("wordMatches(%q, %q) = %v, want %v", tt.word, tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name   string
+		s      string
+		search string
+		window int
+		want   string
+	}{
+		{"match", "Canon EOS camera", "canon", 0, "<mark>Canon</mark> EOS camera"},
+		{"several words", "Canon EOS camera", "eos cameras", 0, "Canon <mark>EOS</mark> <mark>camera</mark>"},
+		{"no match", "Canon EOS camera", "drill", 0, ""},
+		{"escapes the rest", "Tripod & <stand>", "tripod", 0, "<mark>Tripod</mark> &amp; &lt;stand&gt;"},
+		{"misspelt", "Cannon lens", "canon", 0, "<mark>Cannon</mark> lens"},
+		{"window around the first match", "aaaa bbbb cccc dddd eeee ffff gggg", "eeee", 12, "…dd <mark>eeee</mark> ffff…"},
+		{"window at the start", "aaaa bbbb cccc dddd", "aaaa", 10, "<mark>aaaa</mark> bbbb …"},
+		{"short text ignores the window", "aaaa bbbb", "bbbb", 20, "aaaa <mark>bbbb</mark>"},
+		{"matches outside the window are left out", "aaaa bbbb cccc dddd aaaa", "aaaa", 10, "<mark>aaaa</mark> bbbb …"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlight(tt.s, parseTextQuery(tt.search), tt.window); got != tt.want {
+				t.Errorf("highlight() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
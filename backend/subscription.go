@@ -0,0 +1,766 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Subscription statuses
+const (
+	SubscriptionPending   = "pending" // contract booking waiting on the owner or payment
+	SubscriptionActive    = "active"  // renewing every month
+	SubscriptionEnding    = "ending"  // notice given, runs until endDate
+	SubscriptionEnded     = "ended"
+	SubscriptionCancelled = "cancelled" // contract booking never went ahead
+)
+
+// maxNoticeDays caps the notice period an owner can ask for
+const maxNoticeDays = 90
+
+// subscriptionHorizon is how far ahead a new subscription checks the item is
+// free. It has no end date, so later bookings would otherwise collide with it.
+const subscriptionHorizon = 2 * 365 * 24 * time.Hour
+
+// subscriptionRenewalLead is how long before a cycle ends the next one is
+// billed, so a failed charge leaves the renter time to pay by hand
+func subscriptionRenewalLead() time.Duration {
+	return envDuration("SUBSCRIPTION_RENEWAL_LEAD", 72*time.Hour)
+}
+
+// defaultNoticeDays applies to items whose owner hasn't set a notice period
+func defaultNoticeDays() int {
+	return envInt("SUBSCRIPTION_NOTICE_DAYS", 30)
+}
+
+// validateSubscriptionSettings checks an item's subscription settings
+func validateSubscriptionSettings(s *SubscriptionSettings) error {
+	if s == nil {
+		return nil
+	}
+	if s.NoticeDays < 0 || s.NoticeDays > maxNoticeDays {
+		return fmt.Errorf("Notice period must be between 0 and %d days", maxNoticeDays)
+	}
+	return nil
+}
+
+// cycleEnd is the end of cycle n. Cycles follow calendar months from the
+// start date, so a subscription starting on the 5th renews on every 5th.
+func (s *Subscription) cycleEnd(n int) time.Time {
+	return s.StartDate.AddDate(0, n, 0)
+}
+
+// liveSubscriptionStatuses are the statuses in which a subscription holds its item
+var liveSubscriptionStatuses = []string{SubscriptionPending, SubscriptionActive, SubscriptionEnding}
+
+// monthlyQuote prices a month of item from start at its usual rates. Months
+// are taken as daysPerMonth days, as for any booking, so that every calendar
+// month costs the same.
+func monthlyQuote(item *Item, start time.Time, quantity int) (*PriceQuote, error) {
+	return calculateQuote(item, start, start.AddDate(0, 0, daysPerMonth), quantity)
+}
+
+// subscriptionQuote prices cycle n of a subscription at its fixed rental,
+// billed as one month whatever the calendar month's length. The deposit is
+// only taken with the first cycle.
+func subscriptionQuote(item *Item, sub *Subscription, n int) (*PriceQuote, error) {
+	start, end := sub.cycleEnd(n-1), sub.cycleEnd(n)
+	quote, err := monthlyQuote(item, start, sub.Quantity)
+	if err != nil {
+		return nil, err
+	}
+	quote.EndDate = end
+	quote.Days = rentalDays(start, end)
+	quote.Unit = PriceUnitMonth
+	quote.Units = 1
+
+	label := fmt.Sprintf("Subscription, month %d", n)
+	if quote.Quantity > 1 {
+		label += fmt.Sprintf(", %d units", quote.Quantity)
+	}
+	quote.LineItems, quote.Total = addFeesAndTax([]PriceLineItem{{
+		Code: "rental_subscription", Label: label,
+		Quantity: 1, UnitPrice: sub.CycleRental, Amount: sub.CycleRental,
+	}}, sub.CycleRental)
+	if n > 1 {
+		quote.Deposit = 0
+	}
+	return quote, nil
+}
+
+// renewalAmount is what each cycle after the first is charged: the fixed
+// rental with fees and tax, and no deposit. It caps the payment method saved
+// for renewals.
+func renewalAmount(sub *Subscription) float64 {
+	_, total := addFeesAndTax([]PriceLineItem{{
+		Code: "rental_subscription", Quantity: 1, UnitPrice: sub.CycleRental, Amount: sub.CycleRental,
+	}}, sub.CycleRental)
+	return total
+}
+
+// subscriptionHolds returns, per item, the time live subscriptions matching
+// filter hold beyond their paid-for cycles within [start, end). The paid
+// cycles are held by the contract booking itself. Open-ended subscriptions
+// hold up to end.
+func subscriptionHolds(ctx context.Context, filter bson.M, start, end time.Time) (map[primitive.ObjectID][]DateRange, error) {
+	filter["status"] = bson.M{"$in": liveSubscriptionStatuses}
+	filter["paidThrough"] = bson.M{"$lt": end}
+	filter["$or"] = []bson.M{
+		{"endDate": bson.M{"$exists": false}},
+		{"endDate": bson.M{"$gt": start}},
+	}
+
+	cursor, err := GetCollection("subscriptions").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	holds := map[primitive.ObjectID][]DateRange{}
+	for cursor.Next(ctx) {
+		var sub Subscription
+		if err := cursor.Decode(&sub); err != nil {
+			continue
+		}
+		until := end
+		if sub.EndDate != nil {
+			until = *sub.EndDate
+		}
+		if !until.After(sub.PaidThrough) {
+			continue
+		}
+		holds[sub.ItemID] = append(holds[sub.ItemID], DateRange{
+			Start: sub.PaidThrough, End: until, Status: "subscription", Quantity: sub.Quantity,
+		})
+	}
+	return holds, cursor.Err()
+}
+
+// HandleSubscriptions serves GET /api/subscriptions, the renter's
+// subscriptions, and POST /api/subscriptions to start one
+func HandleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		getMySubscriptions(w, r)
+	case http.MethodPost:
+		createSubscription(w, r)
+	default:
+		JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// HandleSubscriptionByID serves GET /api/subscriptions/{id} and
+// POST /api/subscriptions/{id}/cancel
+func HandleSubscriptionByID(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/subscriptions/"), "/")
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		getSubscription(w, r, id)
+	case action == "cancel" && r.Method == http.MethodPost:
+		cancelSubscription(w, r, id)
+	case action == "" || action == "cancel":
+		JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		JSONError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// createSubscription starts a subscription with its contract booking. The
+// booking goes to the owner like any request, or is confirmed once paid if
+// the renter qualifies for instant book.
+func createSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, _ := GetUserID(r)
+
+	var req struct {
+		ItemID        string `json:"itemId"`
+		StartDate     string `json:"startDate"`
+		Quantity      int    `json:"quantity"`
+		PickupAddress string `json:"pickupAddress"`
+		DropAddress   string `json:"dropAddress"`
+		Notes         string `json:"notes"`
+	}
+	if err := DecodeJSON(r, &req); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	itemID, err := primitive.ObjectIDFromHex(req.ItemID)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid item ID")
+		return
+	}
+	startDate, err := time.Parse(time.RFC3339, req.StartDate)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid start date format")
+		return
+	}
+	if !startDate.After(time.Now()) {
+		JSONError(w, http.StatusBadRequest, "Start date must be in the future")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var item Item
+	if err := GetCollection("items").FindOne(ctx, bson.M{"_id": itemID}).Decode(&item); err != nil {
+		JSONError(w, http.StatusNotFound, "Item not found")
+		return
+	}
+	if item.Subscription == nil || !item.Subscription.Enabled {
+		JSONError(w, http.StatusBadRequest, "This item isn't offered on subscription")
+		return
+	}
+	if item.OwnerID == userID {
+		JSONError(w, http.StatusBadRequest, "You can't subscribe to your own item")
+		return
+	}
+	if item.Status != "active" {
+		JSONError(w, http.StatusConflict, "Item is not available")
+		return
+	}
+
+	// The rental per cycle is fixed at the item's rates when subscribing
+	monthly, err := monthlyQuote(&item, startDate, req.Quantity)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now()
+	noticeDays := item.Subscription.NoticeDays
+	if noticeDays == 0 {
+		noticeDays = defaultNoticeDays()
+	}
+	sub := Subscription{
+		ID:            primitive.NewObjectID(),
+		ItemID:        item.ID,
+		RenterID:      userID,
+		OwnerID:       item.OwnerID,
+		Quantity:      monthly.Quantity,
+		StartDate:     startDate,
+		CycleRental:   rentalAmount(monthly),
+		NoticeDays:    noticeDays,
+		Cycles:        1,
+		Status:        SubscriptionPending,
+		PickupAddress: req.PickupAddress,
+		DropAddress:   req.DropAddress,
+		Notes:         req.Notes,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	sub.PeriodEnd = sub.cycleEnd(1)
+	sub.PaidThrough = sub.PeriodEnd
+
+	quote, err := subscriptionQuote(&item, &sub, 1)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	release, err := lockItem(ctx, itemID)
+	if err != nil {
+		JSONError(w, http.StatusConflict, "Item is being booked by someone else, please retry")
+		return
+	}
+	defer release()
+
+	conflicts, err := checkAvailability(ctx, &item, startDate, startDate.Add(subscriptionHorizon), primitive.NilObjectID, sub.Quantity)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to check availability")
+		return
+	}
+	if len(conflicts) > 0 {
+		JSON(w, http.StatusConflict, map[string]interface{}{
+			"error":     "Item is booked after the start date, so it can't be rented open-ended",
+			"conflicts": conflicts,
+		})
+		return
+	}
+
+	if _, err := GetCollection("subscriptions").InsertOne(ctx, sub); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to create subscription")
+		return
+	}
+
+	booking := newBooking(ctx, &item, userID, quote)
+	booking.SubscriptionID = &sub.ID
+	booking.Cycle = 1
+	booking.PickupAddress = sub.PickupAddress
+	booking.DropAddress = sub.DropAddress
+	booking.Notes = sub.Notes
+	if err := insertBooking(ctx, &booking); err != nil {
+		GetCollection("subscriptions").DeleteOne(ctx, bson.M{"_id": sub.ID})
+		JSONError(w, http.StatusInternalServerError, "Failed to create subscription")
+		return
+	}
+	sub.Bookings = []Booking{booking}
+
+	if booking.AutoConfirm {
+		JSON(w, http.StatusCreated, map[string]interface{}{"message": "Subscription created, pay to confirm it", "subscription": sub})
+		return
+	}
+	notifyNewRequest(&booking, &item)
+
+	JSON(w, http.StatusCreated, map[string]interface{}{"message": "Subscription requested", "subscription": sub})
+}
+
+// populateSubscription attaches a summary of the item and the renter's
+// public profile to a subscription for API responses
+func populateSubscription(ctx context.Context, sub *Subscription) {
+	var item Item
+	if err := GetCollection("items").FindOne(ctx, bson.M{"_id": sub.ItemID}).Decode(&item); err == nil {
+		sub.Item = &Item{
+			ID: item.ID, Title: item.Title, Images: item.Images, Price: item.Price,
+			MonthlyPrice: item.MonthlyPrice, Category: item.Category, Location: item.Location,
+		}
+	}
+
+	var renter User
+	if err := GetCollection("users").FindOne(ctx, bson.M{"_id": sub.RenterID}).Decode(&renter); err == nil {
+		sub.Renter = &User{
+			ID: renter.ID, Name: renter.Name, Avatar: renter.Avatar,
+			Rating: renter.Rating, TotalRatings: renter.TotalRatings,
+		}
+	}
+}
+
+// findSubscriptions loads the subscriptions matching filter, newest first
+func findSubscriptions(ctx context.Context, filter bson.M) []Subscription {
+	subs := []Subscription{}
+	cursor, err := GetCollection("subscriptions").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return subs
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var sub Subscription
+		if err := cursor.Decode(&sub); err != nil {
+			continue
+		}
+		populateSubscription(ctx, &sub)
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+func getMySubscriptions(w http.ResponseWriter, r *http.Request) {
+	userID, _ := GetUserID(r)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	subs := findSubscriptions(ctx, bson.M{"renterId": userID})
+	JSON(w, http.StatusOK, map[string]interface{}{"subscriptions": subs, "total": len(subs)})
+}
+
+// findSubscriptionForUser loads a subscription and works out whether userID
+// is its renter or owner. It writes the error response itself and returns
+// nil if they are neither.
+func findSubscriptionForUser(ctx context.Context, w http.ResponseWriter, id string, userID primitive.ObjectID) (*Subscription, string) {
+	subID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid subscription ID")
+		return nil, ""
+	}
+
+	var sub Subscription
+	if err := GetCollection("subscriptions").FindOne(ctx, bson.M{"_id": subID}).Decode(&sub); err != nil {
+		JSONError(w, http.StatusNotFound, "Subscription not found")
+		return nil, ""
+	}
+	switch userID {
+	case sub.RenterID:
+		return &sub, RoleRenter
+	case sub.OwnerID:
+		return &sub, RoleOwner
+	}
+	JSONError(w, http.StatusForbidden, "Access denied")
+	return nil, ""
+}
+
+// subscriptionBookings loads the bookings of a subscription, one per cycle
+func subscriptionBookings(ctx context.Context, subID primitive.ObjectID) []Booking {
+	bookings := []Booking{}
+	cursor, err := GetCollection("bookings").Find(ctx, bson.M{"subscriptionId": subID}, options.Find().SetSort(bson.D{{Key: "cycle", Value: 1}}))
+	if err != nil {
+		return bookings
+	}
+	defer cursor.Close(ctx)
+	cursor.All(ctx, &bookings)
+	return bookings
+}
+
+// contractBooking loads the first-cycle booking of a subscription
+func contractBooking(ctx context.Context, subID primitive.ObjectID) (*Booking, error) {
+	var booking Booking
+	if err := GetCollection("bookings").FindOne(ctx, bson.M{"subscriptionId": subID, "cycle": 1}).Decode(&booking); err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+func getSubscription(w http.ResponseWriter, r *http.Request, id string) {
+	userID, _ := GetUserID(r)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sub, _ := findSubscriptionForUser(ctx, w, id, userID)
+	if sub == nil {
+		return
+	}
+	populateSubscription(ctx, sub)
+	sub.Bookings = subscriptionBookings(ctx, sub.ID)
+
+	JSON(w, http.StatusOK, map[string]interface{}{"subscription": sub})
+}
+
+// noticeEndDate is when a subscription given notice at now ends: the first
+// cycle boundary after the notice period, and never before the cycles
+// already paid for run out
+func noticeEndDate(sub *Subscription, now time.Time) time.Time {
+	earliest := now.AddDate(0, 0, sub.NoticeDays)
+	if sub.PaidThrough.After(earliest) {
+		earliest = sub.PaidThrough
+	}
+	n := 1
+	for sub.cycleEnd(n).Before(earliest) {
+		n++
+	}
+	return sub.cycleEnd(n)
+}
+
+// cancelSubscription lets either side end a subscription. Before it starts,
+// that cancels the contract booking. Once running, it gives notice: the
+// subscription ends at the first cycle boundary after the notice period.
+func cancelSubscription(w http.ResponseWriter, r *http.Request, id string) {
+	userID, _ := GetUserID(r)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sub, role := findSubscriptionForUser(ctx, w, id, userID)
+	if sub == nil {
+		return
+	}
+	other := sub.OwnerID
+	if role == RoleOwner {
+		other = sub.RenterID
+	}
+
+	contract, err := contractBooking(ctx, sub.ID)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to load subscription booking")
+		return
+	}
+
+	switch sub.Status {
+	case SubscriptionPending:
+		// The status hook cancels the subscription with its booking
+		if err := transitionBooking(ctx, contract, StatusCancelled, role, userID, "Subscription cancelled", nil); err != nil {
+			var te *transitionError
+			if errors.As(err, &te) {
+				JSONError(w, te.Code, te.Message)
+				return
+			}
+			JSONError(w, http.StatusInternalServerError, "Failed to cancel subscription")
+			return
+		}
+		notifyBookingStatus(ctx, contract, other)
+		JSON(w, http.StatusOK, map[string]interface{}{"message": "Subscription cancelled", "refund": contract.Refund})
+		return
+	case SubscriptionActive:
+	case SubscriptionEnding:
+		JSONError(w, http.StatusConflict, "Notice has already been given on this subscription")
+		return
+	default:
+		JSONError(w, http.StatusConflict, "A "+sub.Status+" subscription can't be cancelled")
+		return
+	}
+
+	now := time.Now()
+	endDate := noticeEndDate(sub, now)
+	notice := SubscriptionNotice{By: userID, Role: role, GivenAt: now}
+	result, err := GetCollection("subscriptions").UpdateOne(ctx,
+		bson.M{"_id": sub.ID, "status": SubscriptionActive},
+		bson.M{"$set": bson.M{"status": SubscriptionEnding, "endDate": endDate, "notice": notice, "updatedAt": now}},
+	)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to cancel subscription")
+		return
+	}
+	if result.MatchedCount == 0 {
+		JSONError(w, http.StatusConflict, "Subscription status has changed, please refresh")
+		return
+	}
+	sub.Status = SubscriptionEnding
+	sub.EndDate = &endDate
+	sub.Notice = &notice
+
+	// A renewal already billed for after the end date isn't owed
+	cursor, err := GetCollection("bookings").Find(ctx, bson.M{
+		"subscriptionId": sub.ID,
+		"cycle":          bson.M{"$gt": 1},
+		"status":         StatusPending,
+		"startDate":      bson.M{"$gte": endDate},
+	})
+	if err == nil {
+		var renewals []Booking
+		cursor.All(ctx, &renewals)
+		for i := range renewals {
+			if err := transitionBooking(ctx, &renewals[i], StatusCancelled, role, userID, "Subscription ended", nil); err != nil {
+				log.Printf("Could not cancel renewal %s: %v", renewals[i].ID.Hex(), err)
+			}
+		}
+	}
+
+	notifyBookingEvent(ctx, contract, other, "subscription_ending")
+	JSON(w, http.StatusOK, map[string]interface{}{"message": "Notice given", "subscription": sub})
+}
+
+// saveSubscriptionMandate keeps the payment method the contract booking was
+// paid with, so renewals can be charged to it
+func saveSubscriptionMandate(ctx context.Context, subID primitive.ObjectID, mandate string) {
+	_, err := GetCollection("subscriptions").UpdateOne(ctx, bson.M{"_id": subID}, bson.M{"$set": bson.M{
+		"mandate":   mandate,
+		"updatedAt": time.Now(),
+	}})
+	if err != nil {
+		log.Printf("Could not save mandate of subscription %s: %v", subID.Hex(), err)
+	}
+}
+
+// subscriptionBookingChanged keeps a subscription in step with its bookings
+// after one of them moves to status to. The contract booking starts and
+// ends the subscription. A paid renewal extends the contract booking, and
+// one that goes unpaid ends the subscription when the paid cycles run out.
+func subscriptionBookingChanged(ctx context.Context, booking *Booking, to string) {
+	subs := GetCollection("subscriptions")
+	id := *booking.SubscriptionID
+	now := time.Now()
+
+	if booking.Cycle <= 1 {
+		var err error
+		switch to {
+		case StatusConfirmed:
+			_, err = subs.UpdateOne(ctx,
+				bson.M{"_id": id, "status": SubscriptionPending},
+				bson.M{"$set": bson.M{"status": SubscriptionActive, "updatedAt": now}},
+			)
+		case StatusRejected, StatusCancelled, StatusExpired:
+			_, err = subs.UpdateOne(ctx,
+				bson.M{"_id": id, "status": bson.M{"$in": liveSubscriptionStatuses}},
+				bson.M{"$set": bson.M{"status": SubscriptionCancelled, "updatedAt": now}},
+			)
+		case StatusReturned, StatusCompleted:
+			_, err = subs.UpdateOne(ctx,
+				bson.M{"_id": id, "status": bson.M{"$in": liveSubscriptionStatuses}},
+				bson.M{"$set": bson.M{"status": SubscriptionEnded, "updatedAt": now}},
+			)
+		}
+		if err != nil {
+			log.Printf("Could not update subscription %s: %v", id.Hex(), err)
+		}
+		return
+	}
+
+	switch to {
+	case StatusConfirmed:
+		_, err := subs.UpdateOne(ctx,
+			bson.M{"_id": id, "paidThrough": bson.M{"$lt": booking.EndDate}},
+			bson.M{"$set": bson.M{"paidThrough": booking.EndDate, "updatedAt": now}},
+		)
+		if err != nil {
+			log.Printf("Could not extend subscription %s: %v", id.Hex(), err)
+			return
+		}
+		contract, err := contractBooking(ctx, id)
+		if err != nil {
+			return
+		}
+		if (contract.Status == StatusConfirmed || contract.Status == StatusHandedOver) && contract.EndDate.Before(booking.EndDate) {
+			GetCollection("bookings").UpdateOne(ctx,
+				bson.M{"_id": contract.ID, "status": bson.M{"$in": []string{StatusConfirmed, StatusHandedOver}}},
+				bson.M{"$set": bson.M{"endDate": booking.EndDate, "updatedAt": now}},
+			)
+		}
+		notifyBookingEvent(ctx, booking, booking.RenterID, "subscription_renewed")
+		notifyBookingEvent(ctx, booking, booking.OwnerID, "subscription_renewed")
+
+	case StatusExpired, StatusCancelled:
+		result, err := subs.UpdateOne(ctx,
+			bson.M{
+				"_id":    id,
+				"status": bson.M{"$in": []string{SubscriptionActive, SubscriptionEnding}},
+				"$or": []bson.M{
+					{"endDate": bson.M{"$exists": false}},
+					{"endDate": bson.M{"$gt": booking.StartDate}},
+				},
+			},
+			bson.M{"$set": bson.M{"status": SubscriptionEnding, "endDate": booking.StartDate, "updatedAt": now}},
+		)
+		if err != nil {
+			log.Printf("Could not end subscription %s: %v", id.Hex(), err)
+			return
+		}
+		if result.ModifiedCount > 0 {
+			notifyBookingEvent(ctx, booking, booking.RenterID, "subscription_lapsed")
+			notifyBookingEvent(ctx, booking, booking.OwnerID, "subscription_lapsed")
+		}
+	}
+}
+
+// renewSubscriptions bills the next cycle of running subscriptions whose
+// current cycle ends within the renewal lead time
+func renewSubscriptions(ctx context.Context) error {
+	cursor, err := GetCollection("subscriptions").Find(ctx, bson.M{
+		"status":    bson.M{"$in": []string{SubscriptionActive, SubscriptionEnding}},
+		"periodEnd": bson.M{"$lte": time.Now().Add(subscriptionRenewalLead())},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var sub Subscription
+		if err := cursor.Decode(&sub); err != nil {
+			log.Printf("Error decoding subscription: %v", err)
+			continue
+		}
+		// Notice given; the last cycle has been billed
+		if sub.EndDate != nil && !sub.PeriodEnd.Before(*sub.EndDate) {
+			continue
+		}
+		if err := renewSubscription(ctx, &sub); err != nil {
+			log.Printf("Could not renew subscription %s: %v", sub.ID.Hex(), err)
+			continue
+		}
+		count++
+	}
+
+	if count > 0 {
+		log.Printf("Renewed %d subscriptions", count)
+	}
+	return cursor.Err()
+}
+
+// renewSubscription creates the booking for the next cycle of sub and
+// charges it to the saved payment method. Without one, or if the charge
+// fails, the renter is asked to pay it themselves before the cycle starts.
+func renewSubscription(ctx context.Context, sub *Subscription) error {
+	var item Item
+	if err := GetCollection("items").FindOne(ctx, bson.M{"_id": sub.ItemID}).Decode(&item); err != nil {
+		return err
+	}
+	cycle := sub.Cycles + 1
+	quote, err := subscriptionQuote(&item, sub, cycle)
+	if err != nil {
+		return err
+	}
+
+	// Claim the cycle so overlapping runs don't bill it twice
+	subs := GetCollection("subscriptions")
+	result, err := subs.UpdateOne(ctx,
+		bson.M{"_id": sub.ID, "cycles": sub.Cycles},
+		bson.M{"$set": bson.M{"periodEnd": sub.cycleEnd(cycle), "updatedAt": time.Now()}, "$inc": bson.M{"cycles": 1}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return nil
+	}
+
+	booking := newBooking(ctx, &item, sub.RenterID, quote)
+	booking.SubscriptionID = &sub.ID
+	booking.Cycle = cycle
+	booking.AutoConfirm = true
+	booking.RespondBy = nil
+	booking.Deposit = nil
+	booking.StatusHistory = []StatusChange{{To: StatusPending, Role: RoleSystem, Reason: "Subscription renewal", At: booking.CreatedAt}}
+	booking.PickupAddress = sub.PickupAddress
+	booking.DropAddress = sub.DropAddress
+	if err := insertBooking(ctx, &booking); err != nil {
+		subs.UpdateOne(ctx,
+			bson.M{"_id": sub.ID, "cycles": cycle},
+			bson.M{"$set": bson.M{"periodEnd": sub.PeriodEnd}, "$inc": bson.M{"cycles": -1}},
+		)
+		return err
+	}
+
+	if sub.Mandate == "" {
+		notifyBookingEvent(ctx, &booking, booking.RenterID, "subscription_payment_due")
+		return nil
+	}
+	order, err := paymentProvider().ChargeRecurring(ctx, sub.Mandate, OrderRequest{
+		Amount:   amountDue(&booking),
+		Currency: "INR",
+		Receipt:  booking.TrackingID,
+		Notes:    map[string]string{"bookingId": booking.ID.Hex(), "subscriptionId": sub.ID.Hex()},
+	})
+	if err != nil {
+		log.Printf("Could not charge renewal %s: %v", booking.ID.Hex(), err)
+		notifyBookingEvent(ctx, &booking, booking.RenterID, "subscription_payment_due")
+		return nil
+	}
+	_, err = GetCollection("bookings").UpdateOne(ctx, bson.M{"_id": booking.ID}, bson.M{
+		"$set": bson.M{
+			"payment.provider": order.Provider,
+			"payment.orderId":  order.ID,
+			"payment.amount":   order.Amount,
+			"updatedAt":        time.Now(),
+		},
+		"$addToSet": bson.M{"payment.orderIds": order.ID},
+	})
+	return err
+}
+
+// endSubscriptions closes subscriptions whose notice period has run out.
+// The renter returns the item on the contract booking, which ends with the
+// last paid cycle.
+func endSubscriptions(ctx context.Context) error {
+	now := time.Now()
+	cursor, err := GetCollection("subscriptions").Find(ctx, bson.M{
+		"status":  SubscriptionEnding,
+		"endDate": bson.M{"$lte": now},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var sub Subscription
+		if err := cursor.Decode(&sub); err != nil {
+			log.Printf("Error decoding subscription: %v", err)
+			continue
+		}
+		result, err := GetCollection("subscriptions").UpdateOne(ctx,
+			bson.M{"_id": sub.ID, "status": SubscriptionEnding},
+			bson.M{"$set": bson.M{"status": SubscriptionEnded, "updatedAt": now}},
+		)
+		if err != nil || result.ModifiedCount == 0 {
+			continue
+		}
+		if contract, err := contractBooking(ctx, sub.ID); err == nil {
+			notifyBookingEvent(ctx, contract, sub.RenterID, "subscription_ended")
+			notifyBookingEvent(ctx, contract, sub.OwnerID, "subscription_ended")
+		}
+		count++
+	}
+
+	if count > 0 {
+		log.Printf("Ended %d subscriptions", count)
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,34 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNoticeEndDate(t *testing.T) {
+	date := func(m time.Month, d int) time.Time { return time.Date(2025, m, d, 10, 0, 0, 0, time.UTC) }
+	sub := func(noticeDays int, paidThrough time.Time) *Subscription {
+		return &Subscription{StartDate: date(time.January, 5), NoticeDays: noticeDays, PaidThrough: paidThrough}
+	}
+
+	tests := []struct {
+		name string
+		sub  *Subscription
+		now  time.Time
+		want time.Time
+	}{
+		{"notice ends within the paid month", sub(7, date(time.February, 5)), date(time.January, 10), date(time.February, 5)},
+		{"notice runs past the paid month", sub(30, date(time.February, 5)), date(time.January, 20), date(time.March, 5)},
+		{"notice ending on a boundary", sub(10, date(time.February, 5)), date(time.January, 26), date(time.February, 5)},
+		{"paid months run past the notice", sub(7, date(time.April, 5)), date(time.January, 10), date(time.April, 5)},
+		{"no notice period", sub(0, date(time.March, 5)), date(time.March, 5), date(time.March, 5)},
+		{"long notice", sub(90, date(time.February, 5)), date(time.January, 10), date(time.May, 5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := noticeEndDate(tt.sub, tt.now); !got.Equal(tt.want) {
+				t.Errorf("noticeEndDate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// maxSuggestions caps the suggestions of each kind
+	maxSuggestions = 5
+
+	// maxPrefixLength is the longest query prefix stored for lookups;
+	// longer input is looked up by its first maxPrefixLength characters
+	maxPrefixLength = 20
+
+	// minQuerySearchers is how many different people have to have searched
+	// a query before it is suggested to others
+	minQuerySearchers = 5
+
+	// searchQueryRetentionDays is how long a query is kept after it was
+	// last searched for
+	searchQueryRetentionDays = 90
+
+	// suggestionIndexTTL is how long the taxonomy index is used before it
+	// is rebuilt, so categories changed in the database show up
+	suggestionIndexTTL = 5 * time.Minute
+)
+
+// Kinds of taxonomy suggestions
+const (
+	SuggestCategory = "category"
+	SuggestBrand    = "brand"
+	SuggestModel    = "model"
+)
+
+// Suggestion is a category, brand or model matching what the user typed,
+// with the search filters that select it
+type Suggestion struct {
+	Text        string `json:"text"`
+	Kind        string `json:"-"`
+	Category    string `json:"category"`
+	SubCategory string `json:"subCategory,omitempty"`
+	Brand       string `json:"brand,omitempty"`
+	Model       string `json:"model,omitempty"`
+}
+
+// QuerySuggestion is a popular search starting with what the user typed,
+// with how many people searched for it
+type QuerySuggestion struct {
+	Text  string `json:"text" bson:"_id"`
+	Count int64  `json:"count" bson:"count"`
+}
+
+// prefixKey is a lower-case string a suggestion can be found by
+type prefixKey struct {
+	Key   string
+	Entry int
+	Start bool // the key is the start of the suggestion's text, not a later word
+}
+
+// suggestionIndex finds taxonomy suggestions by prefix: its keys are each
+// suggestion's words from every word on, sorted, so the keys starting with
+// a prefix are next to each other
+type suggestionIndex struct {
+	Entries []Suggestion
+	Keys    []prefixKey
+}
+
+var suggestionCache struct {
+	sync.Mutex
+	index   *suggestionIndex
+	builtAt time.Time
+}
+
+// isCatchAll reports whether an option is a placeholder such as "Other
+// Brands", which isn't worth suggesting
+func isCatchAll(name string) bool {
+	return strings.EqualFold(name, "Others") || strings.HasPrefix(strings.ToLower(name), "other")
+}
+
+// buildSuggestionIndex indexes the categories, sub-categories, options and
+// models of the taxonomy. Options of sub-categories labelled "Brand" are
+// brands; others, such as types, are suggested as categories.
+func buildSuggestionIndex(categories []Category) *suggestionIndex {
+	index := &suggestionIndex{}
+	add := func(s Suggestion) {
+		words := searchWords(s.Text)
+		for i := range words {
+			index.Keys = append(index.Keys, prefixKey{Key: strings.Join(words[i:], " "), Entry: len(index.Entries), Start: i == 0})
+		}
+		index.Entries = append(index.Entries, s)
+	}
+
+	for _, c := range categories {
+		add(Suggestion{Text: c.Name, Kind: SuggestCategory, Category: c.Name})
+		for _, sub := range c.SubCategories {
+			add(Suggestion{Text: sub.Name, Kind: SuggestCategory, Category: c.Name, SubCategory: sub.Name})
+			for _, opt := range sub.Options {
+				if isCatchAll(opt.Name) {
+					continue
+				}
+				kind := SuggestCategory
+				if strings.EqualFold(sub.Label, "Brand") {
+					kind = SuggestBrand
+				}
+				add(Suggestion{Text: opt.Name, Kind: kind, Category: c.Name, SubCategory: sub.Name, Brand: opt.Name})
+				for _, model := range opt.Options {
+					if isCatchAll(model) {
+						continue
+					}
+					add(Suggestion{Text: model, Kind: SuggestModel, Category: c.Name, SubCategory: sub.Name, Brand: opt.Name, Model: model})
+				}
+			}
+		}
+	}
+
+	sort.Slice(index.Keys, func(i, j int) bool { return index.Keys[i].Key < index.Keys[j].Key })
+	return index
+}
+
+// lookup returns up to limit suggestions of each kind with a word starting
+// with prefix. Suggestions starting with it come first, then categories
+// and sub-categories, then shorter ones.
+func (index *suggestionIndex) lookup(prefix string, limit int) map[string][]Suggestion {
+	from := sort.Search(len(index.Keys), func(i int) bool { return index.Keys[i].Key >= prefix })
+	var matches []prefixKey
+	seen := map[int]int{} // entry to its position in matches
+	for _, k := range index.Keys[from:] {
+		if !strings.HasPrefix(k.Key, prefix) {
+			break
+		}
+		if i, ok := seen[k.Entry]; ok {
+			matches[i].Start = matches[i].Start || k.Start
+			continue
+		}
+		seen[k.Entry] = len(matches)
+		matches = append(matches, k)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Start != b.Start {
+			return a.Start
+		}
+		ea, eb := index.Entries[a.Entry], index.Entries[b.Entry]
+		if (ea.Brand == "") != (eb.Brand == "") {
+			return ea.Brand == ""
+		}
+		ta, tb := ea.Text, eb.Text
+		if len(ta) != len(tb) {
+			return len(ta) < len(tb)
+		}
+		return ta < tb
+	})
+
+	results := map[string][]Suggestion{SuggestCategory: {}, SuggestBrand: {}, SuggestModel: {}}
+	for _, m := range matches {
+		s := index.Entries[m.Entry]
+		if len(results[s.Kind]) < limit {
+			results[s.Kind] = append(results[s.Kind], s)
+		}
+	}
+	return results
+}
+
+// taxonomySuggestions returns the suggestion index, rebuilding it from the
+// categories collection once it is older than suggestionIndexTTL
+func taxonomySuggestions(ctx context.Context) (*suggestionIndex, error) {
+	suggestionCache.Lock()
+	defer suggestionCache.Unlock()
+
+	if suggestionCache.index != nil && time.Since(suggestionCache.builtAt) < suggestionIndexTTL {
+		return suggestionCache.index, nil
+	}
+
+	cursor, err := GetCollection("categories").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var categories []Category
+	if err := cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+
+	suggestionCache.index = buildSuggestionIndex(categories)
+	suggestionCache.builtAt = time.Now()
+	return suggestionCache.index, nil
+}
+
+// queryPrefixes returns the prefixes a query is looked up by: those of the
+// query from each of its words on, up to maxPrefixLength characters
+func queryPrefixes(words []string) []string {
+	seen := map[string]bool{}
+	var prefixes []string
+	for i := range words {
+		rest := []rune(strings.Join(words[i:], " "))
+		for n := 1; n <= len(rest) && n <= maxPrefixLength; n++ {
+			p := string(rest[:n])
+			if rest[n-1] == ' ' || seen[p] {
+				continue
+			}
+			seen[p] = true
+			prefixes = append(prefixes, p)
+		}
+	}
+	return prefixes
+}
+
+// searcherKey identifies who made a request, for counting each person once:
+// the signed-in user, or a hash of the client's address for everyone else
+func searcherKey(r *http.Request) string {
+	if userID, ok := OptionalUserID(r); ok {
+		return "user:" + userID
+	}
+	// Behind a proxy, the client is the address the proxy appended last.
+	// Earlier entries come from the client and can be made up.
+	addr := ""
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(forwarded[len(forwarded)-1], ",")
+		addr = strings.TrimSpace(hops[len(hops)-1])
+	}
+	if addr == "" {
+		addr = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+	}
+	sum := sha256.Sum256([]byte(addr))
+	return "ip:" + hex.EncodeToString(sum[:8])
+}
+
+// recordSearch counts a search that found items, for suggesting it to
+// others. Queries are stored as their lower-case words joined by spaces, and
+// counted once per searcher, so repeating a search doesn't make it popular.
+// Misspelled searches, answered by the trigram fallback, aren't recorded,
+// so they aren't suggested.
+func recordSearch(q *textQuery, searcher string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := strings.Join(q.Words, " ")
+	now := time.Now()
+	inc := 1
+	_, err := GetCollection("search_query_searchers").InsertOne(ctx, bson.M{
+		"_id":        bson.M{"query": query, "searcher": searcher},
+		"searchedAt": now,
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		inc = 0
+	} else if err != nil {
+		log.Printf("Error recording searcher of %q: %v", query, err)
+		return
+	}
+
+	_, err = GetCollection("search_queries").UpdateOne(ctx,
+		bson.M{"_id": query},
+		bson.M{
+			"$inc":         bson.M{"count": inc},
+			"$set":         bson.M{"lastSearchedAt": now},
+			"$setOnInsert": bson.M{"prefixes": queryPrefixes(q.Words), "firstSearchedAt": now},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("Error recording search %q: %v", query, err)
+	}
+}
+
+// popularQueries returns the most searched queries with a word starting
+// with prefix
+func popularQueries(ctx context.Context, prefix string, limit int) ([]QuerySuggestion, error) {
+	key := prefix
+	if runes := []rune(prefix); len(runes) > maxPrefixLength {
+		key = string(runes[:maxPrefixLength])
+	}
+
+	// Input longer than the stored prefixes is matched here instead; fetch
+	// extra to have enough left
+	fetch := int64(limit)
+	if key != prefix {
+		fetch *= 4
+	}
+	cursor, err := GetCollection("search_queries").Find(ctx,
+		bson.M{"prefixes": key, "count": bson.M{"$gte": minQuerySearchers}},
+		options.Find().
+			SetProjection(bson.M{"count": 1}).
+			SetSort(bson.D{{Key: "count", Value: -1}, {Key: "lastSearchedAt", Value: -1}}).
+			SetLimit(fetch))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var found []QuerySuggestion
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	queries := []QuerySuggestion{}
+	for _, q := range found {
+		if len(queries) == limit {
+			break
+		}
+		if key == prefix || strings.HasPrefix(q.Text, prefix) || strings.Contains(q.Text, " "+prefix) {
+			queries = append(queries, q)
+		}
+	}
+	return queries, nil
+}
+
+// HandleSearchSuggest suggests categories, brands, models and popular
+// searches for what the user has typed so far
+func HandleSearchSuggest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	q := parseTextQuery(r.URL.Query().Get("q"))
+	if q == nil {
+		JSON(w, http.StatusOK, map[string]interface{}{
+			"categories": []Suggestion{},
+			"brands":     []Suggestion{},
+			"models":     []Suggestion{},
+			"queries":    []QuerySuggestion{},
+		})
+		return
+	}
+	prefix := strings.Join(q.Words, " ")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	index, err := taxonomySuggestions(ctx)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to load categories")
+		return
+	}
+	taxonomy := index.lookup(prefix, maxSuggestions)
+
+	queries, err := popularQueries(ctx, prefix, maxSuggestions)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to fetch suggestions")
+		return
+	}
+
+	JSON(w, http.StatusOK, map[string]interface{}{
+		"categories": taxonomy[SuggestCategory],
+		"brands":     taxonomy[SuggestBrand],
+		"models":     taxonomy[SuggestModel],
+		"queries":    queries,
+	})
+}
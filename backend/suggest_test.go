@@ -0,0 +1,102 @@
+package backend
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestSuggestionIndexLookup(t *testing.T) {
+	index := buildSuggestionIndex([]Category{
+		{Name: "Mobiles", SubCategories: []SubCategory{{
+			Name: "Mobile Phones", Label: "Brand",
+			Options: []CategoryOption{
+				{Name: "Apple", Label: "Model", Options: []string{"iPhone 15 Pro", "iPhone 11", "Other Models"}},
+				{Name: "Samsung", Label: "Model", Options: []string{"Galaxy S23"}},
+				{Name: "Other Brands"},
+			},
+		}}},
+		{Name: "Electronics", SubCategories: []SubCategory{{
+			Name: "Projectors", Label: "Type",
+			Options: []CategoryOption{{Name: "Portable Projector"}, {Name: "Others"}},
+		}}},
+	})
+
+	tests := []struct {
+		prefix                     string
+		limit                      int
+		categories, brands, models []string
+	}{
+		{"ip", 5, nil, nil, []string{"iPhone 11", "iPhone 15 Pro"}},
+		{"i", 1, nil, nil, []string{"iPhone 11"}},
+		{"mobile", 5, []string{"Mobiles", "Mobile Phones"}, nil, nil},
+		{"phones", 5, []string{"Mobile Phones"}, nil, nil},
+		{"pro", 5, []string{"Projectors", "Portable Projector"}, nil, []string{"iPhone 15 Pro"}},
+		{"s", 5, nil, []string{"Samsung"}, []string{"Galaxy S23"}},
+		{"galaxy s", 5, nil, nil, []string{"Galaxy S23"}},
+		{"other", 5, nil, nil, nil},
+		{"xyz", 5, nil, nil, nil},
+	}
+	texts := func(suggestions []Suggestion) []string {
+		var out []string
+		for _, s := range suggestions {
+			out = append(out, s.Text)
+		}
+		return out
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			got := index.lookup(tt.prefix, tt.limit)
+			if c := texts(got[SuggestCategory]); !reflect.DeepEqual(c, tt.categories) {
+				t.Errorf("categories = %q, want %q", c, tt.categories)
+			}
+			if b := texts(got[SuggestBrand]); !reflect.DeepEqual(b, tt.brands) {
+				t.Errorf("brands = %q, want %q", b, tt.brands)
+			}
+			if m := texts(got[SuggestModel]); !reflect.DeepEqual(m, tt.models) {
+				t.Errorf("models = %q, want %q", m, tt.models)
+			}
+		})
+	}
+
+	// Suggestions carry the filters that select them
+	got := index.lookup("galaxy", 5)[SuggestModel]
+	want := []Suggestion{{Text: "Galaxy S23", Kind: SuggestModel, Category: "Mobiles", SubCategory: "Mobile Phones", Brand: "Samsung", Model: "Galaxy S23"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lookup(\"galaxy\") models = %+v, want %+v", got, want)
+	}
+}
+
+func TestSearcherKey(t *testing.T) {
+	ip := func(addr string) string {
+		return searcherKey(&http.Request{RemoteAddr: addr + ":4000", Header: http.Header{}})
+	}
+
+	tests := []struct {
+		name      string
+		forwarded []string
+		want      string
+	}{
+		{"no proxy", nil, ip("10.0.0.1")},
+		{"one hop", []string{"203.0.113.7"}, ip("203.0.113.7")},
+		{"made up entries are ignored", []string{"198.51.100.1, 203.0.113.7"}, ip("203.0.113.7")},
+		{"spaces", []string{"198.51.100.1 ,  203.0.113.7 "}, ip("203.0.113.7")},
+		{"several headers", []string{"198.51.100.1", "203.0.113.7"}, ip("203.0.113.7")},
+		{"empty header", []string{""}, ip("10.0.0.1")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{RemoteAddr: "10.0.0.1:5000", Header: http.Header{}}
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := searcherKey(r); got != tt.want {
+				t.Errorf("searcherKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if ip("10.0.0.1") == ip("10.0.0.2") {
+		t.Error("different addresses share a key")
+	}
+}
@@ -0,0 +1,140 @@
+package backend
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// UserRoleSupport marks support staff, who can look up any booking
+const UserRoleSupport = "support"
+
+const (
+	trackingIDCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	trackingIDLength  = 8
+
+	// maxTrackingIDAttempts is how many tracking IDs are tried before giving
+	// up on an insert. Collisions are rare, so more than one retry means
+	// something else is wrong.
+	maxTrackingIDAttempts = 5
+)
+
+// generateTrackingID creates an 8-character alphanumeric tracking ID
+func generateTrackingID() string {
+	max := big.NewInt(int64(len(trackingIDCharset)))
+	result := make([]byte, trackingIDLength)
+	for i := range result {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		result[i] = trackingIDCharset[n.Int64()]
+	}
+	return string(result)
+}
+
+// insertBooking inserts a booking, picking a new tracking ID if the unique
+// index reports the one it has is taken
+func insertBooking(ctx context.Context, booking *Booking) error {
+	var err error
+	for attempt := 0; attempt < maxTrackingIDAttempts; attempt++ {
+		if attempt > 0 || booking.TrackingID == "" {
+			booking.TrackingID = generateTrackingID()
+		}
+		_, err = GetCollection("bookings").InsertOne(ctx, booking)
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// reassignDuplicateTrackingIDs gives a fresh tracking ID to every booking
+// but the oldest that shares one, so the unique index can be built over
+// bookings created before it existed
+func reassignDuplicateTrackingIDs(ctx context.Context) error {
+	cursor, err := GetCollection("bookings").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sort", Value: bson.M{"createdAt": 1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$trackingId",
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var group struct {
+			TrackingID string        `bson:"_id"`
+			IDs        []interface{} `bson:"ids"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return err
+		}
+		for _, id := range group.IDs[1:] {
+			newID := generateTrackingID()
+			if _, err := GetCollection("bookings").UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"trackingId": newID}}); err != nil {
+				return err
+			}
+			log.Printf("Booking %v shared tracking ID %s, reassigned %s", id, group.TrackingID, newID)
+		}
+	}
+	return cursor.Err()
+}
+
+// HandleBookingTrack serves GET /api/bookings/track/{trackingId}, which finds
+// a booking by the code shown in the app and on receipts. Only the renter,
+// the owner and support staff can see it.
+func HandleBookingTrack(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		JSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	trackingID := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/api/bookings/track/")))
+	if len(trackingID) != trackingIDLength {
+		JSONError(w, http.StatusBadRequest, "Invalid tracking ID")
+		return
+	}
+
+	userID, _ := GetUserID(r)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var booking Booking
+	err := GetCollection("bookings").FindOne(ctx, bson.M{"trackingId": trackingID}).Decode(&booking)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		JSONError(w, http.StatusNotFound, "Booking not found")
+		return
+	}
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to find booking")
+		return
+	}
+
+	if bookingRole(&booking, userID) == "" {
+		var user User
+		GetCollection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+		if user.Role != UserRoleSupport {
+			// Same as a missing booking, so tracking IDs can't be probed
+			JSONError(w, http.StatusNotFound, "Booking not found")
+			return
+		}
+	}
+
+	populateBooking(ctx, &booking)
+
+	JSON(w, http.StatusOK, map[string]interface{}{"booking": booking})
+}
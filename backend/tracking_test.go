@@ -0,0 +1,49 @@
+package backend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGenerateTrackingID(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		id := generateTrackingID()
+		if len(id) != trackingIDLength {
+			t.Fatalf("generateTrackingID() = %q, want %d characters", id, trackingIDLength)
+		}
+		if strings.Trim(id, trackingIDCharset) != "" {
+			t.Fatalf("generateTrackingID() = %q, want only %s", id, trackingIDCharset)
+		}
+		if seen[id] {
+			t.Fatalf("generateTrackingID() repeated %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestHandleBookingTrackRejects(t *testing.T) {
+	// Requests turned away before the booking is looked up
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{"wrong method", http.MethodPost, "/api/bookings/track/AB12CD34", http.StatusMethodNotAllowed},
+		{"too short", http.MethodGet, "/api/bookings/track/AB12", http.StatusBadRequest},
+		{"too long", http.MethodGet, "/api/bookings/track/AB12CD3456", http.StatusBadRequest},
+		{"missing", http.MethodGet, "/api/bookings/track/", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			HandleBookingTrack(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.want {
+				t.Errorf("HandleBookingTrack() status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package backend
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
@@ -34,6 +35,7 @@ func getUser(w http.ResponseWriter, r *http.Request, id string) {
 		JSONError(w, http.StatusNotFound, "User not found")
 		return
 	}
+	responseMinutes, acceptanceRate := ownerResponseStats(ctx, userID)
 
 	JSON(w, http.StatusOK, map[string]interface{}{
 		"user": map[string]interface{}{
@@ -47,30 +49,72 @@ func getUser(w http.ResponseWriter, r *http.Request, id string) {
 			"totalBookings": func() int64 {
 				count, _ := GetCollection("bookings").CountDocuments(ctx, bson.M{
 					"renterId": userID,
-					"status":   bson.M{"$in": []string{"confirmed", "ongoing", "completed", "expired"}},
+					"status":   bson.M{"$in": []string{StatusConfirmed, StatusHandedOver, StatusReturned, StatusCompleted}},
 				})
 				return count
 			}(),
+			"reliabilityScore":      ownerReliabilityScore(ctx, userID),
+			"medianResponseMinutes": responseMinutes,
+			"acceptanceRate":        acceptanceRate,
 		},
 	})
 }
 
+// editableProfileFields are the user fields a user may change on their own
+// profile. Everything else, such as role, ratings and ID verification, is
+// set by the server; other keys in the request are ignored. The driver maps
+// keys to fields ignoring case, so only these exact keys are copied.
+var editableProfileFields = []string{"name", "phone", "avatar", "location", "gstin"}
+
+// profileUpdate returns the fields of a profile update request to set,
+// trimmed, or an error naming the first value that isn't valid
+func profileUpdate(body map[string]interface{}) (bson.M, error) {
+	updateData := bson.M{}
+	for _, field := range editableProfileFields {
+		raw, ok := body[field]
+		if !ok {
+			continue
+		}
+		value, isString := raw.(string)
+		if !isString && raw != nil {
+			return nil, errors.New(field + " must be a string")
+		}
+		updateData[field] = strings.TrimSpace(value)
+	}
+	if gstin, ok := updateData["gstin"].(string); ok {
+		gstin = strings.ToUpper(gstin)
+		if gstin != "" && !gstinPattern.MatchString(gstin) {
+			return nil, errors.New("Invalid GSTIN")
+		}
+		updateData["gstin"] = gstin
+	}
+	return updateData, nil
+}
+
 func updateProfile(w http.ResponseWriter, r *http.Request) {
 	userID, _ := GetUserID(r)
 
-	var updateData map[string]interface{}
-	DecodeJSON(r, &updateData)
+	var body map[string]interface{}
+	if err := DecodeJSON(r, &body); err != nil {
+		JSONError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	updateData, err := profileUpdate(body)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	collection := GetCollection("users")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	delete(updateData, "password")
-	delete(updateData, "_id")
-	delete(updateData, "email")
 	updateData["updatedAt"] = time.Now()
-
-	collection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": updateData})
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": updateData}); err != nil {
+		JSONError(w, http.StatusInternalServerError, "Failed to update profile")
+		return
+	}
 
 	JSON(w, http.StatusOK, map[string]string{"message": "Profile updated successfully"})
 }
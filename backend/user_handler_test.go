@@ -0,0 +1,62 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestProfileUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    map[string]interface{}
+		want    bson.M
+		wantErr bool
+	}{
+		{
+			name: "editable fields",
+			body: map[string]interface{}{"name": " Asha ", "phone": "9876543210"},
+			want: bson.M{"name": "Asha", "phone": "9876543210"},
+		},
+		{
+			name: "server-set fields are ignored",
+			body: map[string]interface{}{"name": "Asha", "role": "support", "idVerified": true, "rating": 5.0},
+			want: bson.M{"name": "Asha"},
+		},
+		{
+			name: "keys match exactly",
+			body: map[string]interface{}{"Role": "support", "NAME": "Asha"},
+			want: bson.M{},
+		},
+		{
+			name: "null clears a field",
+			body: map[string]interface{}{"avatar": nil},
+			want: bson.M{"avatar": ""},
+		},
+		{
+			name: "gstin is upper-cased",
+			body: map[string]interface{}{"gstin": "27aapfu0939f1zv"},
+			want: bson.M{"gstin": "27AAPFU0939F1ZV"},
+		},
+		{
+			name: "gstin can be removed",
+			body: map[string]interface{}{"gstin": ""},
+			want: bson.M{"gstin": ""},
+		},
+		{name: "invalid gstin", body: map[string]interface{}{"gstin": "27AAPFU0939"}, wantErr: true},
+		{name: "not a string", body: map[string]interface{}{"phone": 9876543210.0}, wantErr: true},
+		{name: "nested object", body: map[string]interface{}{"location": map[string]interface{}{"city": "Pune"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := profileUpdate(tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("profileUpdate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("profileUpdate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -231,7 +231,25 @@ func handleWebSocketMessage(client *Client, msg map[string]interface{}) {
 	case "send_message":
 		if chatID, ok := msg["chatId"].(string); ok {
 			if content, ok := msg["content"].(string); ok {
-				saveAndBroadcastMessage(client, chatID, content)
+				saveAndBroadcastMessage(client.UserID, chatID, content, nil)
+			}
+		}
+
+	case "send_offer":
+		if chatID, ok := msg["chatId"].(string); ok {
+			var req offerRequest
+			raw, _ := json.Marshal(msg["offer"])
+			json.Unmarshal(raw, &req)
+			if _, err := sendOffer(client.UserID, chatID, req, nil); err != nil {
+				data, _ := json.Marshal(map[string]interface{}{
+					"type":   "offer_error",
+					"chatId": chatID,
+					"error":  err.Error(),
+				})
+				select {
+				case client.Send <- data:
+				default:
+				}
 			}
 		}
 
@@ -244,10 +262,12 @@ func handleWebSocketMessage(client *Client, msg map[string]interface{}) {
 	}
 }
 
-func saveAndBroadcastMessage(client *Client, chatID, content string) {
+// saveAndBroadcastMessage stores a message from senderID and delivers it to
+// the other participants of the chat. offer is set for offer messages.
+func saveAndBroadcastMessage(senderID primitive.ObjectID, chatID, content string, offer *Offer) (*Message, error) {
 	chatObjID, err := primitive.ObjectIDFromHex(chatID)
 	if err != nil {
-		return
+		return nil, err
 	}
 
 	collection := GetCollection("messages")
@@ -258,28 +278,32 @@ func saveAndBroadcastMessage(client *Client, chatID, content string) {
 	message := Message{
 		ID:        primitive.NewObjectID(),
 		ChatID:    chatObjID,
-		SenderID:  client.UserID,
+		SenderID:  senderID,
 		Content:   content,
+		Offer:     offer,
 		IsRead:    false,
 		CreatedAt: time.Now(),
 	}
+	if offer != nil {
+		message.Type = MessageOffer
+	}
 
 	if _, err := collection.InsertOne(ctx, message); err != nil {
 		log.Printf("Error saving message: %v", err)
-		return
+		return nil, err
 	}
 
 	// Get chat to find participants
 	var chat Chat
 	if err := chatCollection.FindOne(ctx, bson.M{"_id": chatObjID}).Decode(&chat); err != nil {
 		log.Printf("Error finding chat: %v", err)
-		return
+		return &message, nil
 	}
 
 	// Update chat's updatedAt and increment unread count for all participants except sender
 	updateFields := bson.M{"updatedAt": time.Now()}
 	for _, participantID := range chat.Participants {
-		if participantID != client.UserID {
+		if participantID != senderID {
 			// Increment unread count for this participant
 			key := "unreadCount." + participantID.Hex()
 			chatCollection.UpdateOne(ctx, bson.M{"_id": chatObjID}, bson.M{
@@ -302,11 +326,11 @@ func saveAndBroadcastMessage(client *Client, chatID, content string) {
 	// Also send direct notification to all participants (for badge updates)
 	// This notifies users even if they're not in the chat room
 	for _, participantID := range chat.Participants {
-		if participantID != client.UserID {
+		if participantID != senderID {
 			// Get sender info for the notification
 			userCol := GetCollection("users")
 			var sender User
-			userCol.FindOne(ctx, bson.M{"_id": client.UserID}).Decode(&sender)
+			userCol.FindOne(ctx, bson.M{"_id": senderID}).Decode(&sender)
 
 			// Truncate content for preview
 			preview := content
@@ -317,7 +341,7 @@ func saveAndBroadcastMessage(client *Client, chatID, content string) {
 			notificationData, _ := json.Marshal(map[string]interface{}{
 				"type":       "new_chat_notification",
 				"chatId":     chatID,
-				"senderId":   client.UserID.Hex(),
+				"senderId":   senderID.Hex(),
 				"senderName": sender.Name,
 				"preview":    preview,
 				"timestamp":  time.Now(),
@@ -328,6 +352,7 @@ func saveAndBroadcastMessage(client *Client, chatID, content string) {
 			SendChatPushNotification(participantID, sender.Name, content, chatID)
 		}
 	}
+	return &message, nil
 }
 
 func broadcastTyping(client *Client, chatID string, isTyping bool) {